@@ -0,0 +1,103 @@
+package redis_cache
+
+import (
+	"context"
+	"slices"
+	"strconv"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/redis/rueidis"
+)
+
+// Run with: go test ./cache -run '^$' -bench ConnectionMode -benchtime 5s
+//
+// Sequential callers show the latency of a single round trip: pool and dedicated
+// connections answer on the calling goroutine, auto pipelining hands every
+// command to the pipe goroutines. Parallel callers show the throughput: auto
+// pipelining batches concurrent commands over a few connections while the pool
+// is bounded by pool_max_connections. max_flush_delay trades latency for fewer
+// system calls under load.
+
+var benchmarkConnectionModes = []struct {
+	name  string
+	mode  string
+	extra []string
+}{
+	{name: "auto_pipeline", mode: ConnectionModeAutoPipeline},
+	{name: "auto_pipeline_max_flush_delay_20us", mode: ConnectionModeAutoPipeline, extra: []string{"max_flush_delay: 20us"}},
+	{name: "auto_pipeline_multiplex_0", mode: ConnectionModeAutoPipeline, extra: []string{"pipeline_multiplex: 0"}},
+	{name: "pool", mode: ConnectionModePool},
+	{name: "dedicated", mode: ConnectionModeDedicated},
+}
+
+func BenchmarkConnectionModeSequential(b *testing.B) {
+	for _, bm := range benchmarkConnectionModes {
+		b.Run(bm.name, func(b *testing.B) {
+			client := setupTestClientWithConnectionMode(b, bm.mode, bm.extra...)
+			defer Close(client)
+
+			latencies := make([]time.Duration, 0, b.N)
+			b.ResetTimer()
+			for i := 0; i < b.N; i++ {
+				latencies = append(latencies, benchmarkSetGet(b, client, i))
+			}
+			b.StopTimer()
+			reportLatencies(b, latencies)
+		})
+	}
+}
+
+func BenchmarkConnectionModeParallel(b *testing.B) {
+	for _, bm := range benchmarkConnectionModes {
+		b.Run(bm.name, func(b *testing.B) {
+			client := setupTestClientWithConnectionMode(b, bm.mode, bm.extra...)
+			defer Close(client)
+
+			var mu sync.Mutex
+			var latencies []time.Duration
+			// 8 goroutines per CPU, a busy service rather than a single caller
+			b.SetParallelism(8)
+			b.ResetTimer()
+			b.RunParallel(func(pb *testing.PB) {
+				local := make([]time.Duration, 0, 1024)
+				for i := 0; pb.Next(); i++ {
+					local = append(local, benchmarkSetGet(b, client, i))
+				}
+				mu.Lock()
+				latencies = append(latencies, local...)
+				mu.Unlock()
+			})
+			b.StopTimer()
+			reportLatencies(b, latencies)
+		})
+	}
+}
+
+// benchmarkSetGet writes and reads back a key, and returns how long it took.
+func benchmarkSetGet(b *testing.B, client rueidis.Client, i int) time.Duration {
+	ctx := context.Background()
+	key := "bench-" + strconv.Itoa(i%1024)
+	start := time.Now()
+	if err := SetStringDataToCacheWithExpiry(ctx, client, key, "value", ExpireIn(time.Minute)); err != nil {
+		b.Fatalf("SetStringDataToCacheWithExpiry() error = %v", err)
+	}
+	if _, err := GetStringDataFromCache(ctx, client, key); err != nil {
+		b.Fatalf("GetStringDataFromCache() error = %v", err)
+	}
+	return time.Since(start)
+}
+
+// reportLatencies reports the median and tail latency of a set/get pair.
+func reportLatencies(b *testing.B, latencies []time.Duration) {
+	if len(latencies) == 0 {
+		return
+	}
+	slices.Sort(latencies)
+	percentile := func(p float64) float64 {
+		return float64(latencies[int(float64(len(latencies)-1)*p)].Microseconds())
+	}
+	b.ReportMetric(percentile(0.50), "p50-us")
+	b.ReportMetric(percentile(0.99), "p99-us")
+}
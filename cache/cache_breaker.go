@@ -0,0 +1,306 @@
+package redis_cache
+
+import (
+	"context"
+	"errors"
+	"log"
+	"sync"
+	"time"
+
+	"github.com/redis/rueidis"
+)
+
+// This file contains the circuit breaker guarding every command sent with a client :
+// 1. Closed: commands are sent, their errors and latencies are counted over a rolling window
+// 2. Open: once the error rate or the slow call rate crosses its threshold, commands fail
+//    with ErrCircuitOpen without reaching Redis
+// 3. Half-open: after OpenTimeout a few probe commands are let through, they close the
+//    circuit when they all succeed and open it again as soon as one fails
+//
+// Only connection errors, timeouts and the transient errors of IsRetryableError
+// count as failures: a WRONGTYPE or a nil reply means Redis is healthy. The breaker
+// wraps the retries, so a command retried until it succeeded counts once, as slow.
+
+// ErrCircuitOpen is returned without sending the command while the circuit is open.
+var ErrCircuitOpen = errors.New("circuit breaker is open")
+
+// CircuitState is the state of a CircuitBreaker.
+type CircuitState int
+
+const (
+	CircuitClosed CircuitState = iota
+	CircuitOpen
+	CircuitHalfOpen
+)
+
+func (s CircuitState) String() string {
+	switch s {
+	case CircuitClosed:
+		return "closed"
+	case CircuitOpen:
+		return "open"
+	case CircuitHalfOpen:
+		return "half-open"
+	default:
+		return "unknown"
+	}
+}
+
+// breakerBuckets is the number of buckets the rolling window is split into.
+const breakerBuckets = 10
+
+// minBreakerWindow is the shortest rolling window, 1ms per bucket.
+const minBreakerWindow = breakerBuckets * time.Millisecond
+
+// CircuitBreakerOptions configures a CircuitBreaker, set with the circuit_breaker section of the config.
+type CircuitBreakerOptions struct {
+	// Window is the rolling window the rates are computed over. 10s by default,
+	// shorter windows are raised to 10ms.
+	Window time.Duration
+	// MinRequests is the number of commands in the window before the circuit can open. 20 by default.
+	MinRequests int
+	// ErrorRateThreshold opens the circuit when that fraction of the commands failed. 0.5 by default.
+	ErrorRateThreshold float64
+	// SlowCallDuration is the latency above which a command is slow. 1s by default.
+	// Blocking commands such as BLPOP are never slow.
+	SlowCallDuration time.Duration
+	// SlowCallRateThreshold opens the circuit when that fraction of the commands was slow. 0.5 by default.
+	SlowCallRateThreshold float64
+	// OpenTimeout is how long the circuit stays open before probing Redis. 5s by default.
+	OpenTimeout time.Duration
+	// HalfOpenMaxRequests is the number of probes let through while half-open. 3 by default.
+	HalfOpenMaxRequests int
+
+	// Now is the clock, time.Now by default.
+	Now func() time.Time
+}
+
+func (o *CircuitBreakerOptions) setDefaults() {
+	if o.Window <= 0 {
+		o.Window = 10 * time.Second
+	}
+	if o.Window < minBreakerWindow {
+		o.Window = minBreakerWindow
+	}
+	if o.MinRequests <= 0 {
+		o.MinRequests = 20
+	}
+	if o.ErrorRateThreshold <= 0 || o.ErrorRateThreshold > 1 {
+		o.ErrorRateThreshold = 0.5
+	}
+	if o.SlowCallDuration <= 0 {
+		o.SlowCallDuration = time.Second
+	}
+	if o.SlowCallRateThreshold <= 0 || o.SlowCallRateThreshold > 1 {
+		o.SlowCallRateThreshold = 0.5
+	}
+	if o.OpenTimeout <= 0 {
+		o.OpenTimeout = 5 * time.Second
+	}
+	if o.HalfOpenMaxRequests <= 0 {
+		o.HalfOpenMaxRequests = 3
+	}
+	if o.Now == nil {
+		o.Now = time.Now
+	}
+}
+
+// breakerBucket counts the commands of a slice of the rolling window.
+type breakerBucket struct {
+	start    time.Time
+	calls    int
+	failures int
+	slow     int
+}
+
+// CircuitBreaker fails fast while Redis is unhealthy. It is safe for concurrent use.
+type CircuitBreaker struct {
+	opts CircuitBreakerOptions
+
+	mu    sync.Mutex
+	state CircuitState
+	// generation is bumped on every state change, so the outcome of a command
+	// allowed in a previous state is not counted in the new one
+	generation uint64
+	openedAt   time.Time
+	buckets    [breakerBuckets]breakerBucket
+	// probes is the number of commands let through while half-open, successes how many succeeded
+	probes    int
+	successes int
+	listeners []func(from, to CircuitState)
+}
+
+// NewCircuitBreaker returns a closed circuit breaker.
+func NewCircuitBreaker(opts CircuitBreakerOptions) *CircuitBreaker {
+	opts.setDefaults()
+	return &CircuitBreaker{opts: opts}
+}
+
+// GetCircuitBreaker returns the circuit breaker of client, nil when circuit_breaker is not enabled.
+func GetCircuitBreaker(client rueidis.Client) *CircuitBreaker {
+	return optionsOf(client).breaker
+}
+
+// State returns the current state. An open circuit past its OpenTimeout is
+// reported open until the next command probes Redis.
+func (b *CircuitBreaker) State() CircuitState {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	return b.state
+}
+
+// OnStateChange registers fn, called after every state change. Callbacks run
+// on the goroutine of the command causing the change and must not block.
+func (b *CircuitBreaker) OnStateChange(fn func(from, to CircuitState)) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	b.listeners = append(b.listeners, fn)
+}
+
+// execute calls fn unless the circuit is open, and records the error it returns.
+// It returns ErrCircuitOpen when fn was not called. Only timed calls can be slow.
+func (b *CircuitBreaker) execute(timed bool, fn func() error) error {
+	if b == nil {
+		fn()
+		return nil
+	}
+	generation, err := b.allow()
+	if err != nil {
+		return err
+	}
+	start := b.opts.Now()
+	err = fn()
+	b.record(generation, err, timed && b.opts.Now().Sub(start) >= b.opts.SlowCallDuration)
+	return nil
+}
+
+// allow reports whether a command may be sent, and returns the generation it is sent in.
+func (b *CircuitBreaker) allow() (uint64, error) {
+	b.mu.Lock()
+	var notify func()
+	if b.state == CircuitOpen {
+		if b.opts.Now().Sub(b.openedAt) < b.opts.OpenTimeout {
+			b.mu.Unlock()
+			return 0, ErrCircuitOpen
+		}
+		notify = b.setState(CircuitHalfOpen)
+	}
+	if b.state == CircuitHalfOpen {
+		if b.probes >= b.opts.HalfOpenMaxRequests {
+			b.mu.Unlock()
+			return 0, ErrCircuitOpen
+		}
+		b.probes++
+	}
+	generation := b.generation
+	b.mu.Unlock()
+
+	if notify != nil {
+		notify()
+	}
+	return generation, nil
+}
+
+// record counts the outcome of a command allowed in generation.
+func (b *CircuitBreaker) record(generation uint64, err error, slow bool) {
+	failed := isBreakerFailure(err)
+	// A command cancelled by its caller says nothing about Redis
+	ignored := !failed && errors.Is(err, context.Canceled)
+
+	b.mu.Lock()
+	if generation != b.generation {
+		b.mu.Unlock()
+		return
+	}
+
+	var notify func()
+	switch b.state {
+	case CircuitClosed:
+		if ignored {
+			break
+		}
+		now := b.opts.Now()
+		bucket := b.bucket(now)
+		bucket.calls++
+		if failed {
+			bucket.failures++
+		}
+		if slow {
+			bucket.slow++
+		}
+		calls, failures, slowCalls := b.totals(now)
+		if calls >= b.opts.MinRequests &&
+			(float64(failures)/float64(calls) >= b.opts.ErrorRateThreshold || float64(slowCalls)/float64(calls) >= b.opts.SlowCallRateThreshold) {
+			notify = b.setState(CircuitOpen)
+		}
+	case CircuitHalfOpen:
+		switch {
+		case ignored:
+			// Let another probe through instead
+			b.probes--
+		case failed || slow:
+			notify = b.setState(CircuitOpen)
+		default:
+			b.successes++
+			if b.successes >= b.opts.HalfOpenMaxRequests {
+				notify = b.setState(CircuitClosed)
+			}
+		}
+	}
+	b.mu.Unlock()
+
+	if notify != nil {
+		notify()
+	}
+}
+
+// setState moves to state, b.mu must be held. It returns the function calling
+// the listeners, to be called once b.mu is released.
+func (b *CircuitBreaker) setState(state CircuitState) func() {
+	from := b.state
+	b.state = state
+	b.generation++
+	b.buckets = [breakerBuckets]breakerBucket{}
+	b.probes = 0
+	b.successes = 0
+	if state == CircuitOpen {
+		b.openedAt = b.opts.Now()
+	}
+
+	listeners := append([]func(from, to CircuitState){}, b.listeners...)
+	return func() {
+		log.Printf("redis_cache: circuit breaker %s -> %s", from, state)
+		for _, fn := range listeners {
+			fn(from, state)
+		}
+	}
+}
+
+// bucket returns the bucket counting the commands made at now, b.mu must be held.
+func (b *CircuitBreaker) bucket(now time.Time) *breakerBucket {
+	width := b.opts.Window / breakerBuckets
+	start := now.Truncate(width)
+	bucket := &b.buckets[(start.UnixNano()/int64(width))%breakerBuckets]
+	if !bucket.start.Equal(start) {
+		*bucket = breakerBucket{start: start}
+	}
+	return bucket
+}
+
+// totals sums the buckets of the window ending at now, b.mu must be held.
+func (b *CircuitBreaker) totals(now time.Time) (calls, failures, slow int) {
+	for _, bucket := range b.buckets {
+		if now.Sub(bucket.start) < b.opts.Window {
+			calls += bucket.calls
+			failures += bucket.failures
+			slow += bucket.slow
+		}
+	}
+	return calls, failures, slow
+}
+
+// isBreakerFailure reports whether err means Redis is unhealthy: a transient
+// error, a timeout, or no connection at all.
+func isBreakerFailure(err error) bool {
+	return IsRetryableError(err) || errors.Is(err, context.DeadlineExceeded) || errors.Is(err, rueidis.ErrClosing)
+}
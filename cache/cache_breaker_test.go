@@ -0,0 +1,229 @@
+package redis_cache
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"slices"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/redis/rueidis"
+)
+
+// breakerTransitions records the state changes of a circuit breaker.
+type breakerTransitions []string
+
+func (r *breakerTransitions) record(from, to CircuitState) {
+	*r = append(*r, from.String()+" -> "+to.String())
+}
+
+func TestErrorResults(t *testing.T) {
+	resps := errorResults(ErrCircuitOpen, 2)
+	if len(resps) != 2 {
+		t.Fatalf("errorResults() returned %d results, want 2", len(resps))
+	}
+	resp := resps[1]
+	if err := resp.Error(); !errors.Is(err, ErrCircuitOpen) {
+		t.Errorf("Error() = %v, want ErrCircuitOpen", err)
+	}
+	if _, err := resp.ToString(); !errors.Is(err, ErrCircuitOpen) {
+		t.Errorf("ToString() error = %v, want ErrCircuitOpen", err)
+	}
+}
+
+func TestCircuitBreaker(t *testing.T) {
+	clock := &fakeClock{now: time.Unix(1700000000, 0)}
+	breaker := NewCircuitBreaker(CircuitBreakerOptions{MinRequests: 4, OpenTimeout: time.Second, HalfOpenMaxRequests: 2, Now: clock.Now})
+	var transitions breakerTransitions
+	breaker.OnStateChange(transitions.record)
+
+	calls := 0
+	call := func(err error) error {
+		return breaker.execute(true, func() error {
+			calls++
+			return err
+		})
+	}
+
+	// Command errors and cancelled calls do not count as failures
+	for _, err := range []error{errors.New("WRONGTYPE"), context.Canceled, nil, nil, nil} {
+		call(err)
+	}
+	if breaker.State() != CircuitClosed {
+		t.Fatalf("State() = %v, want closed", breaker.State())
+	}
+
+	// Half of the calls of the window failed
+	call(io.EOF)
+	call(io.EOF)
+	call(io.EOF)
+	if breaker.State() != CircuitClosed {
+		t.Fatalf("State() after 3 failures out of 7 = %v, want closed", breaker.State())
+	}
+	call(context.DeadlineExceeded)
+	if breaker.State() != CircuitOpen {
+		t.Fatalf("State() = %v, want open", breaker.State())
+	}
+
+	// Open: nothing is sent until the timeout
+	calls = 0
+	if err := call(nil); !errors.Is(err, ErrCircuitOpen) || calls != 0 {
+		t.Errorf("execute() while open = %v after %d calls, want ErrCircuitOpen without calling", err, calls)
+	}
+
+	// Half-open: a failing probe opens the circuit again
+	clock.Advance(time.Second)
+	if err := call(io.EOF); err != nil || calls != 1 {
+		t.Errorf("execute() probe = %v after %d calls, want the probe to be sent", err, calls)
+	}
+	if breaker.State() != CircuitOpen {
+		t.Fatalf("State() after a failed probe = %v, want open", breaker.State())
+	}
+
+	// Half-open: only HalfOpenMaxRequests probes are sent, and close the circuit when they succeed
+	clock.Advance(time.Second)
+	breaker.execute(true, func() error {
+		call(nil)
+		if err := call(nil); !errors.Is(err, ErrCircuitOpen) {
+			t.Errorf("execute() of a third probe = %v, want ErrCircuitOpen", err)
+		}
+		return nil
+	})
+	if breaker.State() != CircuitClosed {
+		t.Fatalf("State() after the probes = %v, want closed", breaker.State())
+	}
+
+	want := breakerTransitions{"closed -> open", "open -> half-open", "half-open -> open", "open -> half-open", "half-open -> closed"}
+	if !slices.Equal(transitions, want) {
+		t.Errorf("transitions = %v, want %v", transitions, want)
+	}
+}
+
+func TestCircuitBreakerSlowCalls(t *testing.T) {
+	clock := &fakeClock{now: time.Unix(1700000000, 0)}
+	breaker := NewCircuitBreaker(CircuitBreakerOptions{MinRequests: 2, SlowCallDuration: 100 * time.Millisecond, Now: clock.Now})
+	slow := func(timed bool) {
+		breaker.execute(timed, func() error {
+			clock.Advance(200 * time.Millisecond)
+			return nil
+		})
+	}
+
+	// Blocking commands are never slow
+	slow(false)
+	slow(false)
+	if breaker.State() != CircuitClosed {
+		t.Fatalf("State() after untimed calls = %v, want closed", breaker.State())
+	}
+	slow(true)
+	slow(true)
+	if breaker.State() != CircuitOpen {
+		t.Errorf("State() after slow calls = %v, want open", breaker.State())
+	}
+}
+
+func TestCircuitBreakerWindow(t *testing.T) {
+	clock := &fakeClock{now: time.Unix(1700000000, 0)}
+	breaker := NewCircuitBreaker(CircuitBreakerOptions{Window: 10 * time.Second, MinRequests: 4, Now: clock.Now})
+	call := func(err error) {
+		breaker.execute(true, func() error { return err })
+	}
+
+	call(io.EOF)
+	call(io.EOF)
+	call(io.EOF)
+	// The failures fall out of the window
+	clock.Advance(11 * time.Second)
+	call(io.EOF)
+	call(nil)
+	call(nil)
+	call(nil)
+	if breaker.State() != CircuitClosed {
+		t.Errorf("State() = %v, want closed once old failures left the window", breaker.State())
+	}
+}
+
+func TestCircuitBreakerShortWindow(t *testing.T) {
+	clock := &fakeClock{now: time.Unix(1700000000, 0)}
+	// A window under 10ns would make the buckets 0ns wide
+	breaker := NewCircuitBreaker(CircuitBreakerOptions{Window: 5 * time.Nanosecond, MinRequests: 2, Now: clock.Now})
+	breaker.execute(true, func() error { return io.EOF })
+	breaker.execute(true, func() error { return io.EOF })
+	if breaker.State() != CircuitOpen {
+		t.Errorf("State() = %v, want open", breaker.State())
+	}
+}
+
+func TestCircuitBreakerClient(t *testing.T) {
+	s := startFaultyServer(t)
+	client := connectToFaultyServer(t, s, `
+    retry:
+      max_attempts: 1
+    circuit_breaker:
+      enabled: true
+      min_requests: 2
+      open_timeout: 1h
+`)
+	defer Close(client)
+
+	breaker := GetCircuitBreaker(client)
+	if breaker == nil {
+		t.Fatal("GetCircuitBreaker() = nil, want the configured breaker")
+	}
+
+	ctx := context.Background()
+	s.fail("SET", "LOADING Redis is loading the dataset in memory", "LOADING Redis is loading the dataset in memory")
+	SetStringDataToCacheWithExpiry(ctx, client, "breaker-key", "value", ExpireIn(time.Minute))
+	SetStringDataToCacheWithExpiry(ctx, client, "breaker-key", "value", ExpireIn(time.Minute))
+	if breaker.State() != CircuitOpen {
+		t.Fatalf("State() = %v, want open", breaker.State())
+	}
+
+	// Open: every operation fails fast without reaching Redis
+	s.callsOf("SET")
+	err := SetStringDataToCacheWithExpiry(ctx, client, "breaker-key", "value", ExpireIn(time.Minute))
+	if !errors.Is(err, ErrCircuitOpen) {
+		t.Errorf("SetStringDataToCacheWithExpiry() error = %v, want ErrCircuitOpen", err)
+	}
+	if got := s.callsOf("SET"); got != 0 {
+		t.Errorf("SET was sent %d times while open, want 0", got)
+	}
+	p := NewPipeline(client)
+	get := p.GetString("breaker-key")
+	if err := p.Exec(ctx); !errors.Is(err, ErrCircuitOpen) {
+		t.Errorf("Exec() error = %v, want ErrCircuitOpen", err)
+	}
+	if _, err := get.Result(); !strings.Contains(fmt.Sprint(err), ErrCircuitOpen.Error()) {
+		t.Errorf("GetString() error = %v, want ErrCircuitOpen", err)
+	}
+	if _, err := Transaction(ctx, client, []string{"breaker-key"}, func(ctx context.Context, tx *Tx) error { return nil }, TxOptions{}); !errors.Is(err, ErrCircuitOpen) {
+		t.Errorf("Transaction() error = %v, want ErrCircuitOpen", err)
+	}
+	if err := client.DoCache(ctx, client.B().Get().Key("breaker-key").Cache(), time.Minute).Error(); !errors.Is(err, ErrCircuitOpen) {
+		t.Errorf("DoCache() error = %v, want ErrCircuitOpen", err)
+	}
+	if stream := client.DoStream(ctx, client.B().Get().Key("breaker-key").Build()); !errors.Is(stream.Error(), ErrCircuitOpen) {
+		t.Errorf("DoStream() error = %v, want ErrCircuitOpen", stream.Error())
+	}
+	if err := client.Receive(ctx, client.B().Subscribe().Channel("breaker-channel").Build(), func(rueidis.PubSubMessage) {}); !errors.Is(err, ErrCircuitOpen) {
+		t.Errorf("Receive() error = %v, want ErrCircuitOpen", err)
+	}
+	dedicated, cancel := client.Dedicate()
+	if err := dedicated.Do(ctx, dedicated.B().Get().Key("breaker-key").Build()).Error(); !errors.Is(err, ErrCircuitOpen) {
+		t.Errorf("Dedicate() Do() error = %v, want ErrCircuitOpen", err)
+	}
+	cancel()
+	if got := s.callsOf("GET") + s.callsOf("SUBSCRIBE"); got != 0 {
+		t.Errorf("GET and SUBSCRIBE were sent %d times while open, want 0", got)
+	}
+
+	// Without a circuit_breaker section there is no breaker
+	plain, _ := setupRetryClient(t, s, &fakeClock{})
+	defer Close(plain)
+	if GetCircuitBreaker(plain) != nil {
+		t.Errorf("GetCircuitBreaker() = %v, want nil when not enabled", GetCircuitBreaker(plain))
+	}
+}
@@ -1,6 +1,8 @@
 package redis_cache
 
 import (
+	"time"
+
 	"golang.org/x/exp/constraints"
 )
 
@@ -8,8 +10,12 @@ type CustomDataType interface {
 	constraints.Ordered | []byte | []rune
 }
 
-type CacheDataUnit struct {
+type CacheDataUnit[T CustomDataType] struct {
 	Key                 string
-	Data                CustomDataType
-	LastUpdateTimestamp time.time
+	Data                T
+	LastUpdateTimestamp time.Time
+	// SoftExpiresAt is when Data becomes stale and is refreshed in the background
+	SoftExpiresAt time.Time
+	// HardExpiresAt is when Data can no longer be served, unless the refresh fails
+	HardExpiresAt time.Time
 }
@@ -0,0 +1,310 @@
+package redis_cache
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"fmt"
+	"sync"
+	"time"
+
+	"github.com/redis/rueidis"
+	"github.com/redis/rueidis/rueidishook"
+)
+
+// cacheClient is the rueidis.Client returned by InitializeCacheConnection.
+// It behaves exactly like the wrapped client, and additionally carries the
+// package level settings loaded from CacheConnectionConfig so the get/set
+// functions can pick them up without changing their signatures.
+//
+// Every method sending commands is gated by Shutdown and the circuit breaker,
+// and the ones with a reply to check are retried, see each method for what
+// streams, subscriptions and dedicated connections leave out. The clients of
+// Nodes are the raw per node clients, used to load scripts everywhere.
+type cacheClient struct {
+	rueidis.Client
+	opts *clientOptions
+}
+
+// clientOptions holds the settings the package applies on every call.
+type clientOptions struct {
+	jitter    *JitterPolicy
+	namespace Namespace
+	// retry is nil when retries are disabled
+	retry *retrier
+	// breaker is nil when circuit_breaker is not enabled
+	breaker *CircuitBreaker
+	// fallback is nil when fallback is not enabled
+	fallback *fallbackStore
+	// life counts the work in flight for Shutdown
+	life *lifecycle
+}
+
+// newClientOptions builds the client settings from the loaded config.
+func newClientOptions(config *CacheConnectionConfig) *clientOptions {
+	return &clientOptions{
+		jitter:    config.jitterPolicy(),
+		namespace: config.namespace(),
+		retry:     newRetrier(config.retryPolicy()),
+		breaker:   config.circuitBreaker(),
+		fallback:  config.fallbackStore(),
+		life:      newLifecycle(),
+	}
+}
+
+// Do sends cmd through the client's circuit breaker and retry policy.
+// It fails with ErrShutdown once Shutdown was called.
+func (c *cacheClient) Do(ctx context.Context, cmd rueidis.Completed) (resp rueidis.RedisResult) {
+	if c.opts == nil {
+		return c.Client.Do(ctx, cmd)
+	}
+	if err := c.opts.life.begin(ctx, workCommands); err != nil {
+		return rueidishook.NewErrorResult(err)
+	}
+	defer c.opts.life.end(workCommands)
+	if err := c.opts.breaker.execute(!cmd.IsBlock(), func() error {
+		resp = c.opts.retry.do(ctx, cmd, c.Client.Do)
+		return resp.Error()
+	}); err != nil {
+		return rueidishook.NewErrorResult(err)
+	}
+	return resp
+}
+
+// DoMulti sends multi in one round trip, through the client's circuit breaker and retry policy.
+func (c *cacheClient) DoMulti(ctx context.Context, multi ...rueidis.Completed) (resps []rueidis.RedisResult) {
+	if c.opts == nil {
+		return c.Client.DoMulti(ctx, multi...)
+	}
+	if err := c.opts.life.begin(ctx, workCommands); err != nil {
+		return errorResults(err, len(multi))
+	}
+	defer c.opts.life.end(workCommands)
+	timed := true
+	for _, cmd := range multi {
+		timed = timed && !cmd.IsBlock()
+	}
+	if err := c.opts.breaker.execute(timed, func() error {
+		resps = c.opts.retry.doMulti(ctx, multi, c.Client.DoMulti)
+		return firstFailure(resps)
+	}); err != nil {
+		return errorResults(err, len(multi))
+	}
+	return resps
+}
+
+// Dedicated runs fn on a dedicated connection, unless the circuit breaker is open.
+func (c *cacheClient) Dedicated(fn func(rueidis.DedicatedClient) error) (err error) {
+	if c.opts == nil {
+		return c.Client.Dedicated(fn)
+	}
+	if err := c.opts.life.begin(context.Background(), workCommands); err != nil {
+		return err
+	}
+	defer c.opts.life.end(workCommands)
+	if openErr := c.opts.breaker.execute(false, func() error {
+		err = c.Client.Dedicated(fn)
+		return err
+	}); openErr != nil {
+		return openErr
+	}
+	return err
+}
+
+// Dedicate borrows a dedicated connection, until the returned function is
+// called. Once Shutdown was called, or while the circuit breaker is open, the
+// connection fails every command with ErrShutdown or ErrCircuitOpen. Its
+// commands are neither retried nor counted by the breaker, like the ones of
+// Dedicated, and Shutdown waits for the connection to be given back.
+func (c *cacheClient) Dedicate() (rueidis.DedicatedClient, func()) {
+	if c.opts == nil {
+		return c.Client.Dedicate()
+	}
+	if err := c.opts.life.begin(context.Background(), workCommands); err != nil {
+		return &failedDedicatedClient{builder: c.Client.B(), err: err}, func() {}
+	}
+	if c.opts.breaker != nil && c.opts.breaker.State() == CircuitOpen {
+		c.opts.life.end(workCommands)
+		return &failedDedicatedClient{builder: c.Client.B(), err: ErrCircuitOpen}, func() {}
+	}
+	dedicated, cancel := c.Client.Dedicate()
+	var once sync.Once
+	return dedicated, func() {
+		once.Do(func() {
+			cancel()
+			c.opts.life.end(workCommands)
+		})
+	}
+}
+
+// DoCache sends the cacheable cmd through the client's circuit breaker and
+// retry policy. Replies served from the client side cache count as successes.
+func (c *cacheClient) DoCache(ctx context.Context, cmd rueidis.Cacheable, ttl time.Duration) (resp rueidis.RedisResult) {
+	if c.opts == nil {
+		return c.Client.DoCache(ctx, cmd, ttl)
+	}
+	if err := c.opts.life.begin(ctx, workCommands); err != nil {
+		return rueidishook.NewErrorResult(err)
+	}
+	defer c.opts.life.end(workCommands)
+	if err := c.opts.breaker.execute(true, func() error {
+		resp = c.opts.retry.doCache(ctx, cmd, ttl, c.Client.DoCache)
+		return resp.Error()
+	}); err != nil {
+		return rueidishook.NewErrorResult(err)
+	}
+	return resp
+}
+
+// DoMultiCache sends multi through the client's circuit breaker and retry policy.
+func (c *cacheClient) DoMultiCache(ctx context.Context, multi ...rueidis.CacheableTTL) (resps []rueidis.RedisResult) {
+	if c.opts == nil {
+		return c.Client.DoMultiCache(ctx, multi...)
+	}
+	if err := c.opts.life.begin(ctx, workCommands); err != nil {
+		return errorResults(err, len(multi))
+	}
+	defer c.opts.life.end(workCommands)
+	if err := c.opts.breaker.execute(true, func() error {
+		resps = c.opts.retry.doMultiCache(ctx, multi, c.Client.DoMultiCache)
+		return firstFailure(resps)
+	}); err != nil {
+		return errorResults(err, len(multi))
+	}
+	return resps
+}
+
+// DoStream sends cmd through the client's circuit breaker and retry policy.
+// The reply is read by the caller after DoStream returned, so only a failure
+// to send cmd is retried and counted by the breaker, and Shutdown does not
+// wait for the reply to be read.
+func (c *cacheClient) DoStream(ctx context.Context, cmd rueidis.Completed) (stream rueidis.RedisResultStream) {
+	if c.opts == nil {
+		return c.Client.DoStream(ctx, cmd)
+	}
+	if err := c.opts.life.begin(ctx, workCommands); err != nil {
+		return rueidishook.NewErrorResultStream(err)
+	}
+	defer c.opts.life.end(workCommands)
+	if err := c.opts.breaker.execute(false, func() error {
+		stream = c.opts.retry.doStream(ctx, cmd, c.Client.DoStream)
+		return stream.Error()
+	}); err != nil {
+		return rueidishook.NewErrorResultStream(err)
+	}
+	return stream
+}
+
+// DoMultiStream sends multi like DoStream.
+func (c *cacheClient) DoMultiStream(ctx context.Context, multi ...rueidis.Completed) (stream rueidis.MultiRedisResultStream) {
+	if c.opts == nil {
+		return c.Client.DoMultiStream(ctx, multi...)
+	}
+	if err := c.opts.life.begin(ctx, workCommands); err != nil {
+		return rueidishook.NewErrorResultStream(err)
+	}
+	defer c.opts.life.end(workCommands)
+	if err := c.opts.breaker.execute(false, func() error {
+		stream = c.opts.retry.doMultiStream(ctx, multi, c.Client.DoMultiStream)
+		return stream.Error()
+	}); err != nil {
+		return rueidishook.NewErrorResultStream(err)
+	}
+	return stream
+}
+
+// Receive subscribes unless the circuit breaker is open. A subscription lasts
+// until stopped, so it is not counted by the breaker, where it would hold a
+// half-open probe, and it is not retried: callers such as Subscribe resubscribe
+// themselves. It fails with ErrShutdown once Shutdown was called, and returns
+// when the shutdown starts instead of being waited for.
+func (c *cacheClient) Receive(ctx context.Context, subscribe rueidis.Completed, fn func(msg rueidis.PubSubMessage)) error {
+	if c.opts == nil {
+		return c.Client.Receive(ctx, subscribe, fn)
+	}
+	if c.opts.life.stopped() {
+		return ErrShutdown
+	}
+	if c.opts.breaker != nil && c.opts.breaker.State() == CircuitOpen {
+		return ErrCircuitOpen
+	}
+	ctx, stop := c.opts.life.bind(ctx)
+	defer stop()
+	return c.Client.Receive(ctx, subscribe, fn)
+}
+
+// firstFailure returns the first error of resps telling Redis is unhealthy,
+// or the first other error.
+func firstFailure(resps []rueidis.RedisResult) error {
+	var first error
+	for _, resp := range resps {
+		err := resp.Error()
+		if isBreakerFailure(err) {
+			return err
+		}
+		if first == nil && err != nil && !rueidis.IsRedisNil(err) {
+			first = err
+		}
+	}
+	return first
+}
+
+// errorResults returns n results failing with err, for batches that are not sent.
+func errorResults(err error, n int) []rueidis.RedisResult {
+	resps := make([]rueidis.RedisResult, n)
+	for i := range resps {
+		resps[i] = rueidishook.NewErrorResult(err)
+	}
+	return resps
+}
+
+// failedDedicatedClient is returned by Dedicate when no connection can be
+// borrowed, such as until a lazy client is connected. Its commands fail with err.
+type failedDedicatedClient struct {
+	builder rueidis.Builder
+	err     error
+}
+
+func (d *failedDedicatedClient) B() rueidis.Builder {
+	return d.builder
+}
+
+func (d *failedDedicatedClient) Do(ctx context.Context, cmd rueidis.Completed) rueidis.RedisResult {
+	return rueidishook.NewErrorResult(d.err)
+}
+
+func (d *failedDedicatedClient) DoMulti(ctx context.Context, multi ...rueidis.Completed) []rueidis.RedisResult {
+	return errorResults(d.err, len(multi))
+}
+
+func (d *failedDedicatedClient) Receive(ctx context.Context, subscribe rueidis.Completed, fn func(msg rueidis.PubSubMessage)) error {
+	return d.err
+}
+
+func (d *failedDedicatedClient) SetPubSubHooks(hooks rueidis.PubSubHooks) <-chan error {
+	ch := make(chan error, 1)
+	ch <- d.err
+	close(ch)
+	return ch
+}
+
+func (d *failedDedicatedClient) Close() {}
+
+// optionsOf returns the settings attached to client. Clients that were not
+// created by this package get the zero settings.
+func optionsOf(client rueidis.Client) *clientOptions {
+	if c, ok := client.(*cacheClient); ok && c.opts != nil {
+		return c.opts
+	}
+	return &clientOptions{}
+}
+
+// newRandomToken returns a random 128 bit hex token, used for queue item ids
+// and lock owners.
+func newRandomToken() (string, error) {
+	b := make([]byte, 16)
+	if _, err := rand.Read(b); err != nil {
+		return "", fmt.Errorf("failed to generate random token: %v", err)
+	}
+	return hex.EncodeToString(b), nil
+}
@@ -1,12 +1,26 @@
 package redis_cache
 
 import (
+	"fmt"
 	"os"
 	"time"
 
+	"github.com/redis/rueidis"
 	"gopkg.in/yaml.v2"
 )
 
+// Connection modes, see connection_mode.
+const (
+	// ConnectionModeAutoPipeline pipelines concurrent commands over a few shared connections.
+	ConnectionModeAutoPipeline = "auto_pipeline"
+	// ConnectionModePool serves each command on a connection borrowed from the pool,
+	// idle connections are closed down to pool_min_connections after pool_max_idle_time.
+	ConnectionModePool = "pool"
+	// ConnectionModeDedicated is like ConnectionModePool, but connections are never
+	// closed for being idle, so every concurrent caller keeps a warm connection.
+	ConnectionModeDedicated = "dedicated"
+)
+
 type CacheConnectionConfig struct {
 	Cache struct {
 		Usage_Cache_DB struct {
@@ -16,9 +30,66 @@ type CacheConnectionConfig struct {
 			Database               int           `yaml:"database"`
 			Pool_Max_Connections   int           `yaml:"pool_max_connections"`
 			Pool_Min_Connections   int           `yaml:"pool_min_connections"`
-			Auto_Pipelining_Mode   bool          `yaml:"auto_pipelining_mode"`
+			Connection_Mode        string        `yaml:"connection_mode"`
+			Pipeline_Multiplex     int           `yaml:"pipeline_multiplex"`
+			Ring_Scale_Each_Conn   int           `yaml:"ring_scale_each_conn"`
+			Max_Flush_Delay        time.Duration `yaml:"max_flush_delay"`
+			Read_Buffer_Each_Conn  int           `yaml:"read_buffer_each_conn"`
+			Write_Buffer_Each_Conn int           `yaml:"write_buffer_each_conn"`
+			// Deprecated: replaced by connection_mode, a config still setting it is rejected
+			Auto_Pipelining_Mode   *bool         `yaml:"auto_pipelining_mode"`
 			DisableClientSideCache bool          `yaml:"disable_cache"`
 			Pool_Max_Idle_Time     time.Duration `yaml:"pool_max_idle_time"`
+			Namespace              string        `yaml:"namespace"`
+			Namespace_Version      int           `yaml:"namespace_version"`
+			TTL_Jitter             struct {
+				Percent float64       `yaml:"percent"`
+				Min     time.Duration `yaml:"min"`
+				Max     time.Duration `yaml:"max"`
+				Seed    int64         `yaml:"seed"`
+			} `yaml:"ttl_jitter"`
+			Retry struct {
+				Max_Attempts         int           `yaml:"max_attempts"`
+				Base_Backoff         time.Duration `yaml:"base_backoff"`
+				Max_Backoff          time.Duration `yaml:"max_backoff"`
+				Jitter               float64       `yaml:"jitter"`
+				Retry_Non_Idempotent bool          `yaml:"retry_non_idempotent"`
+			} `yaml:"retry"`
+			Circuit_Breaker struct {
+				Enabled                  bool          `yaml:"enabled"`
+				Window                   time.Duration `yaml:"window"`
+				Min_Requests             int           `yaml:"min_requests"`
+				Error_Rate_Threshold     float64       `yaml:"error_rate_threshold"`
+				Slow_Call_Duration       time.Duration `yaml:"slow_call_duration"`
+				Slow_Call_Rate_Threshold float64       `yaml:"slow_call_rate_threshold"`
+				Open_Timeout             time.Duration `yaml:"open_timeout"`
+				Half_Open_Max_Requests   int           `yaml:"half_open_max_requests"`
+			} `yaml:"circuit_breaker"`
+			Fallback struct {
+				Enabled           bool          `yaml:"enabled"`
+				Max_Entries       int           `yaml:"max_entries"`
+				Failure_Threshold int           `yaml:"failure_threshold"`
+				Probe_Interval    time.Duration `yaml:"probe_interval"`
+				Probe_Timeout     time.Duration `yaml:"probe_timeout"`
+				On_Recovery       string        `yaml:"on_recovery"`
+			} `yaml:"fallback"`
+			Lazy_Connect struct {
+				Enabled      bool          `yaml:"enabled"`
+				Base_Backoff time.Duration `yaml:"base_backoff"`
+				Max_Backoff  time.Duration `yaml:"max_backoff"`
+			} `yaml:"lazy_connect"`
+			Redlock struct {
+				Nodes []struct {
+					Host     string `yaml:"host"`
+					Port     string `yaml:"port"`
+					Password string `yaml:"password"`
+					Database int    `yaml:"database"`
+				} `yaml:"nodes"`
+				Clock_Drift_Factor float64       `yaml:"clock_drift_factor"`
+				Retry_Count        int           `yaml:"retry_count"`
+				Retry_Delay        time.Duration `yaml:"retry_delay"`
+				Node_Timeout       time.Duration `yaml:"node_timeout"`
+			} `yaml:"redlock"`
 		} `yaml:"usage_cache_db"`
 	} `yaml:"cache"`
 }
@@ -31,8 +102,8 @@ func (c *CacheConnectionConfig) setDefaults() {
 	if c.Cache.Usage_Cache_DB.Port == "" {
 		c.Cache.Usage_Cache_DB.Port = "6379"
 	}
-	if !c.Cache.Usage_Cache_DB.Auto_Pipelining_Mode {
-		c.Cache.Usage_Cache_DB.Auto_Pipelining_Mode = false
+	if c.Cache.Usage_Cache_DB.Connection_Mode == "" {
+		c.Cache.Usage_Cache_DB.Connection_Mode = ConnectionModeAutoPipeline
 	}
 	if !c.Cache.Usage_Cache_DB.DisableClientSideCache {
 		c.Cache.Usage_Cache_DB.DisableClientSideCache = true
@@ -40,6 +111,225 @@ func (c *CacheConnectionConfig) setDefaults() {
 	if c.Cache.Usage_Cache_DB.Pool_Max_Idle_Time == 0 {
 		c.Cache.Usage_Cache_DB.Pool_Max_Idle_Time = 60 * 60 * time.Second // By default setting the max idle time to 1hr
 	}
+
+	retry := &c.Cache.Usage_Cache_DB.Retry
+	if retry.Max_Attempts == 0 {
+		retry.Max_Attempts = 1 // Retries are opt-in
+	}
+	if retry.Base_Backoff == 0 {
+		retry.Base_Backoff = 10 * time.Millisecond
+	}
+	if retry.Max_Backoff == 0 {
+		retry.Max_Backoff = max(time.Second, retry.Base_Backoff)
+	}
+	if retry.Jitter == 0 {
+		retry.Jitter = 0.5
+	}
+
+	lazy := &c.Cache.Usage_Cache_DB.Lazy_Connect
+	if lazy.Base_Backoff == 0 {
+		lazy.Base_Backoff = 100 * time.Millisecond
+	}
+	if lazy.Max_Backoff == 0 {
+		lazy.Max_Backoff = max(30*time.Second, lazy.Base_Backoff)
+	}
+
+	redlock := &c.Cache.Usage_Cache_DB.Redlock
+	for i := range redlock.Nodes {
+		if redlock.Nodes[i].Host == "" {
+			redlock.Nodes[i].Host = "127.0.0.1"
+		}
+		if redlock.Nodes[i].Port == "" {
+			redlock.Nodes[i].Port = "6379"
+		}
+	}
+	if redlock.Clock_Drift_Factor == 0 {
+		redlock.Clock_Drift_Factor = 0.01 // As suggested by the Redlock algorithm
+	}
+	if redlock.Retry_Count == 0 {
+		redlock.Retry_Count = 3
+	}
+	if redlock.Retry_Delay == 0 {
+		redlock.Retry_Delay = 200 * time.Millisecond
+	}
+	if redlock.Node_Timeout == 0 {
+		redlock.Node_Timeout = 50 * time.Millisecond
+	}
+}
+
+// validate rejects connection settings that do not apply to the connection mode
+func (c *CacheConnectionConfig) validate() error {
+	db := c.Cache.Usage_Cache_DB
+	if db.Auto_Pipelining_Mode != nil {
+		// It used to be mapped to DisableAutoPipelining, so true meant pool and
+		// false meant auto pipelining, only the operator knows which one is wanted
+		return fmt.Errorf("auto_pipelining_mode is no longer supported, set connection_mode to %s, %s or %s", ConnectionModeAutoPipeline, ConnectionModePool, ConnectionModeDedicated)
+	}
+
+	switch db.Connection_Mode {
+	case ConnectionModeAutoPipeline:
+		if db.Pipeline_Multiplex < 0 || db.Pipeline_Multiplex > rueidis.MaxPipelineMultiplex {
+			return fmt.Errorf("pipeline_multiplex must be between 0 and %d", rueidis.MaxPipelineMultiplex)
+		}
+		if db.Ring_Scale_Each_Conn < 0 {
+			return fmt.Errorf("ring_scale_each_conn must not be negative")
+		}
+		if db.Max_Flush_Delay < 0 {
+			return fmt.Errorf("max_flush_delay must not be negative")
+		}
+	case ConnectionModePool, ConnectionModeDedicated:
+		if db.Pipeline_Multiplex != 0 || db.Ring_Scale_Each_Conn != 0 || db.Max_Flush_Delay != 0 {
+			return fmt.Errorf("pipeline_multiplex, ring_scale_each_conn and max_flush_delay only apply to connection_mode %s", ConnectionModeAutoPipeline)
+		}
+	default:
+		return fmt.Errorf("unknown connection_mode %q, must be %s, %s or %s", db.Connection_Mode, ConnectionModeAutoPipeline, ConnectionModePool, ConnectionModeDedicated)
+	}
+
+	if db.Read_Buffer_Each_Conn < 0 || db.Write_Buffer_Each_Conn < 0 {
+		return fmt.Errorf("read_buffer_each_conn and write_buffer_each_conn must not be negative")
+	}
+
+	jitter := db.TTL_Jitter
+	if jitter.Percent < 0 || jitter.Percent > 100 {
+		return fmt.Errorf("ttl_jitter.percent must be between 0 and 100")
+	}
+	if jitter.Min < 0 || jitter.Max < jitter.Min {
+		return fmt.Errorf("ttl_jitter.min must not be negative, nor greater than ttl_jitter.max")
+	}
+
+	retry := db.Retry
+	if retry.Max_Attempts < 1 {
+		return fmt.Errorf("retry.max_attempts must be at least 1")
+	}
+	if retry.Base_Backoff < 0 || retry.Max_Backoff < retry.Base_Backoff {
+		return fmt.Errorf("retry.base_backoff must not be negative, nor greater than retry.max_backoff")
+	}
+	if retry.Jitter < 0 || retry.Jitter > 1 {
+		return fmt.Errorf("retry.jitter must be between 0 and 1")
+	}
+
+	breaker := db.Circuit_Breaker
+	if breaker.Window < 0 || breaker.Slow_Call_Duration < 0 || breaker.Open_Timeout < 0 || breaker.Min_Requests < 0 || breaker.Half_Open_Max_Requests < 0 {
+		return fmt.Errorf("circuit_breaker durations and request counts must not be negative")
+	}
+	if breaker.Window > 0 && breaker.Window < minBreakerWindow {
+		return fmt.Errorf("circuit_breaker.window must be at least %v", minBreakerWindow)
+	}
+	if breaker.Error_Rate_Threshold < 0 || breaker.Error_Rate_Threshold > 1 || breaker.Slow_Call_Rate_Threshold < 0 || breaker.Slow_Call_Rate_Threshold > 1 {
+		return fmt.Errorf("circuit_breaker.error_rate_threshold and circuit_breaker.slow_call_rate_threshold must be between 0 and 1")
+	}
+
+	fallback := db.Fallback
+	if fallback.Max_Entries < 0 || fallback.Failure_Threshold < 0 || fallback.Probe_Interval < 0 || fallback.Probe_Timeout < 0 {
+		return fmt.Errorf("fallback sizes and durations must not be negative")
+	}
+	switch fallback.On_Recovery {
+	case "", FallbackRecoveryFlush, FallbackRecoveryReplay:
+	default:
+		return fmt.Errorf("unknown fallback.on_recovery %q, must be %s or %s", fallback.On_Recovery, FallbackRecoveryFlush, FallbackRecoveryReplay)
+	}
+
+	lazy := db.Lazy_Connect
+	if lazy.Base_Backoff < 0 || lazy.Max_Backoff < lazy.Base_Backoff {
+		return fmt.Errorf("lazy_connect.base_backoff must not be negative, nor greater than lazy_connect.max_backoff")
+	}
+	return nil
+}
+
+// retryPolicy builds the retry policy of the client
+func (c *CacheConnectionConfig) retryPolicy() RetryPolicy {
+	retry := c.Cache.Usage_Cache_DB.Retry
+	return RetryPolicy{
+		MaxAttempts:        retry.Max_Attempts,
+		BaseBackoff:        retry.Base_Backoff,
+		MaxBackoff:         retry.Max_Backoff,
+		Jitter:             retry.Jitter,
+		RetryNonIdempotent: retry.Retry_Non_Idempotent,
+	}
+}
+
+// applyConnectionMode sets the connection options of the configured mode on option
+func (c *CacheConnectionConfig) applyConnectionMode(option *rueidis.ClientOption) {
+	db := c.Cache.Usage_Cache_DB
+	option.BlockingPoolCleanup = db.Pool_Max_Idle_Time
+	option.BlockingPoolMinSize = db.Pool_Min_Connections
+	option.BlockingPoolSize = db.Pool_Max_Connections
+	option.ReadBufferEachConn = db.Read_Buffer_Each_Conn
+	option.WriteBufferEachConn = db.Write_Buffer_Each_Conn
+
+	switch db.Connection_Mode {
+	case ConnectionModeAutoPipeline:
+		option.PipelineMultiplex = db.Pipeline_Multiplex
+		option.RingScaleEachConn = db.Ring_Scale_Each_Conn
+		option.MaxFlushDelay = db.Max_Flush_Delay
+	case ConnectionModePool:
+		option.DisableAutoPipelining = true
+	case ConnectionModeDedicated:
+		option.DisableAutoPipelining = true
+		option.BlockingPoolCleanup = 0
+	}
+}
+
+// circuitBreaker builds the circuit breaker of the client, or nil when it is not enabled
+func (c *CacheConnectionConfig) circuitBreaker() *CircuitBreaker {
+	breaker := c.Cache.Usage_Cache_DB.Circuit_Breaker
+	if !breaker.Enabled {
+		return nil
+	}
+	return NewCircuitBreaker(CircuitBreakerOptions{
+		Window:                breaker.Window,
+		MinRequests:           breaker.Min_Requests,
+		ErrorRateThreshold:    breaker.Error_Rate_Threshold,
+		SlowCallDuration:      breaker.Slow_Call_Duration,
+		SlowCallRateThreshold: breaker.Slow_Call_Rate_Threshold,
+		OpenTimeout:           breaker.Open_Timeout,
+		HalfOpenMaxRequests:   breaker.Half_Open_Max_Requests,
+	})
+}
+
+// fallbackStore builds the local store of the client, or nil when fallback is not enabled
+func (c *CacheConnectionConfig) fallbackStore() *fallbackStore {
+	fallback := c.Cache.Usage_Cache_DB.Fallback
+	if !fallback.Enabled {
+		return nil
+	}
+	return newFallbackStore(FallbackOptions{
+		MaxEntries:       fallback.Max_Entries,
+		FailureThreshold: fallback.Failure_Threshold,
+		ProbeInterval:    fallback.Probe_Interval,
+		ProbeTimeout:     fallback.Probe_Timeout,
+		OnRecovery:       fallback.On_Recovery,
+	})
+}
+
+// lazyConnectOptions builds the reconnect backoff of a lazy client
+func (c *CacheConnectionConfig) lazyConnectOptions() LazyConnectOptions {
+	lazy := c.Cache.Usage_Cache_DB.Lazy_Connect
+	return LazyConnectOptions{
+		BaseBackoff: lazy.Base_Backoff,
+		MaxBackoff:  lazy.Max_Backoff,
+	}
+}
+
+// namespace returns the namespace prefixed to every key
+func (c *CacheConnectionConfig) namespace() Namespace {
+	return Namespace{
+		Name:    c.Cache.Usage_Cache_DB.Namespace,
+		Version: c.Cache.Usage_Cache_DB.Namespace_Version,
+	}
+}
+
+// jitterPolicy builds the global TTL jitter policy, or nil when none is configured
+func (c *CacheConnectionConfig) jitterPolicy() *JitterPolicy {
+	jitter := c.Cache.Usage_Cache_DB.TTL_Jitter
+	if jitter.Percent <= 0 && jitter.Min == 0 && jitter.Max == 0 {
+		return nil
+	}
+	policy := &JitterPolicy{Percent: jitter.Percent, Min: jitter.Min, Max: jitter.Max}
+	if jitter.Seed != 0 {
+		policy.WithSeed(jitter.Seed)
+	}
+	return policy
 }
 
 func LoadCacheConfigFromFile(yaml_config_file_path string) (*CacheConnectionConfig, error) {
@@ -54,6 +344,9 @@ func LoadCacheConfigFromFile(yaml_config_file_path string) (*CacheConnectionConf
 	}
 
 	cache_pool_config.setDefaults()
+	if err = cache_pool_config.validate(); err != nil {
+		return nil, err
+	}
 
 	return &cache_pool_config, nil
 }
@@ -5,6 +5,8 @@ import (
 	"path/filepath"
 	"testing"
 	"time"
+
+	"github.com/redis/rueidis"
 )
 
 func TestLoadCacheConfigFromFile(t *testing.T) {
@@ -26,9 +28,10 @@ cache:
     database: 0
     pool_max_connections: 10
     pool_min_connections: 2
-    auto_pipelining_mode: true
+    connection_mode: pool
     disable_cache: false
     pool_max_idle_time: 5400s
+    read_buffer_each_conn: 65536
 `,
 			wantErr: false,
 			validate: func(cfg *CacheConnectionConfig) error {
@@ -50,8 +53,11 @@ cache:
 				if cfg.Cache.Usage_Cache_DB.Pool_Min_Connections != 2 {
 					t.Errorf("expected pool_min_connections to be 2, got %d", cfg.Cache.Usage_Cache_DB.Pool_Min_Connections)
 				}
-				if !cfg.Cache.Usage_Cache_DB.Auto_Pipelining_Mode {
-					t.Error("expected auto_pipelining_mode to be true")
+				if cfg.Cache.Usage_Cache_DB.Connection_Mode != ConnectionModePool {
+					t.Errorf("expected connection_mode to be pool, got %s", cfg.Cache.Usage_Cache_DB.Connection_Mode)
+				}
+				if cfg.Cache.Usage_Cache_DB.Read_Buffer_Each_Conn != 65536 {
+					t.Errorf("expected read_buffer_each_conn to be 65536, got %d", cfg.Cache.Usage_Cache_DB.Read_Buffer_Each_Conn)
 				}
 				if cfg.Cache.Usage_Cache_DB.DisableClientSideCache {
 					t.Error("expected disable_cache to be false")
@@ -78,8 +84,8 @@ cache:
 				if cfg.Cache.Usage_Cache_DB.Port != "6379" {
 					t.Errorf("expected default port to be '6379', got %s", cfg.Cache.Usage_Cache_DB.Port)
 				}
-				if cfg.Cache.Usage_Cache_DB.Auto_Pipelining_Mode {
-					t.Error("expected default auto_pipelining_mode to be false")
+				if cfg.Cache.Usage_Cache_DB.Connection_Mode != ConnectionModeAutoPipeline {
+					t.Errorf("expected default connection_mode to be auto_pipeline, got %s", cfg.Cache.Usage_Cache_DB.Connection_Mode)
 				}
 				if !cfg.Cache.Usage_Cache_DB.DisableClientSideCache {
 					t.Error("expected default disable_cache to be true")
@@ -90,6 +96,371 @@ cache:
 				return nil
 			},
 		},
+		{
+			name: "ttl jitter configuration",
+			yamlContent: `
+cache:
+  usage_cache_db:
+    host: "test-host"
+    ttl_jitter:
+      percent: 10
+      min: 1s
+      max: 5s
+      seed: 7
+`,
+			wantErr: false,
+			validate: func(cfg *CacheConnectionConfig) error {
+				jitter := cfg.Cache.Usage_Cache_DB.TTL_Jitter
+				if jitter.Percent != 10 {
+					t.Errorf("expected ttl_jitter.percent to be 10, got %v", jitter.Percent)
+				}
+				if jitter.Min != time.Second || jitter.Max != 5*time.Second {
+					t.Errorf("expected ttl_jitter range to be 1s-5s, got %v-%v", jitter.Min, jitter.Max)
+				}
+				if jitter.Seed != 7 {
+					t.Errorf("expected ttl_jitter.seed to be 7, got %d", jitter.Seed)
+				}
+				if cfg.jitterPolicy() == nil {
+					t.Error("expected a jitter policy to be built from the config")
+				}
+				return nil
+			},
+		},
+		{
+			name: "redlock nodes with defaults",
+			yamlContent: `
+cache:
+  usage_cache_db:
+    redlock:
+      nodes:
+        - host: "node-1"
+        - host: "node-2"
+          port: "6380"
+`,
+			wantErr: false,
+			validate: func(cfg *CacheConnectionConfig) error {
+				redlock := cfg.Cache.Usage_Cache_DB.Redlock
+				if len(redlock.Nodes) != 2 {
+					t.Fatalf("expected 2 redlock nodes, got %d", len(redlock.Nodes))
+				}
+				if redlock.Nodes[0].Port != "6379" || redlock.Nodes[1].Port != "6380" {
+					t.Errorf("expected node ports 6379 and 6380, got %s and %s", redlock.Nodes[0].Port, redlock.Nodes[1].Port)
+				}
+				if redlock.Clock_Drift_Factor != 0.01 {
+					t.Errorf("expected default clock_drift_factor to be 0.01, got %v", redlock.Clock_Drift_Factor)
+				}
+				if redlock.Retry_Count != 3 || redlock.Retry_Delay != 200*time.Millisecond {
+					t.Errorf("expected default retries to be 3 x 200ms, got %d x %v", redlock.Retry_Count, redlock.Retry_Delay)
+				}
+				return nil
+			},
+		},
+		{
+			name: "auto pipeline tuning",
+			yamlContent: `
+cache:
+  usage_cache_db:
+    connection_mode: auto_pipeline
+    pipeline_multiplex: 3
+    ring_scale_each_conn: 12
+    max_flush_delay: 20us
+    write_buffer_each_conn: 131072
+`,
+			wantErr: false,
+			validate: func(cfg *CacheConnectionConfig) error {
+				db := cfg.Cache.Usage_Cache_DB
+				if db.Pipeline_Multiplex != 3 || db.Ring_Scale_Each_Conn != 12 || db.Max_Flush_Delay != 20*time.Microsecond || db.Write_Buffer_Each_Conn != 131072 {
+					t.Errorf("expected the auto pipeline tuning to be loaded, got %+v", db)
+				}
+				return nil
+			},
+		},
+		{
+			name: "unknown connection mode",
+			yamlContent: `
+cache:
+  usage_cache_db:
+    connection_mode: pipelined
+`,
+			wantErr: true,
+			validate: func(cfg *CacheConnectionConfig) error {
+				return nil
+			},
+		},
+		{
+			name: "pipeline tuning outside auto pipeline mode",
+			yamlContent: `
+cache:
+  usage_cache_db:
+    connection_mode: dedicated
+    pipeline_multiplex: 2
+`,
+			wantErr: true,
+			validate: func(cfg *CacheConnectionConfig) error {
+				return nil
+			},
+		},
+		{
+			name: "pipeline multiplex above the maximum",
+			yamlContent: `
+cache:
+  usage_cache_db:
+    pipeline_multiplex: 9
+`,
+			wantErr: true,
+			validate: func(cfg *CacheConnectionConfig) error {
+				return nil
+			},
+		},
+		{
+			name: "retry policy",
+			yamlContent: `
+cache:
+  usage_cache_db:
+    retry:
+      max_attempts: 5
+      base_backoff: 50ms
+      retry_non_idempotent: true
+`,
+			wantErr: false,
+			validate: func(cfg *CacheConnectionConfig) error {
+				policy := cfg.retryPolicy()
+				if policy.MaxAttempts != 5 || policy.BaseBackoff != 50*time.Millisecond || !policy.RetryNonIdempotent {
+					t.Errorf("expected the retry policy to be loaded, got %+v", policy)
+				}
+				if policy.MaxBackoff != time.Second || policy.Jitter != 0.5 {
+					t.Errorf("expected the default max_backoff and jitter, got %v and %v", policy.MaxBackoff, policy.Jitter)
+				}
+				return nil
+			},
+		},
+		{
+			name: "retries disabled by default",
+			yamlContent: `
+cache:
+  usage_cache_db:
+    host: localhost
+`,
+			wantErr: false,
+			validate: func(cfg *CacheConnectionConfig) error {
+				if policy := cfg.retryPolicy(); policy.MaxAttempts != 1 {
+					t.Errorf("expected a single attempt by default, got %d", policy.MaxAttempts)
+				}
+				return nil
+			},
+		},
+		{
+			name: "ttl jitter percent above 100",
+			yamlContent: `
+cache:
+  usage_cache_db:
+    ttl_jitter:
+      percent: 150
+`,
+			wantErr: true,
+			validate: func(cfg *CacheConnectionConfig) error {
+				return nil
+			},
+		},
+		{
+			name: "negative ttl jitter percent",
+			yamlContent: `
+cache:
+  usage_cache_db:
+    ttl_jitter:
+      percent: -5
+`,
+			wantErr: true,
+			validate: func(cfg *CacheConnectionConfig) error {
+				return nil
+			},
+		},
+		{
+			name: "ttl jitter min above the max",
+			yamlContent: `
+cache:
+  usage_cache_db:
+    ttl_jitter:
+      min: 5s
+      max: 1s
+`,
+			wantErr: true,
+			validate: func(cfg *CacheConnectionConfig) error {
+				return nil
+			},
+		},
+		{
+			name: "negative ttl jitter min",
+			yamlContent: `
+cache:
+  usage_cache_db:
+    ttl_jitter:
+      min: -1s
+      max: 1s
+`,
+			wantErr: true,
+			validate: func(cfg *CacheConnectionConfig) error {
+				return nil
+			},
+		},
+		{
+			name: "retry jitter above 1",
+			yamlContent: `
+cache:
+  usage_cache_db:
+    retry:
+      jitter: 1.5
+`,
+			wantErr: true,
+			validate: func(cfg *CacheConnectionConfig) error {
+				return nil
+			},
+		},
+		{
+			name: "retry base backoff above the max backoff",
+			yamlContent: `
+cache:
+  usage_cache_db:
+    retry:
+      base_backoff: 2s
+      max_backoff: 1s
+`,
+			wantErr: true,
+			validate: func(cfg *CacheConnectionConfig) error {
+				return nil
+			},
+		},
+		{
+			name: "circuit breaker",
+			yamlContent: `
+cache:
+  usage_cache_db:
+    circuit_breaker:
+      enabled: true
+      error_rate_threshold: 0.25
+      open_timeout: 30s
+`,
+			wantErr: false,
+			validate: func(cfg *CacheConnectionConfig) error {
+				breaker := cfg.circuitBreaker()
+				if breaker == nil {
+					t.Fatal("expected a circuit breaker")
+				}
+				if breaker.opts.ErrorRateThreshold != 0.25 || breaker.opts.OpenTimeout != 30*time.Second || breaker.opts.MinRequests != 20 {
+					t.Errorf("expected the circuit breaker options to be loaded with defaults, got %+v", breaker.opts)
+				}
+				return nil
+			},
+		},
+		{
+			name: "circuit breaker error rate above 1",
+			yamlContent: `
+cache:
+  usage_cache_db:
+    circuit_breaker:
+      enabled: true
+      error_rate_threshold: 50
+`,
+			wantErr: true,
+			validate: func(cfg *CacheConnectionConfig) error {
+				return nil
+			},
+		},
+		{
+			name: "circuit breaker window below 10ms",
+			yamlContent: `
+cache:
+  usage_cache_db:
+    circuit_breaker:
+      enabled: true
+      window: 5ns
+`,
+			wantErr: true,
+			validate: func(cfg *CacheConnectionConfig) error {
+				return nil
+			},
+		},
+		{
+			name: "fallback",
+			yamlContent: `
+cache:
+  usage_cache_db:
+    fallback:
+      enabled: true
+      max_entries: 500
+      on_recovery: replay
+`,
+			wantErr: false,
+			validate: func(cfg *CacheConnectionConfig) error {
+				store := cfg.fallbackStore()
+				if store == nil {
+					t.Fatal("expected a fallback store")
+				}
+				if store.opts.MaxEntries != 500 || store.opts.OnRecovery != FallbackRecoveryReplay || store.opts.FailureThreshold != 3 {
+					t.Errorf("expected the fallback options to be loaded with defaults, got %+v", store.opts)
+				}
+				return nil
+			},
+		},
+		{
+			name: "unknown fallback recovery mode",
+			yamlContent: `
+cache:
+  usage_cache_db:
+    fallback:
+      enabled: true
+      on_recovery: merge
+`,
+			wantErr: true,
+			validate: func(cfg *CacheConnectionConfig) error {
+				return nil
+			},
+		},
+		{
+			name: "lazy connect with defaults",
+			yamlContent: `
+cache:
+  usage_cache_db:
+    lazy_connect:
+      enabled: true
+      base_backoff: 1s
+`,
+			wantErr: false,
+			validate: func(cfg *CacheConnectionConfig) error {
+				opts := cfg.lazyConnectOptions()
+				if !cfg.Cache.Usage_Cache_DB.Lazy_Connect.Enabled || opts.BaseBackoff != time.Second || opts.MaxBackoff != 30*time.Second {
+					t.Errorf("expected lazy_connect to be loaded with defaults, got %+v", opts)
+				}
+				return nil
+			},
+		},
+		{
+			name: "lazy connect base backoff above the max backoff",
+			yamlContent: `
+cache:
+  usage_cache_db:
+    lazy_connect:
+      enabled: true
+      base_backoff: 1m
+      max_backoff: 1s
+`,
+			wantErr: true,
+			validate: func(cfg *CacheConnectionConfig) error {
+				return nil
+			},
+		},
+		{
+			name: "removed auto_pipelining_mode",
+			yamlContent: `
+cache:
+  usage_cache_db:
+    auto_pipelining_mode: true
+`,
+			wantErr: true,
+			validate: func(cfg *CacheConnectionConfig) error {
+				return nil
+			},
+		},
 		{
 			name: "invalid yaml",
 			yamlContent: `
@@ -133,6 +504,52 @@ invalid:
 	}
 }
 
+func TestApplyConnectionMode(t *testing.T) {
+	tests := []struct {
+		mode              string
+		wantAutoPipeline  bool
+		wantPoolCleanup   time.Duration
+		wantFlushDelay    time.Duration
+		wantPipelineMplex int
+	}{
+		{mode: ConnectionModeAutoPipeline, wantAutoPipeline: true, wantPoolCleanup: time.Hour, wantFlushDelay: 20 * time.Microsecond, wantPipelineMplex: 3},
+		{mode: ConnectionModePool, wantAutoPipeline: false, wantPoolCleanup: time.Hour},
+		{mode: ConnectionModeDedicated, wantAutoPipeline: false, wantPoolCleanup: 0},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.mode, func(t *testing.T) {
+			var cfg CacheConnectionConfig
+			cfg.Cache.Usage_Cache_DB.Connection_Mode = tt.mode
+			cfg.Cache.Usage_Cache_DB.Pool_Max_Connections = 8
+			if tt.mode == ConnectionModeAutoPipeline {
+				cfg.Cache.Usage_Cache_DB.Pipeline_Multiplex = 3
+				cfg.Cache.Usage_Cache_DB.Max_Flush_Delay = 20 * time.Microsecond
+			}
+			cfg.setDefaults()
+			if err := cfg.validate(); err != nil {
+				t.Fatalf("validate() error = %v", err)
+			}
+
+			var option rueidis.ClientOption
+			cfg.applyConnectionMode(&option)
+			// The mapping used to be inverted, auto pipelining must not disable it
+			if option.DisableAutoPipelining == tt.wantAutoPipeline {
+				t.Errorf("DisableAutoPipelining = %v, want %v", option.DisableAutoPipelining, !tt.wantAutoPipeline)
+			}
+			if option.BlockingPoolCleanup != tt.wantPoolCleanup {
+				t.Errorf("BlockingPoolCleanup = %v, want %v", option.BlockingPoolCleanup, tt.wantPoolCleanup)
+			}
+			if option.BlockingPoolSize != 8 {
+				t.Errorf("BlockingPoolSize = %d, want 8", option.BlockingPoolSize)
+			}
+			if option.MaxFlushDelay != tt.wantFlushDelay || option.PipelineMultiplex != tt.wantPipelineMplex {
+				t.Errorf("MaxFlushDelay, PipelineMultiplex = %v, %d, want %v, %d", option.MaxFlushDelay, option.PipelineMultiplex, tt.wantFlushDelay, tt.wantPipelineMplex)
+			}
+		})
+	}
+}
+
 func TestLoadCacheConfigFromNonExistentFile(t *testing.T) {
 	_, err := LoadCacheConfigFromFile("non_existent_file.yaml")
 	if err == nil {
@@ -0,0 +1,237 @@
+package redis_cache
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"github.com/redis/rueidis"
+)
+
+// This file contains the expiry conventions shared by every setter :
+// 1. Relative TTLs expressed as time.Duration (EX / PX)
+// 2. Absolute deadlines expressed as time.Time (EXAT / PXAT)
+// 3. KEEPTTL so an overwrite keeps the key's existing TTL
+// 4. Per call override of the client's TTL jitter policy
+
+// Expiry describes how long a value written to the cache should live.
+// The zero value means the key is written without any expiry.
+type Expiry struct {
+	ttl      time.Duration
+	deadline time.Time
+	keepTTL  bool
+
+	// jitter overrides the client's jitter policy when jitterSet is true
+	jitter    *JitterPolicy
+	jitterSet bool
+
+	// tags index the written key for InvalidateTags
+	tags []string
+}
+
+// NoExpiry writes the key without an expiry time.
+func NoExpiry() Expiry {
+	return Expiry{}
+}
+
+// ExpireIn expires the key after the given duration. Durations with
+// sub-second precision are sent as PX, whole seconds as EX.
+// A zero duration is the same as NoExpiry.
+func ExpireIn(ttl time.Duration) Expiry {
+	return Expiry{ttl: ttl}
+}
+
+// ExpireAt expires the key at the given point in time. Deadlines with
+// sub-second precision are sent as PXAT, whole seconds as EXAT.
+func ExpireAt(deadline time.Time) Expiry {
+	return Expiry{deadline: deadline}
+}
+
+// KeepTTL keeps whatever TTL the key already has when it is overwritten.
+func KeepTTL() Expiry {
+	return Expiry{keepTTL: true}
+}
+
+// WithJitter applies the given jitter policy to this call instead of the
+// one configured on the client.
+func (e Expiry) WithJitter(policy *JitterPolicy) Expiry {
+	e.jitter = policy
+	e.jitterSet = true
+	return e
+}
+
+// WithoutJitter writes the exact TTL, even if the client has a jitter policy.
+func (e Expiry) WithoutJitter() Expiry {
+	return e.WithJitter(nil)
+}
+
+// WithTags indexes the written key under each tag, so InvalidateTags can
+// delete it together with every other key sharing the tag.
+func (e Expiry) WithTags(tags ...string) Expiry {
+	e.tags = append(append([]string(nil), e.tags...), tags...)
+	return e
+}
+
+// resolve applies the jitter policy to relative TTLs. Absolute deadlines
+// and KEEPTTL are honoured exactly. A resolved expiry is not jittered again,
+// so the key and its tag indexes get the same TTL.
+func (e Expiry) resolve(client rueidis.Client) Expiry {
+	policy := optionsOf(client).jitter
+	if e.jitterSet {
+		policy = e.jitter
+	}
+	e.ttl = policy.Apply(e.ttl)
+	e.jitter, e.jitterSet = nil, true
+	return e
+}
+
+// expiryFromSeconds maps the legacy int64 seconds argument onto an Expiry.
+func expiryFromSeconds(expiry int64) (Expiry, error) {
+	if expiry < 0 {
+		return Expiry{}, fmt.Errorf("expiry time must be greater than 0")
+	}
+	return ExpireIn(time.Duration(expiry) * time.Second), nil
+}
+
+func (e Expiry) validate() error {
+	if e.ttl < 0 {
+		return fmt.Errorf("expiry time must be greater than 0")
+	}
+	set := 0
+	if e.ttl > 0 {
+		set++
+	}
+	if !e.deadline.IsZero() {
+		set++
+	}
+	if e.keepTTL {
+		set++
+	}
+	if set > 1 {
+		return fmt.Errorf("only one of ttl, deadline or keepttl can be set")
+	}
+	return nil
+}
+
+// durationToMilliseconds rounds partial milliseconds up, so a key never lives
+// shorter than asked for and a positive TTL never becomes PX 0.
+func durationToMilliseconds(d time.Duration) int64 {
+	ms := int64(d / time.Millisecond)
+	if d%time.Millisecond != 0 {
+		ms++
+	}
+	return ms
+}
+
+// secondsOrMilliseconds reports the TTL in whole seconds when it has no
+// sub-second part, otherwise in milliseconds.
+func secondsOrMilliseconds(ttl time.Duration) (value int64, inSeconds bool) {
+	if ttl%time.Second == 0 {
+		return int64(ttl / time.Second), true
+	}
+	return durationToMilliseconds(ttl), false
+}
+
+// unixSecondsOrMilliseconds reports the deadline as a unix timestamp in whole
+// seconds when it has no sub-second part, otherwise in milliseconds.
+func unixSecondsOrMilliseconds(deadline time.Time) (value int64, inSeconds bool) {
+	if deadline.UnixNano()%int64(time.Second) == 0 {
+		return deadline.Unix(), true
+	}
+	return deadline.UnixMilli(), false
+}
+
+// buildSetCommand builds the SET command for key/value honouring the expiry.
+func buildSetCommand(client rueidis.Client, key string, value string, expiry Expiry) (rueidis.Completed, error) {
+	if err := expiry.validate(); err != nil {
+		return rueidis.Completed{}, err
+	}
+	expiry = expiry.resolve(client)
+
+	set := client.B().Set().Key(key).Value(value)
+	switch {
+	case expiry.keepTTL:
+		return set.Keepttl().Build(), nil
+	case !expiry.deadline.IsZero():
+		at, inSeconds := unixSecondsOrMilliseconds(expiry.deadline)
+		if inSeconds {
+			return set.ExatTimestamp(at).Build(), nil
+		}
+		return set.PxatMillisecondsTimestamp(at).Build(), nil
+	case expiry.ttl > 0:
+		ttl, inSeconds := secondsOrMilliseconds(expiry.ttl)
+		if inSeconds {
+			return set.ExSeconds(ttl).Build(), nil
+		}
+		return set.PxMilliseconds(ttl).Build(), nil
+	default:
+		return set.Build(), nil
+	}
+}
+
+// buildKeyExpiryCommand builds the command that applies expiry to an existing
+// key, for types such as hashes whose writes can not carry a TTL themselves.
+// It returns false for KEEPTTL, where the key's TTL must not be touched.
+// NoExpiry maps to PERSIST, matching SET which clears the TTL on overwrite.
+func buildKeyExpiryCommand(client rueidis.Client, key string, expiry Expiry) (rueidis.Completed, bool, error) {
+	if err := expiry.validate(); err != nil {
+		return rueidis.Completed{}, false, err
+	}
+	expiry = expiry.resolve(client)
+
+	switch {
+	case expiry.keepTTL:
+		return rueidis.Completed{}, false, nil
+	case !expiry.deadline.IsZero():
+		at, inSeconds := unixSecondsOrMilliseconds(expiry.deadline)
+		if inSeconds {
+			return client.B().Expireat().Key(key).Timestamp(at).Build(), true, nil
+		}
+		return client.B().Pexpireat().Key(key).MillisecondsTimestamp(at).Build(), true, nil
+	case expiry.ttl > 0:
+		ttl, inSeconds := secondsOrMilliseconds(expiry.ttl)
+		if inSeconds {
+			return client.B().Expire().Key(key).Seconds(ttl).Build(), true, nil
+		}
+		return client.B().Pexpire().Key(key).Milliseconds(ttl).Build(), true, nil
+	default:
+		return client.B().Persist().Key(key).Build(), true, nil
+	}
+}
+
+// doWithKeyExpiry runs write and applies expiry to key in a single MULTI/EXEC
+// round trip, so the key is never left without its TTL.
+func doWithKeyExpiry(ctx context.Context, client rueidis.Client, key string, write rueidis.Completed, expiry Expiry) error {
+	if err := expiry.validate(); err != nil {
+		return err
+	}
+	expiry = expiry.resolve(client)
+	if err := addToTags(ctx, client, key, expiry); err != nil {
+		return err
+	}
+
+	expire, ok, err := buildKeyExpiryCommand(client, key, expiry)
+	if err != nil {
+		return err
+	}
+	if !ok {
+		return client.Do(ctx, write).Error()
+	}
+
+	resps := client.DoMulti(ctx, client.B().Multi().Build(), write, expire, client.B().Exec().Build())
+	for _, resp := range resps[:len(resps)-1] {
+		if err := resp.Error(); err != nil {
+			return err
+		}
+	}
+	results, err := resps[len(resps)-1].ToArray()
+	if err != nil {
+		return err
+	}
+	for _, result := range results {
+		if err := result.Error(); err != nil {
+			return err
+		}
+	}
+	return nil
+}
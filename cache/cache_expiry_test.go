@@ -0,0 +1,115 @@
+package redis_cache
+
+import (
+	"context"
+	"testing"
+	"time"
+)
+
+func TestSetStringDataToCacheWithExpiry(t *testing.T) {
+	client := setupTestClient(t)
+	defer Close(client)
+
+	ctx := context.Background()
+	tests := []struct {
+		name        string
+		key         string
+		expiry      Expiry
+		minPTTL     time.Duration
+		maxPTTL     time.Duration
+		wantErr     bool
+		errContains string
+	}{
+		{
+			name:    "no expiry",
+			key:     "expiry-key-1",
+			expiry:  NoExpiry(),
+			minPTTL: -1 * time.Millisecond,
+			maxPTTL: -1 * time.Millisecond,
+		},
+		{
+			name:    "whole seconds",
+			key:     "expiry-key-2",
+			expiry:  ExpireIn(30 * time.Second),
+			minPTTL: 29 * time.Second,
+			maxPTTL: 30 * time.Second,
+		},
+		{
+			name:    "sub-second precision",
+			key:     "expiry-key-3",
+			expiry:  ExpireIn(1500 * time.Millisecond),
+			minPTTL: 1 * time.Second,
+			maxPTTL: 1500 * time.Millisecond,
+		},
+		{
+			name:    "absolute deadline",
+			key:     "expiry-key-4",
+			expiry:  ExpireAt(time.Now().Add(45 * time.Second)),
+			minPTTL: 40 * time.Second,
+			maxPTTL: 45 * time.Second,
+		},
+		{
+			name:        "negative ttl",
+			key:         "expiry-key-5",
+			expiry:      ExpireIn(-time.Second),
+			wantErr:     true,
+			errContains: "expiry time must be greater than 0",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := SetStringDataToCacheWithExpiry(ctx, client, tt.key, "value", tt.expiry)
+			if (err != nil) != tt.wantErr {
+				t.Errorf("SetStringDataToCacheWithExpiry() error = %v, wantErr %v", err, tt.wantErr)
+				return
+			}
+			if err != nil {
+				if tt.errContains != "" && !contains(err.Error(), tt.errContains) {
+					t.Errorf("Expected error containing %q, got %q", tt.errContains, err.Error())
+				}
+				return
+			}
+
+			pttl, err := client.Do(ctx, client.B().Pttl().Key(tt.key).Build()).AsInt64()
+			if err != nil {
+				t.Fatalf("PTTL error = %v", err)
+			}
+			got := time.Duration(pttl) * time.Millisecond
+			if got < tt.minPTTL || got > tt.maxPTTL {
+				t.Errorf("PTTL = %v, want between %v and %v", got, tt.minPTTL, tt.maxPTTL)
+			}
+		})
+	}
+}
+
+func TestSetStringDataToCacheKeepTTL(t *testing.T) {
+	client := setupTestClient(t)
+	defer Close(client)
+
+	ctx := context.Background()
+	key := "expiry-keepttl"
+
+	if err := SetStringDataToCacheWithExpiry(ctx, client, key, "first", ExpireIn(time.Minute)); err != nil {
+		t.Fatalf("SetStringDataToCacheWithExpiry() error = %v", err)
+	}
+	if err := SetStringDataToCacheWithExpiry(ctx, client, key, "second", KeepTTL()); err != nil {
+		t.Fatalf("SetStringDataToCacheWithExpiry() with KeepTTL error = %v", err)
+	}
+
+	got, err := GetStringDataFromCache(ctx, client, key)
+	if err != nil {
+		t.Fatalf("GetStringDataFromCache() error = %v", err)
+	}
+	if got != "second" {
+		t.Errorf("GetStringDataFromCache() = %v, want %v", got, "second")
+	}
+
+	ttl, err := client.Do(ctx, client.B().Ttl().Key(key).Build()).AsInt64()
+	if err != nil {
+		t.Fatalf("TTL error = %v", err)
+	}
+	if ttl <= 0 {
+		t.Errorf("Expected KEEPTTL to preserve the existing TTL, got %d", ttl)
+	}
+}
@@ -0,0 +1,441 @@
+package redis_cache
+
+import (
+	"container/list"
+	"context"
+	"errors"
+	"log"
+	"sync"
+	"time"
+
+	"github.com/redis/rueidis"
+)
+
+// This file contains the fail-open fallback mode, a bounded in-memory store used while Redis is down :
+// 1. A get, set or delete failing with a connection error, a timeout, a transient error,
+//    ErrCircuitOpen or ErrNotReady counts as a failure, and still returns its error
+// 2. After failure_threshold consecutive failures the client runs degraded: the failing call
+//    and the next ones are served by the local store without trying Redis, and a background
+//    probe PINGs Redis every probe_interval
+// 3. Once Redis answers the client switches back, replaying the writes made locally (replay)
+//    or dropping them (flush)
+// 4. GetFallbackStats reports how often and how long the client ran degraded
+//
+// Only the string and int get / set functions and DeleteDataFromCache fall back,
+// tags are not indexed locally. The store is per process, instances do not see
+// each other's writes while degraded, so only enable it for data that can be recomputed.
+// rueidis retries reads on connection errors until their context is done, so
+// gets only fall back when their context has a deadline.
+
+// Recovery modes, see on_recovery.
+const (
+	// FallbackRecoveryFlush drops the local store when Redis is back.
+	FallbackRecoveryFlush = "flush"
+	// FallbackRecoveryReplay writes the values set and deleted locally to Redis when it is back.
+	FallbackRecoveryReplay = "replay"
+)
+
+// FallbackOptions configures the fallback mode, set with the fallback section of the config.
+type FallbackOptions struct {
+	// MaxEntries bounds the local store, the least recently used entry is evicted first. 10000 by default.
+	MaxEntries int
+	// FailureThreshold is the number of consecutive failures before the client runs degraded. 3 by default.
+	FailureThreshold int
+	// ProbeInterval is how often Redis is probed while degraded. 1s by default.
+	ProbeInterval time.Duration
+	// ProbeTimeout bounds each probe and the replay. ProbeInterval by default.
+	ProbeTimeout time.Duration
+	// OnRecovery is FallbackRecoveryFlush (default) or FallbackRecoveryReplay.
+	OnRecovery string
+
+	// Now is the clock, time.Now by default.
+	Now func() time.Time
+}
+
+func (o *FallbackOptions) setDefaults() {
+	if o.MaxEntries <= 0 {
+		o.MaxEntries = 10000
+	}
+	if o.FailureThreshold <= 0 {
+		o.FailureThreshold = 3
+	}
+	if o.ProbeInterval <= 0 {
+		o.ProbeInterval = time.Second
+	}
+	if o.ProbeTimeout <= 0 {
+		o.ProbeTimeout = o.ProbeInterval
+	}
+	if o.OnRecovery == "" {
+		o.OnRecovery = FallbackRecoveryFlush
+	}
+	if o.Now == nil {
+		o.Now = time.Now
+	}
+}
+
+// FallbackStats describes the fallback mode of a client since it was created.
+type FallbackStats struct {
+	// Degraded tells whether the client currently runs degraded, since DegradedSince.
+	Degraded      bool
+	DegradedSince time.Time
+	// DegradedFor is the total time spent degraded, the current period included.
+	DegradedFor time.Duration
+	// Periods is the number of times the client switched to degraded.
+	Periods uint64
+	// LocalHits and LocalMisses count the reads served by the local store, LocalWrites its sets and deletes.
+	LocalHits   uint64
+	LocalMisses uint64
+	LocalWrites uint64
+	// Replayed and ReplayFailures count the local writes replayed to Redis on recovery.
+	Replayed       uint64
+	ReplayFailures uint64
+	// LostWrites counts the local writes evicted from a full store before
+	// they were replayed, with on_recovery replay. Redis never receives them.
+	LostWrites uint64
+	// Entries is the number of entries in the local store.
+	Entries int
+}
+
+// fallbackEntry is a value, or a deletion, stored locally under its namespaced key.
+type fallbackEntry struct {
+	key       string
+	value     string
+	deleted   bool
+	expiresAt time.Time
+	// keepTTL is set when a KEEPTTL write hit a key the store did not know,
+	// so Redis still holds its TTL, it is replayed with SET KEEPTTL
+	keepTTL bool
+	// dirty entries were written locally and not replayed yet
+	dirty bool
+}
+
+// fallbackStore is the local store of a client and the state of its fallback mode.
+type fallbackStore struct {
+	opts FallbackOptions
+
+	mu       sync.Mutex
+	entries  map[string]*list.Element
+	lru      *list.List
+	failures int
+	degraded bool
+	since    time.Time
+	total    time.Duration
+	stats    FallbackStats
+	// lossLogged is set once a lost write was logged in the current degraded period
+	lossLogged bool
+	closed     bool
+	stop       chan struct{}
+	probes     sync.WaitGroup
+}
+
+// newFallbackStore returns the local store of a client.
+func newFallbackStore(opts FallbackOptions) *fallbackStore {
+	opts.setDefaults()
+	return &fallbackStore{
+		opts:    opts,
+		entries: make(map[string]*list.Element),
+		lru:     list.New(),
+		stop:    make(chan struct{}),
+	}
+}
+
+// GetFallbackStats returns the fallback statistics of client, zero when fallback is not enabled.
+func GetFallbackStats(client rueidis.Client) FallbackStats {
+	f := optionsOf(client).fallback
+	if f == nil {
+		return FallbackStats{}
+	}
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	stats := f.stats
+	stats.Degraded = f.degraded
+	stats.DegradedFor = f.total
+	if f.degraded {
+		stats.DegradedSince = f.since
+		stats.DegradedFor += f.opts.Now().Sub(f.since)
+	}
+	stats.Entries = f.lru.Len()
+	return stats
+}
+
+// active reports whether calls must use the local store without trying Redis.
+func (f *fallbackStore) active() bool {
+	if f == nil {
+		return false
+	}
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	return f.degraded && !f.closed
+}
+
+// fallBack counts a call that failed with err, and reports whether it is
+// served by the local store: only once the client runs degraded, past the
+// threshold, below it the call returns its error.
+func (f *fallbackStore) fallBack(client rueidis.Client, err error) bool {
+	if f == nil || !(isBreakerFailure(err) || errors.Is(err, ErrCircuitOpen) || errors.Is(err, ErrNotReady)) {
+		return false
+	}
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	// A closed client reports its own errors
+	if f.closed {
+		return false
+	}
+	f.failures++
+	if !f.degraded && f.failures >= f.opts.FailureThreshold {
+		f.degraded = true
+		f.since = f.opts.Now()
+		f.stats.Periods++
+		f.lossLogged = false
+		log.Printf("redis_cache: running degraded on the local store after: %v", err)
+		f.probes.Add(1)
+		go f.probe(client)
+	}
+	return f.degraded
+}
+
+// succeeded resets the consecutive failures after a call reached Redis.
+func (f *fallbackStore) succeeded() {
+	if f == nil {
+		return
+	}
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	f.failures = 0
+}
+
+// get returns the local value of key.
+func (f *fallbackStore) get(key string) (string, bool) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	element, ok := f.entries[key]
+	if ok {
+		entry := element.Value.(*fallbackEntry)
+		if !entry.expiresAt.IsZero() && !f.opts.Now().Before(entry.expiresAt) {
+			f.remove(element)
+		} else if !entry.deleted {
+			f.lru.MoveToFront(element)
+			f.stats.LocalHits++
+			return entry.value, true
+		}
+	}
+	f.stats.LocalMisses++
+	return "", false
+}
+
+// set stores value under key locally.
+func (f *fallbackStore) set(key string, value string, expiry Expiry) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	now := f.opts.Now()
+	entry := &fallbackEntry{key: key, value: value, dirty: true}
+	switch {
+	case expiry.ttl > 0:
+		entry.expiresAt = now.Add(expiry.ttl)
+	case !expiry.deadline.IsZero():
+		entry.expiresAt = expiry.deadline
+	case expiry.keepTTL:
+		if element, ok := f.entries[key]; ok {
+			previous := element.Value.(*fallbackEntry)
+			entry.expiresAt, entry.keepTTL = previous.expiresAt, previous.keepTTL
+		} else {
+			entry.keepTTL = true
+		}
+	}
+	f.store(entry)
+}
+
+// delete records the deletion of keys locally, and returns how many had a local value.
+func (f *fallbackStore) delete(keys []string) int64 {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	var deleted int64
+	now := f.opts.Now()
+	for _, key := range keys {
+		if element, ok := f.entries[key]; ok {
+			entry := element.Value.(*fallbackEntry)
+			if !entry.deleted && (entry.expiresAt.IsZero() || now.Before(entry.expiresAt)) {
+				deleted++
+			}
+		}
+		f.store(&fallbackEntry{key: key, deleted: true, dirty: true})
+	}
+	return deleted
+}
+
+// store adds or replaces entry, evicting the least recently used one when full. f.mu must be held.
+func (f *fallbackStore) store(entry *fallbackEntry) {
+	f.stats.LocalWrites++
+	if element, ok := f.entries[entry.key]; ok {
+		element.Value = entry
+		f.lru.MoveToFront(element)
+		return
+	}
+	f.entries[entry.key] = f.lru.PushFront(entry)
+	for f.lru.Len() > f.opts.MaxEntries {
+		evicted := f.lru.Back()
+		if evicted.Value.(*fallbackEntry).dirty && f.opts.OnRecovery == FallbackRecoveryReplay {
+			f.stats.LostWrites++
+			if !f.lossLogged {
+				f.lossLogged = true
+				log.Printf("redis_cache: local store full, evicting writes that will not be replayed, see FallbackStats.LostWrites")
+			}
+		}
+		f.remove(evicted)
+	}
+}
+
+// remove drops element from the store. f.mu must be held.
+func (f *fallbackStore) remove(element *list.Element) {
+	f.lru.Remove(element)
+	delete(f.entries, element.Value.(*fallbackEntry).key)
+}
+
+// probe PINGs Redis until it answers, then switches the client back.
+func (f *fallbackStore) probe(client rueidis.Client) {
+	defer f.probes.Done()
+	ticker := time.NewTicker(f.opts.ProbeInterval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-f.stop:
+			return
+		case <-ticker.C:
+		}
+
+		ctx, cancel := context.WithTimeout(context.Background(), f.opts.ProbeTimeout)
+		err := client.Do(ctx, client.B().Ping().Build()).Error()
+		if err == nil {
+			err = f.recover(ctx, client)
+		}
+		cancel()
+		if err == nil {
+			return
+		}
+	}
+}
+
+// recover replays or flushes the local store, then switches the client back.
+// Writes keep going to the local store while they are replayed, and are
+// replayed in turn, so a replayed value never overwrites a newer one.
+func (f *fallbackStore) recover(ctx context.Context, client rueidis.Client) error {
+	for f.opts.OnRecovery == FallbackRecoveryReplay {
+		entries := f.takeDirty()
+		if len(entries) == 0 {
+			break
+		}
+		if err := f.replay(ctx, client, entries); err != nil {
+			return err
+		}
+	}
+
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	if f.opts.OnRecovery == FallbackRecoveryReplay && f.hasDirty() {
+		// Written since the last replay, the next probe replays them
+		return errors.New("local writes left to replay")
+	}
+	f.entries = make(map[string]*list.Element)
+	f.lru.Init()
+	f.failures = 0
+	f.degraded = false
+	f.total += f.opts.Now().Sub(f.since)
+	log.Printf("redis_cache: Redis is back after running degraded for %v", f.opts.Now().Sub(f.since))
+	return nil
+}
+
+// takeDirty returns the entries left to replay, and marks them replayed.
+func (f *fallbackStore) takeDirty() []fallbackEntry {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	var entries []fallbackEntry
+	for element := f.lru.Back(); element != nil; element = element.Prev() {
+		if entry := element.Value.(*fallbackEntry); entry.dirty {
+			entries = append(entries, *entry)
+			entry.dirty = false
+		}
+	}
+	return entries
+}
+
+// hasDirty reports whether entries are left to replay. f.mu must be held.
+func (f *fallbackStore) hasDirty() bool {
+	for element := f.lru.Front(); element != nil; element = element.Next() {
+		if element.Value.(*fallbackEntry).dirty {
+			return true
+		}
+	}
+	return false
+}
+
+// replay writes entries to Redis, oldest first. Expired entries are skipped,
+// and the KEEPTTL writes to keys the store did not know keep their Redis TTL.
+func (f *fallbackStore) replay(ctx context.Context, client rueidis.Client, entries []fallbackEntry) error {
+	now := f.opts.Now()
+	var cmds rueidis.Commands
+	for _, entry := range entries {
+		expiry := NoExpiry()
+		switch {
+		case entry.deleted:
+			cmds = append(cmds, client.B().Del().Key(entry.key).Build())
+			continue
+		case entry.keepTTL:
+			expiry = KeepTTL()
+		case entry.expiresAt.IsZero():
+		case now.Before(entry.expiresAt):
+			expiry = ExpireAt(entry.expiresAt)
+		default:
+			continue
+		}
+		// The TTL was already jittered when the value was set
+		cmd, err := buildSetCommand(client, entry.key, entry.value, expiry.WithoutJitter())
+		if err != nil {
+			return err
+		}
+		cmds = append(cmds, cmd)
+	}
+	if len(cmds) == 0 {
+		return nil
+	}
+
+	var firstErr error
+	var replayed, failed uint64
+	for _, resp := range client.DoMulti(ctx, cmds...) {
+		if err := resp.Error(); err != nil {
+			failed++
+			if firstErr == nil {
+				firstErr = err
+			}
+		} else {
+			replayed++
+		}
+	}
+
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	f.stats.Replayed += replayed
+	f.stats.ReplayFailures += failed
+	if firstErr != nil {
+		// Replay them again with the next probe
+		for _, entry := range entries {
+			if element, ok := f.entries[entry.key]; ok {
+				element.Value.(*fallbackEntry).dirty = true
+			}
+		}
+	}
+	return firstErr
+}
+
+// close stops the probe and waits for it to return.
+func (f *fallbackStore) close() {
+	if f == nil {
+		return
+	}
+	f.mu.Lock()
+	if !f.closed {
+		f.closed = true
+		close(f.stop)
+	}
+	f.mu.Unlock()
+	f.probes.Wait()
+}
@@ -0,0 +1,192 @@
+package redis_cache
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/redis/rueidis"
+)
+
+func TestFallbackStore(t *testing.T) {
+	clock := &fakeClock{now: time.Unix(1700000000, 0)}
+	store := newFallbackStore(FallbackOptions{MaxEntries: 2, Now: clock.Now})
+
+	store.set("a", "1", ExpireIn(time.Second))
+	store.set("b", "2", NoExpiry())
+	store.get("a")
+	// b is the least recently used entry
+	store.set("c", "3", NoExpiry())
+	if _, found := store.get("b"); found {
+		t.Errorf("Expected b to be evicted")
+	}
+	if value, found := store.get("a"); !found || value != "1" {
+		t.Errorf("get(a) = %q, %v, want 1", value, found)
+	}
+
+	// KEEPTTL keeps the local expiry, which is honoured
+	store.set("a", "one", KeepTTL())
+	clock.Advance(time.Second)
+	if _, found := store.get("a"); found {
+		t.Errorf("Expected a to expire")
+	}
+
+	if stats := store.stats; stats.LostWrites != 0 {
+		t.Errorf("LostWrites = %d with on_recovery flush, want 0", stats.LostWrites)
+	}
+	if deleted := store.delete([]string{"c", "missing"}); deleted != 1 {
+		t.Errorf("delete() = %d, want 1", deleted)
+	}
+	if _, found := store.get("c"); found {
+		t.Errorf("Expected c to be deleted")
+	}
+}
+
+// setupFallbackClient connects to s with fallback enabled, recovering with onRecovery.
+func setupFallbackClient(t *testing.T, s *faultyServer, onRecovery string) rueidis.Client {
+	return connectToFaultyServer(t, s, `
+    retry:
+      max_attempts: 1
+    fallback:
+      enabled: true
+      failure_threshold: 2
+      probe_interval: 10ms
+      on_recovery: `+onRecovery+"\n")
+}
+
+// runOutage writes while s is down, until client runs degraded, then restarts s
+// and waits for client to switch back.
+func runOutage(t *testing.T, s *faultyServer, client rueidis.Client) {
+	// Without a deadline rueidis retries the reads until Redis is back
+	ctx, cancel := context.WithTimeout(context.Background(), 100*time.Millisecond)
+	defer cancel()
+	s.Close()
+
+	// Below the threshold the failure is returned
+	if err := SetStringDataToCacheWithExpiry(ctx, client, "fallback-key", "during", ExpireIn(time.Minute)); err == nil {
+		t.Fatalf("SetStringDataToCacheWithExpiry() of the first failure error = nil, want the Redis error")
+	}
+	if GetFallbackStats(client).LocalWrites != 0 {
+		t.Errorf("Expected nothing to be written locally below the threshold")
+	}
+	// The failure reaching the threshold is served locally
+	if err := SetStringDataToCacheWithExpiry(ctx, client, "fallback-key", "during", ExpireIn(time.Minute)); err != nil {
+		t.Fatalf("SetStringDataToCacheWithExpiry() during the outage error = %v", err)
+	}
+	if value, err := GetStringDataFromCache(ctx, client, "fallback-key"); err != nil || value != "during" {
+		t.Errorf("GetStringDataFromCache() during the outage = %q, %v, want the local value", value, err)
+	}
+	if !GetFallbackStats(client).Degraded {
+		t.Fatalf("Expected the client to run degraded after 2 failures")
+	}
+
+	// The TTL of a key written before the outage is only known to Redis
+	if err := SetStringDataToCacheWithExpiry(ctx, client, "fallback-kept", "during", KeepTTL()); err != nil {
+		t.Fatalf("SetStringDataToCacheWithExpiry() with KeepTTL during the outage error = %v", err)
+	}
+
+	if value, err := GetIntDataFromCache(ctx, client, "fallback-missing"); err != nil || value != -1 {
+		t.Errorf("GetIntDataFromCache() of a missing key = %d, %v, want -1", value, err)
+	}
+	if deleted, err := DeleteDataFromCache(ctx, client, "fallback-deleted"); err != nil || deleted != 0 {
+		t.Errorf("DeleteDataFromCache() = %d, %v", deleted, err)
+	}
+
+	if err := s.Restart(); err != nil {
+		t.Fatalf("Restart() error = %v", err)
+	}
+	deadline := time.Now().Add(5 * time.Second)
+	for GetFallbackStats(client).Degraded {
+		if time.Now().After(deadline) {
+			t.Fatal("Expected the client to switch back once Redis is up")
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+}
+
+func TestFallbackFlush(t *testing.T) {
+	s := startFaultyServer(t)
+	client := setupFallbackClient(t, s, FallbackRecoveryFlush)
+	defer Close(client)
+
+	ctx := context.Background()
+	SetStringDataToCacheWithExpiry(ctx, client, "fallback-key", "before", NoExpiry())
+	runOutage(t, s, client)
+
+	// The local writes are dropped
+	if value, err := GetStringDataFromCache(ctx, client, "fallback-key"); err != nil || value != "before" {
+		t.Errorf("GetStringDataFromCache() after the outage = %q, %v, want the Redis value", value, err)
+	}
+	stats := GetFallbackStats(client)
+	if stats.Periods != 1 || stats.DegradedFor <= 0 || stats.Entries != 0 || stats.Replayed != 0 {
+		t.Errorf("GetFallbackStats() = %+v, want one period and an empty store", stats)
+	}
+}
+
+func TestFallbackReplay(t *testing.T) {
+	s := startFaultyServer(t)
+	client := setupFallbackClient(t, s, FallbackRecoveryReplay)
+	defer Close(client)
+
+	ctx := context.Background()
+	SetStringDataToCacheWithExpiry(ctx, client, "fallback-key", "before", NoExpiry())
+	SetStringDataToCacheWithExpiry(ctx, client, "fallback-deleted", "before", NoExpiry())
+	SetStringDataToCacheWithExpiry(ctx, client, "fallback-kept", "before", ExpireIn(time.Hour))
+	runOutage(t, s, client)
+
+	// The local writes are replayed, with their TTL
+	if value, _ := s.Get(namespacedKey(client, "fallback-key")); value != "during" {
+		t.Errorf("fallback-key = %q after the replay, want %q", value, "during")
+	}
+	if ttl := s.TTL(namespacedKey(client, "fallback-key")); ttl <= 0 || ttl > time.Minute {
+		t.Errorf("fallback-key TTL = %v after the replay, want up to 1m", ttl)
+	}
+	if s.Exists(namespacedKey(client, "fallback-deleted")) {
+		t.Errorf("Expected the local delete to be replayed")
+	}
+	// The KEEPTTL write keeps the TTL Redis had, instead of clearing it
+	if value, _ := s.Get(namespacedKey(client, "fallback-kept")); value != "during" {
+		t.Errorf("fallback-kept = %q after the replay, want %q", value, "during")
+	}
+	if ttl := s.TTL(namespacedKey(client, "fallback-kept")); ttl <= time.Minute || ttl > time.Hour {
+		t.Errorf("fallback-kept TTL = %v after the replay, want the 1h set before the outage", ttl)
+	}
+	if stats := GetFallbackStats(client); stats.Replayed != 3 || stats.ReplayFailures != 0 {
+		t.Errorf("GetFallbackStats() = %+v, want 3 replayed writes", stats)
+	}
+}
+
+func TestFallbackKeepsCommandErrors(t *testing.T) {
+	s := startFaultyServer(t)
+	client := setupFallbackClient(t, s, FallbackRecoveryFlush)
+	defer Close(client)
+
+	// Redis answered, the error is not hidden
+	s.fail("GET", "WRONGTYPE Operation against a key holding the wrong kind of value")
+	if _, err := GetStringDataFromCache(context.Background(), client, "fallback-hash"); err == nil {
+		t.Errorf("Expected the WRONGTYPE error to be returned")
+	}
+	if GetFallbackStats(client).LocalMisses != 0 {
+		t.Errorf("Expected the local store not to be read")
+	}
+}
+
+func TestFallbackStoreLostWrites(t *testing.T) {
+	store := newFallbackStore(FallbackOptions{MaxEntries: 2, OnRecovery: FallbackRecoveryReplay})
+
+	store.set("a", "1", NoExpiry())
+	store.set("b", "2", NoExpiry())
+	store.takeDirty()
+	// Evicting replayed entries loses nothing
+	store.set("c", "3", NoExpiry())
+	if store.stats.LostWrites != 0 {
+		t.Errorf("LostWrites = %d after evicting a replayed entry, want 0", store.stats.LostWrites)
+	}
+	store.set("d", "4", NoExpiry())
+	// c and d were not replayed
+	store.delete([]string{"e"})
+	store.set("f", "6", NoExpiry())
+	if store.stats.LostWrites != 2 {
+		t.Errorf("LostWrites = %d, want 2", store.stats.LostWrites)
+	}
+}
@@ -0,0 +1,363 @@
+package redis_cache
+
+import (
+	"context"
+	"fmt"
+	"io/fs"
+	"log"
+	"regexp"
+	"slices"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/redis/rueidis"
+)
+
+// This file contains Redis Functions (Redis 7+) library management :
+// 1. Methods to parse a library, from a Go string or an embedded file, with its name and version
+// 2. Method to load a library idempotently on every node, upgrading older versions with FUNCTION LOAD REPLACE
+// 3. Method to diff the deployed library against the embedded one with FUNCTION LIST, mismatches are logged
+// 4. FCALL / FCALL_RO helpers with typed arguments and results
+//
+// A library starts with the usual "#!lua name=<name>" line and declares its
+// version in a "-- version: <n>" comment line. Libraries registered with
+// RegisterFunctionLibrary are loaded by InitializeCacheConnection.
+
+var (
+	libraryNamePattern    = regexp.MustCompile(`^#!lua\s+name=([A-Za-z0-9_]+)`)
+	libraryVersionPattern = regexp.MustCompile(`(?m)^--\s*version:\s*(\d+)\s*$`)
+	// registeredFunctionPattern matches both redis.register_function('name', ...)
+	// and redis.register_function{function_name = 'name', ...}
+	registeredFunctionPattern = regexp.MustCompile(`redis\.register_function\s*(?:\(\s*|\{[^}]*?function_name\s*=\s*)['"]([^'"]+)['"]`)
+)
+
+// FunctionLibrary is a Redis Functions library.
+type FunctionLibrary struct {
+	Name    string
+	Version int
+	Code    string
+	// Functions are the names of the functions the library registers.
+	Functions []string
+}
+
+// ParseFunctionLibrary reads the name, version and function names of a library.
+func ParseFunctionLibrary(code string) (*FunctionLibrary, error) {
+	match := libraryNamePattern.FindStringSubmatch(code)
+	if match == nil {
+		return nil, fmt.Errorf("function library must start with #!lua name=<name>")
+	}
+	library := &FunctionLibrary{Name: match[1], Code: code}
+
+	if match := libraryVersionPattern.FindStringSubmatch(code); match != nil {
+		version, err := strconv.Atoi(match[1])
+		if err != nil {
+			return nil, fmt.Errorf("invalid version of function library %s: %v", library.Name, err)
+		}
+		library.Version = version
+	}
+	for _, match := range registeredFunctionPattern.FindAllStringSubmatch(code, -1) {
+		library.Functions = append(library.Functions, match[1])
+	}
+	slices.Sort(library.Functions)
+	return library, nil
+}
+
+// ParseFunctionLibraryFS parses the library stored in file, such as a file of an embed.FS.
+func ParseFunctionLibraryFS(fsys fs.FS, file string) (*FunctionLibrary, error) {
+	code, err := fs.ReadFile(fsys, file)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read function library %s: %v", file, err)
+	}
+	return ParseFunctionLibrary(string(code))
+}
+
+var (
+	defaultLibrariesMu sync.Mutex
+	defaultLibraries   []*FunctionLibrary
+)
+
+// RegisterFunctionLibrary parses code and loads it on every connection made by
+// InitializeCacheConnection. Register libraries before connecting.
+func RegisterFunctionLibrary(code string) (*FunctionLibrary, error) {
+	library, err := ParseFunctionLibrary(code)
+	if err != nil {
+		return nil, err
+	}
+
+	defaultLibrariesMu.Lock()
+	defer defaultLibrariesMu.Unlock()
+	for i, registered := range defaultLibraries {
+		if registered.Name == library.Name {
+			defaultLibraries[i] = library
+			return library, nil
+		}
+	}
+	defaultLibraries = append(defaultLibraries, library)
+	return library, nil
+}
+
+// RegisterFunctionLibraryFS registers the library stored in file, see RegisterFunctionLibrary.
+func RegisterFunctionLibraryFS(fsys fs.FS, file string) (*FunctionLibrary, error) {
+	code, err := fs.ReadFile(fsys, file)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read function library %s: %v", file, err)
+	}
+	return RegisterFunctionLibrary(string(code))
+}
+
+// loadDefaultFunctionLibraries loads the registered libraries, on connect.
+func loadDefaultFunctionLibraries(ctx context.Context, client rueidis.Client) error {
+	defaultLibrariesMu.Lock()
+	libraries := slices.Clone(defaultLibraries)
+	defaultLibrariesMu.Unlock()
+
+	for _, library := range libraries {
+		if err := library.Load(ctx, client); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// deployedLibrary is a library as reported by FUNCTION LIST.
+type deployedLibrary struct {
+	version   int
+	code      string
+	functions []string
+}
+
+// FunctionLibraryDiff describes how the library deployed on a node differs from the embedded one.
+type FunctionLibraryDiff struct {
+	Node            string
+	Deployed        bool
+	DeployedVersion int
+	CodeChanged     bool
+	// MissingFunctions are embedded but not deployed, ExtraFunctions deployed but not embedded.
+	MissingFunctions []string
+	ExtraFunctions   []string
+}
+
+// Matches reports whether the deployed library is exactly the embedded one.
+func (d FunctionLibraryDiff) Matches() bool {
+	return d.Deployed && !d.CodeChanged
+}
+
+func (d FunctionLibraryDiff) String() string {
+	if !d.Deployed {
+		return "not deployed"
+	}
+	parts := []string{fmt.Sprintf("deployed version %d", d.DeployedVersion)}
+	if d.CodeChanged {
+		parts = append(parts, "code differs")
+	}
+	if len(d.MissingFunctions) > 0 {
+		parts = append(parts, "missing functions "+strings.Join(d.MissingFunctions, ", "))
+	}
+	if len(d.ExtraFunctions) > 0 {
+		parts = append(parts, "extra functions "+strings.Join(d.ExtraFunctions, ", "))
+	}
+	return strings.Join(parts, ", ")
+}
+
+// diff compares the embedded library with the one deployed on node, nil when none is.
+func (l *FunctionLibrary) diff(node string, deployed *deployedLibrary) FunctionLibraryDiff {
+	d := FunctionLibraryDiff{Node: node}
+	if deployed == nil {
+		return d
+	}
+	d.Deployed = true
+	d.DeployedVersion = deployed.version
+	d.CodeChanged = deployed.code != l.Code
+	for _, name := range l.Functions {
+		if !slices.Contains(deployed.functions, name) {
+			d.MissingFunctions = append(d.MissingFunctions, name)
+		}
+	}
+	for _, name := range deployed.functions {
+		if !slices.Contains(l.Functions, name) {
+			d.ExtraFunctions = append(d.ExtraFunctions, name)
+		}
+	}
+	return d
+}
+
+// Diff compares the library deployed on every node with the embedded one.
+func (l *FunctionLibrary) Diff(ctx context.Context, client rueidis.Client) ([]FunctionLibraryDiff, error) {
+	var diffs []FunctionLibraryDiff
+	for address, node := range client.Nodes() {
+		deployed, err := l.deployed(ctx, node)
+		if err != nil {
+			return nil, err
+		}
+		diffs = append(diffs, l.diff(address, deployed))
+	}
+	return diffs, nil
+}
+
+// Load loads the library on every node. It is idempotent: a node already
+// running the same code is left alone and an older version is replaced.
+// A newer version, or the same version with different code, is kept and the
+// mismatch is logged, so an old deployment never downgrades a newer one.
+func (l *FunctionLibrary) Load(ctx context.Context, client rueidis.Client) error {
+	diffs, err := l.Diff(ctx, client)
+	if err != nil {
+		return err
+	}
+
+	nodes := client.Nodes()
+	for _, d := range diffs {
+		if err := l.loadOn(ctx, nodes[d.Node], d); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// loadOn brings node up to date given its diff d. Another process may load
+// the library between the diff and FUNCTION LOAD, which then fails with
+// "already exists": the node is diffed again and handled like any deployed
+// library, so the same version loaded concurrently is a success.
+func (l *FunctionLibrary) loadOn(ctx context.Context, node rueidis.Client, d FunctionLibraryDiff) error {
+	switch {
+	case d.Matches():
+	case !d.Deployed:
+		err := node.Do(ctx, node.B().FunctionLoad().FunctionCode(l.Code).Build()).Error()
+		if err == nil {
+			return nil
+		}
+		if !isLibraryExistsError(err) {
+			return fmt.Errorf("failed to load function library %s: %w", l.Name, err)
+		}
+		deployed, derr := l.deployed(ctx, node)
+		if derr != nil {
+			return derr
+		}
+		if deployed == nil {
+			return fmt.Errorf("failed to load function library %s: %w", l.Name, err)
+		}
+		return l.loadOn(ctx, node, l.diff(d.Node, deployed))
+	case d.DeployedVersion < l.Version:
+		if err := node.Do(ctx, node.B().FunctionLoad().Replace().FunctionCode(l.Code).Build()).Error(); err != nil {
+			return fmt.Errorf("failed to load function library %s: %w", l.Name, err)
+		}
+	default:
+		log.Printf("redis_cache: function library %s version %d on %s does not match the embedded version %d: %s", l.Name, d.DeployedVersion, d.Node, l.Version, d)
+	}
+	return nil
+}
+
+// isLibraryExistsError reports whether err is FUNCTION LOAD refusing to
+// overwrite a library without REPLACE.
+func isLibraryExistsError(err error) bool {
+	redisErr, ok := rueidis.IsRedisErr(err)
+	return ok && strings.Contains(redisErr.Error(), "already exists")
+}
+
+// deployed returns the library deployed on node, or nil when there is none.
+func (l *FunctionLibrary) deployed(ctx context.Context, node rueidis.Client) (*deployedLibrary, error) {
+	libraries, err := node.Do(ctx, node.B().FunctionList().Libraryname(l.Name).Withcode().Build()).ToArray()
+	if err != nil {
+		return nil, fmt.Errorf("failed to list function library %s: %w", l.Name, err)
+	}
+
+	// LIBRARYNAME is a pattern, so other libraries may be listed as well
+	for _, entry := range libraries {
+		fields, err := entry.AsMap()
+		if err != nil {
+			return nil, fmt.Errorf("failed to list function library %s: %w", l.Name, err)
+		}
+		name := fields["library_name"]
+		if libraryName, _ := name.ToString(); libraryName != l.Name {
+			continue
+		}
+
+		code := fields["library_code"]
+		deployed := &deployedLibrary{}
+		deployed.code, _ = code.ToString()
+		if parsed, err := ParseFunctionLibrary(deployed.code); err == nil {
+			deployed.version = parsed.Version
+		}
+		functions := fields["functions"]
+		list, _ := functions.ToArray()
+		for _, function := range list {
+			functionFields, err := function.AsMap()
+			if err != nil {
+				continue
+			}
+			functionName := functionFields["name"]
+			if name, err := functionName.ToString(); err == nil {
+				deployed.functions = append(deployed.functions, name)
+			}
+		}
+		slices.Sort(deployed.functions)
+		return deployed, nil
+	}
+	return nil, nil
+}
+
+// FCall calls function with FCALL and decodes its result into T, like RunScript.
+func FCall[T any](ctx context.Context, client rueidis.Client, function string, keys []string, args ...any) (T, error) {
+	formatted, err := formatFunctionArgs(args)
+	if err != nil {
+		var zero T
+		return zero, err
+	}
+	return decodeScriptResult[T](client.Do(ctx, client.B().Fcall().Function(function).Numkeys(int64(len(keys))).Key(namespacedKeys(client, keys)...).Arg(formatted...).Build()))
+}
+
+// FCallRO calls a read-only function with FCALL_RO, which may be served by replicas.
+func FCallRO[T any](ctx context.Context, client rueidis.Client, function string, keys []string, args ...any) (T, error) {
+	formatted, err := formatFunctionArgs(args)
+	if err != nil {
+		var zero T
+		return zero, err
+	}
+	return decodeScriptResult[T](client.Do(ctx, client.B().FcallRo().Function(function).Numkeys(int64(len(keys))).Key(namespacedKeys(client, keys)...).Arg(formatted...).Build()))
+}
+
+// formatFunctionArgs converts arguments to strings: strings and byte slices
+// are passed as-is, numbers and booleans in their Lua-friendly form (true is
+// "1"), durations in milliseconds and every other type with DefaultCodec.
+func formatFunctionArgs(args []any) ([]string, error) {
+	formatted := make([]string, len(args))
+	for i, arg := range args {
+		switch v := arg.(type) {
+		case string:
+			formatted[i] = v
+		case []byte:
+			formatted[i] = string(v)
+		case int:
+			formatted[i] = strconv.Itoa(v)
+		case int64:
+			formatted[i] = strconv.FormatInt(v, 10)
+		case int32:
+			formatted[i] = strconv.FormatInt(int64(v), 10)
+		case uint:
+			formatted[i] = strconv.FormatUint(uint64(v), 10)
+		case uint64:
+			formatted[i] = strconv.FormatUint(v, 10)
+		case uint32:
+			formatted[i] = strconv.FormatUint(uint64(v), 10)
+		case float64:
+			formatted[i] = strconv.FormatFloat(v, 'f', -1, 64)
+		case float32:
+			formatted[i] = strconv.FormatFloat(float64(v), 'f', -1, 32)
+		case bool:
+			formatted[i] = "0"
+			if v {
+				formatted[i] = "1"
+			}
+		case time.Duration:
+			formatted[i] = strconv.FormatInt(v.Milliseconds(), 10)
+		default:
+			encoded, err := encodeValue(DefaultCodec, v)
+			if err != nil {
+				return nil, fmt.Errorf("failed to encode function argument %d: %v", i, err)
+			}
+			formatted[i] = encoded
+		}
+	}
+	return formatted, nil
+}
@@ -0,0 +1,215 @@
+package redis_cache
+
+import (
+	"context"
+	"embed"
+	"fmt"
+	"slices"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/alicebob/miniredis/v2"
+	"github.com/alicebob/miniredis/v2/server"
+)
+
+//go:embed testdata/functions/cart.lua
+var testFunctions embed.FS
+
+func TestParseFunctionLibrary(t *testing.T) {
+	library, err := ParseFunctionLibraryFS(testFunctions, "testdata/functions/cart.lua")
+	if err != nil {
+		t.Fatalf("ParseFunctionLibraryFS() error = %v", err)
+	}
+	if library.Name != "cart" || library.Version != 2 {
+		t.Errorf("ParseFunctionLibraryFS() = %s version %d, want cart version 2", library.Name, library.Version)
+	}
+	if !slices.Equal(library.Functions, []string{"cart_add", "cart_count"}) {
+		t.Errorf("Functions = %v, want both register_function forms", library.Functions)
+	}
+
+	if _, err := ParseFunctionLibrary("redis.register_function('f', function() end)"); err == nil {
+		t.Errorf("Expected an error for a library without the #!lua header")
+	}
+	if library, err := ParseFunctionLibrary("#!lua name=unversioned\n"); err != nil || library.Version != 0 {
+		t.Errorf("ParseFunctionLibrary() of an unversioned library = %v, %v, want version 0", library, err)
+	}
+}
+
+func TestFunctionLibraryDiff(t *testing.T) {
+	library, _ := ParseFunctionLibraryFS(testFunctions, "testdata/functions/cart.lua")
+
+	tests := []struct {
+		name        string
+		deployed    *deployedLibrary
+		wantMatch   bool
+		wantMissing []string
+		wantExtra   []string
+		wantText    string
+	}{
+		{name: "not deployed", deployed: nil, wantText: "not deployed"},
+		{name: "same code", deployed: &deployedLibrary{version: 2, code: library.Code, functions: []string{"cart_add", "cart_count"}}, wantMatch: true},
+		{
+			name:        "older version with other functions",
+			deployed:    &deployedLibrary{version: 1, code: "#!lua name=cart\n", functions: []string{"cart_add", "cart_clear"}},
+			wantMissing: []string{"cart_count"},
+			wantExtra:   []string{"cart_clear"},
+			wantText:    "deployed version 1, code differs, missing functions cart_count, extra functions cart_clear",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			d := library.diff("node", tt.deployed)
+			if d.Matches() != tt.wantMatch {
+				t.Errorf("Matches() = %v, want %v", d.Matches(), tt.wantMatch)
+			}
+			if !slices.Equal(d.MissingFunctions, tt.wantMissing) || !slices.Equal(d.ExtraFunctions, tt.wantExtra) {
+				t.Errorf("diff = missing %v extra %v, want missing %v extra %v", d.MissingFunctions, d.ExtraFunctions, tt.wantMissing, tt.wantExtra)
+			}
+			if tt.wantText != "" && d.String() != tt.wantText {
+				t.Errorf("String() = %q, want %q", d.String(), tt.wantText)
+			}
+		})
+	}
+}
+
+func TestFormatFunctionArgs(t *testing.T) {
+	got, err := formatFunctionArgs([]any{"sku", []byte("raw"), 3, int64(-4), uint(5), 1.25, true, false, 1500 * time.Millisecond})
+	if err != nil {
+		t.Fatalf("formatFunctionArgs() error = %v", err)
+	}
+	want := []string{"sku", "raw", "3", "-4", "5", "1.25", "1", "0", "1500"}
+	if !slices.Equal(got, want) {
+		t.Errorf("formatFunctionArgs() = %v, want %v", got, want)
+	}
+}
+
+func TestFunctionLibraryLoadAndCall(t *testing.T) {
+	client := setupTestClient(t)
+	defer Close(client)
+
+	ctx := context.Background()
+	library, _ := ParseFunctionLibraryFS(testFunctions, "testdata/functions/cart.lua")
+	if err := library.Load(ctx, client); err != nil {
+		if strings.Contains(err.Error(), "unknown command") {
+			t.Skip("Redis Functions need Redis 7 or later")
+		}
+		t.Fatalf("Load() error = %v", err)
+	}
+	// Loading again is a no-op
+	if err := library.Load(ctx, client); err != nil {
+		t.Fatalf("Load() again error = %v", err)
+	}
+	diffs, err := library.Diff(ctx, client)
+	if err != nil || len(diffs) == 0 || !diffs[0].Matches() {
+		t.Errorf("Diff() = %v, %v, want a match", diffs, err)
+	}
+
+	DeleteDataFromCache(ctx, client, "function-cart")
+	if got, err := FCall[int64](ctx, client, "cart_add", []string{"function-cart"}, "sku-1", 2); err != nil || got != 2 {
+		t.Errorf("FCall() = %d, %v, want 2", got, err)
+	}
+	if got, err := FCallRO[int](ctx, client, "cart_count", []string{"function-cart"}); err != nil || got != 1 {
+		t.Errorf("FCallRO() = %d, %v, want 1", got, err)
+	}
+}
+
+// functionServer emulates FUNCTION LIST and FUNCTION LOAD on miniredis. Before
+// the first FUNCTION LOAD it deploys racer, as if another process had loaded
+// a library between our diff and our load.
+type functionServer struct {
+	*miniredis.Miniredis
+
+	mu        sync.Mutex
+	libraries map[string]*FunctionLibrary
+	racer     *FunctionLibrary
+	loads     []string
+}
+
+func startFunctionServer(t *testing.T, racer *FunctionLibrary) *functionServer {
+	s := &functionServer{Miniredis: miniredis.RunT(t), libraries: map[string]*FunctionLibrary{}, racer: racer}
+	s.Server().SetPreHook(func(c *server.Peer, cmd string, args ...string) bool {
+		if !strings.EqualFold(cmd, "FUNCTION") || len(args) == 0 {
+			return false
+		}
+		s.mu.Lock()
+		defer s.mu.Unlock()
+		switch strings.ToUpper(args[0]) {
+		case "LIST":
+			c.WriteLen(len(s.libraries))
+			for _, library := range s.libraries {
+				c.WriteMapLen(3)
+				c.WriteBulk("library_name")
+				c.WriteBulk(library.Name)
+				c.WriteBulk("library_code")
+				c.WriteBulk(library.Code)
+				c.WriteBulk("functions")
+				c.WriteLen(len(library.Functions))
+				for _, name := range library.Functions {
+					c.WriteMapLen(1)
+					c.WriteBulk("name")
+					c.WriteBulk(name)
+				}
+			}
+		case "LOAD":
+			if s.racer != nil {
+				s.libraries[s.racer.Name] = s.racer
+				s.racer = nil
+			}
+			replace := strings.EqualFold(args[1], "REPLACE")
+			s.loads = append(s.loads, strings.Join(args[1:len(args)-1], " "))
+			library, err := ParseFunctionLibrary(args[len(args)-1])
+			if err != nil {
+				c.WriteError("ERR " + err.Error())
+				return true
+			}
+			if _, ok := s.libraries[library.Name]; ok && !replace {
+				c.WriteError(fmt.Sprintf("ERR Library '%s' already exists", library.Name))
+				return true
+			}
+			s.libraries[library.Name] = library
+			c.WriteBulk(library.Name)
+		default:
+			return false
+		}
+		return true
+	})
+	return s
+}
+
+func TestFunctionLibraryLoadRace(t *testing.T) {
+	library, _ := ParseFunctionLibraryFS(testFunctions, "testdata/functions/cart.lua")
+	older, _ := ParseFunctionLibrary(strings.Replace(library.Code, "-- version: 2", "-- version: 1", 1))
+
+	tests := []struct {
+		name      string
+		racer     *FunctionLibrary
+		wantLoads []string
+	}{
+		{name: "nothing deployed", wantLoads: []string{""}},
+		{name: "same version loaded concurrently", racer: library, wantLoads: []string{""}},
+		{name: "older version loaded concurrently", racer: older, wantLoads: []string{"", "REPLACE"}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			s := startFunctionServer(t, tt.racer)
+			client := connectToFaultyServer(t, &faultyServer{Miniredis: s.Miniredis}, "")
+			defer Close(client)
+
+			if err := library.Load(context.Background(), client); err != nil {
+				t.Fatalf("Load() error = %v", err)
+			}
+			s.mu.Lock()
+			defer s.mu.Unlock()
+			if !slices.Equal(s.loads, tt.wantLoads) {
+				t.Errorf("FUNCTION LOAD calls = %q, want %q", s.loads, tt.wantLoads)
+			}
+			if deployed := s.libraries[library.Name]; deployed == nil || deployed.Code != library.Code {
+				t.Errorf("deployed library = %v, want the embedded one", deployed)
+			}
+		})
+	}
+}
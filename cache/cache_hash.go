@@ -0,0 +1,243 @@
+package redis_cache
+
+import (
+	"context"
+	"fmt"
+	"reflect"
+	"strconv"
+
+	"github.com/redis/rueidis"
+)
+
+// This file contains the following methods for hashes :
+// 1. Methods to set one or many fields - with the option to add a whole-key expiry
+// 2. Methods to get one field, many fields, or all fields into a map or a struct
+// 3. Methods to delete fields and increment a field
+// 4. Method to set per-field expiry with HEXPIRE (Redis 7.4+)
+
+// HashTag is the struct tag used to map struct fields onto hash fields.
+// Fields without the tag use the Go field name, "-" skips the field.
+const HashTag = "redis"
+
+// SetHashFieldToCache sets a single hash field, applying expiry to the whole key.
+func SetHashFieldToCache(ctx context.Context, client rueidis.Client, key string, field string, value string, expiry Expiry) error {
+	return SetHashFieldsToCache(ctx, client, key, map[string]string{field: value}, expiry)
+}
+
+// SetHashFieldsToCache sets many hash fields at once, applying expiry to the whole key.
+// As with the string setters, NoExpiry clears any existing TTL and KeepTTL leaves it untouched.
+func SetHashFieldsToCache(ctx context.Context, client rueidis.Client, key string, fields map[string]string, expiry Expiry) error {
+	if len(fields) == 0 {
+		return fmt.Errorf("at least one hash field is required")
+	}
+
+	key = namespacedKey(client, key)
+	hset := client.B().Hset().Key(key).FieldValue()
+	for field, value := range fields {
+		hset = hset.FieldValue(field, value)
+	}
+
+	if err := doWithKeyExpiry(ctx, client, key, hset.Build(), expiry); err != nil {
+		return fmt.Errorf("failed to set hash fields to cache: %w", err)
+	}
+	return nil
+}
+
+// GetHashFieldFromCache returns a single hash field, or "" when the key or field does not exist.
+func GetHashFieldFromCache(ctx context.Context, client rueidis.Client, key string, field string) (string, error) {
+	resp, err := client.Do(ctx, client.B().Hget().Key(namespacedKey(client, key)).Field(field).Build()).ToString()
+	if err != nil {
+		if rueidis.IsRedisNil(err) {
+			return "", nil
+		}
+		return "", fmt.Errorf("failed to get hash field from cache: %w", err)
+	}
+	return resp, nil
+}
+
+// GetHashFieldsFromCache returns the requested hash fields. Fields that do not exist are left out of the map.
+func GetHashFieldsFromCache(ctx context.Context, client rueidis.Client, key string, fields ...string) (map[string]string, error) {
+	if len(fields) == 0 {
+		return map[string]string{}, nil
+	}
+
+	values, err := client.Do(ctx, client.B().Hmget().Key(namespacedKey(client, key)).Field(fields...).Build()).ToArray()
+	if err != nil {
+		return nil, fmt.Errorf("failed to get hash fields from cache: %w", err)
+	}
+
+	result := make(map[string]string, len(fields))
+	for i, value := range values {
+		str, err := value.ToString()
+		if err != nil {
+			if rueidis.IsRedisNil(err) {
+				continue
+			}
+			return nil, fmt.Errorf("failed to get hash fields from cache: %w", err)
+		}
+		result[fields[i]] = str
+	}
+	return result, nil
+}
+
+// GetAllHashFieldsFromCache returns every field of the hash. A missing key returns an empty map.
+func GetAllHashFieldsFromCache(ctx context.Context, client rueidis.Client, key string) (map[string]string, error) {
+	resp, err := client.Do(ctx, client.B().Hgetall().Key(namespacedKey(client, key)).Build()).AsStrMap()
+	if err != nil {
+		return nil, fmt.Errorf("failed to get hash from cache: %w", err)
+	}
+	return resp, nil
+}
+
+// GetHashIntoStruct reads every field of the hash into the struct pointed to by dest,
+// matching hash fields by the `redis` struct tag. It reports whether the key existed.
+func GetHashIntoStruct(ctx context.Context, client rueidis.Client, key string, dest interface{}) (bool, error) {
+	fields, err := GetAllHashFieldsFromCache(ctx, client, key)
+	if err != nil {
+		return false, err
+	}
+	if len(fields) == 0 {
+		return false, nil
+	}
+	if err := decodeHashIntoStruct(fields, dest); err != nil {
+		return true, err
+	}
+	return true, nil
+}
+
+// DeleteHashFieldsFromCache deletes the given hash fields and returns how many existed.
+func DeleteHashFieldsFromCache(ctx context.Context, client rueidis.Client, key string, fields ...string) (int64, error) {
+	if len(fields) == 0 {
+		return 0, nil
+	}
+	deleted, err := client.Do(ctx, client.B().Hdel().Key(namespacedKey(client, key)).Field(fields...).Build()).AsInt64()
+	if err != nil {
+		return 0, fmt.Errorf("failed to delete hash fields from cache: %w", err)
+	}
+	return deleted, nil
+}
+
+// IncrementHashFieldInCache increments an integer hash field by delta and returns the new value.
+func IncrementHashFieldInCache(ctx context.Context, client rueidis.Client, key string, field string, delta int64) (int64, error) {
+	value, err := client.Do(ctx, client.B().Hincrby().Key(namespacedKey(client, key)).Field(field).Increment(delta).Build()).AsInt64()
+	if err != nil {
+		return 0, fmt.Errorf("failed to increment hash field in cache: %w", err)
+	}
+	return value, nil
+}
+
+// ExpireHashFieldsInCache sets a per-field expiry with HEXPIRE and friends, which requires Redis 7.4+.
+// It follows the same conventions as the setters: NoExpiry persists the fields and KeepTTL is a no-op.
+func ExpireHashFieldsInCache(ctx context.Context, client rueidis.Client, key string, expiry Expiry, fields ...string) error {
+	if len(fields) == 0 {
+		return nil
+	}
+	if err := expiry.validate(); err != nil {
+		return err
+	}
+	expiry = expiry.resolve(client)
+
+	key = namespacedKey(client, key)
+	numFields := int64(len(fields))
+
+	var cmd rueidis.Completed
+	switch {
+	case expiry.keepTTL:
+		return nil
+	case !expiry.deadline.IsZero():
+		at, inSeconds := unixSecondsOrMilliseconds(expiry.deadline)
+		if inSeconds {
+			cmd = client.B().Hexpireat().Key(key).UnixTimeSeconds(at).Fields().Numfields(numFields).Field(fields...).Build()
+		} else {
+			cmd = client.B().Hpexpireat().Key(key).UnixTimeMilliseconds(at).Fields().Numfields(numFields).Field(fields...).Build()
+		}
+	case expiry.ttl > 0:
+		ttl, inSeconds := secondsOrMilliseconds(expiry.ttl)
+		if inSeconds {
+			cmd = client.B().Hexpire().Key(key).Seconds(ttl).Fields().Numfields(numFields).Field(fields...).Build()
+		} else {
+			cmd = client.B().Hpexpire().Key(key).Milliseconds(ttl).Fields().Numfields(numFields).Field(fields...).Build()
+		}
+	default:
+		cmd = client.B().Hpersist().Key(key).Fields().Numfields(numFields).Field(fields...).Build()
+	}
+
+	if err := client.Do(ctx, cmd).Error(); err != nil {
+		return fmt.Errorf("failed to set hash field expiry: %w", err)
+	}
+	return nil
+}
+
+// decodeHashIntoStruct copies the hash fields onto the tagged fields of dest.
+func decodeHashIntoStruct(fields map[string]string, dest interface{}) error {
+	v := reflect.ValueOf(dest)
+	if v.Kind() != reflect.Pointer || v.IsNil() || v.Elem().Kind() != reflect.Struct {
+		return fmt.Errorf("destination must be a non-nil pointer to a struct, got %T", dest)
+	}
+	v = v.Elem()
+	t := v.Type()
+
+	for i := 0; i < t.NumField(); i++ {
+		sf := t.Field(i)
+		if !sf.IsExported() {
+			continue
+		}
+		name := sf.Name
+		if tag, ok := sf.Tag.Lookup(HashTag); ok {
+			if tag == "-" {
+				continue
+			}
+			if tag != "" {
+				name = tag
+			}
+		}
+		raw, ok := fields[name]
+		if !ok {
+			continue
+		}
+		if err := setFieldFromString(v.Field(i), raw); err != nil {
+			return fmt.Errorf("failed to decode hash field %q into %s: %v", name, sf.Name, err)
+		}
+	}
+	return nil
+}
+
+// setFieldFromString parses raw into a struct field of a basic kind.
+func setFieldFromString(field reflect.Value, raw string) error {
+	switch field.Kind() {
+	case reflect.String:
+		field.SetString(raw)
+	case reflect.Bool:
+		b, err := strconv.ParseBool(raw)
+		if err != nil {
+			return err
+		}
+		field.SetBool(b)
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		n, err := strconv.ParseInt(raw, 10, field.Type().Bits())
+		if err != nil {
+			return err
+		}
+		field.SetInt(n)
+	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+		n, err := strconv.ParseUint(raw, 10, field.Type().Bits())
+		if err != nil {
+			return err
+		}
+		field.SetUint(n)
+	case reflect.Float32, reflect.Float64:
+		f, err := strconv.ParseFloat(raw, field.Type().Bits())
+		if err != nil {
+			return err
+		}
+		field.SetFloat(f)
+	case reflect.Slice:
+		if field.Type().Elem().Kind() != reflect.Uint8 {
+			return fmt.Errorf("unsupported slice type %s", field.Type())
+		}
+		field.SetBytes([]byte(raw))
+	default:
+		return fmt.Errorf("unsupported field type %s", field.Type())
+	}
+	return nil
+}
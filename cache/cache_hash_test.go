@@ -0,0 +1,145 @@
+package redis_cache
+
+import (
+	"context"
+	"testing"
+	"time"
+)
+
+type testProfile struct {
+	Name    string  `redis:"name"`
+	Age     int     `redis:"age"`
+	Score   float64 `redis:"score"`
+	Active  bool    `redis:"active"`
+	Skipped string  `redis:"-"`
+	Country string
+}
+
+func TestSetAndGetHashFieldsToCache(t *testing.T) {
+	client := setupTestClient(t)
+	defer Close(client)
+
+	ctx := context.Background()
+	key := "hash-profile-1"
+
+	fields := map[string]string{
+		"name":    "alice",
+		"age":     "30",
+		"score":   "9.5",
+		"active":  "true",
+		"Skipped": "nope",
+		"Country": "IN",
+	}
+	if err := SetHashFieldsToCache(ctx, client, key, fields, ExpireIn(time.Minute)); err != nil {
+		t.Fatalf("SetHashFieldsToCache() error = %v", err)
+	}
+
+	name, err := GetHashFieldFromCache(ctx, client, key, "name")
+	if err != nil {
+		t.Fatalf("GetHashFieldFromCache() error = %v", err)
+	}
+	if name != "alice" {
+		t.Errorf("GetHashFieldFromCache() = %v, want %v", name, "alice")
+	}
+
+	missing, err := GetHashFieldFromCache(ctx, client, key, "missing")
+	if err != nil {
+		t.Fatalf("GetHashFieldFromCache() for missing field error = %v", err)
+	}
+	if missing != "" {
+		t.Errorf("Expected empty string for missing field, got %v", missing)
+	}
+
+	some, err := GetHashFieldsFromCache(ctx, client, key, "name", "age", "missing")
+	if err != nil {
+		t.Fatalf("GetHashFieldsFromCache() error = %v", err)
+	}
+	if len(some) != 2 || some["name"] != "alice" || some["age"] != "30" {
+		t.Errorf("GetHashFieldsFromCache() = %v, want name and age only", some)
+	}
+
+	all, err := GetAllHashFieldsFromCache(ctx, client, key)
+	if err != nil {
+		t.Fatalf("GetAllHashFieldsFromCache() error = %v", err)
+	}
+	if len(all) != len(fields) {
+		t.Errorf("GetAllHashFieldsFromCache() returned %d fields, want %d", len(all), len(fields))
+	}
+
+	var profile testProfile
+	found, err := GetHashIntoStruct(ctx, client, key, &profile)
+	if err != nil {
+		t.Fatalf("GetHashIntoStruct() error = %v", err)
+	}
+	want := testProfile{Name: "alice", Age: 30, Score: 9.5, Active: true, Country: "IN"}
+	if !found || profile != want {
+		t.Errorf("GetHashIntoStruct() = %+v, %v, want %+v, true", profile, found, want)
+	}
+
+	ttl, err := client.Do(ctx, client.B().Ttl().Key(key).Build()).AsInt64()
+	if err != nil {
+		t.Fatalf("TTL error = %v", err)
+	}
+	if ttl <= 0 || ttl > 60 {
+		t.Errorf("Expected whole-key TTL of up to 60s, got %d", ttl)
+	}
+
+	// KeepTTL must not clear the existing TTL
+	if err := SetHashFieldToCache(ctx, client, key, "name", "bob", KeepTTL()); err != nil {
+		t.Fatalf("SetHashFieldToCache() error = %v", err)
+	}
+	ttl, err = client.Do(ctx, client.B().Ttl().Key(key).Build()).AsInt64()
+	if err != nil {
+		t.Fatalf("TTL error = %v", err)
+	}
+	if ttl <= 0 {
+		t.Errorf("Expected KeepTTL to preserve the TTL, got %d", ttl)
+	}
+}
+
+func TestHashFieldIncrementAndDelete(t *testing.T) {
+	client := setupTestClient(t)
+	defer Close(client)
+
+	ctx := context.Background()
+	key := "hash-counters-1"
+
+	if err := SetHashFieldToCache(ctx, client, key, "visits", "10", NoExpiry()); err != nil {
+		t.Fatalf("SetHashFieldToCache() error = %v", err)
+	}
+
+	got, err := IncrementHashFieldInCache(ctx, client, key, "visits", 5)
+	if err != nil {
+		t.Fatalf("IncrementHashFieldInCache() error = %v", err)
+	}
+	if got != 15 {
+		t.Errorf("IncrementHashFieldInCache() = %d, want 15", got)
+	}
+
+	deleted, err := DeleteHashFieldsFromCache(ctx, client, key, "visits", "missing")
+	if err != nil {
+		t.Fatalf("DeleteHashFieldsFromCache() error = %v", err)
+	}
+	if deleted != 1 {
+		t.Errorf("DeleteHashFieldsFromCache() = %d, want 1", deleted)
+	}
+
+	var profile testProfile
+	found, err := GetHashIntoStruct(ctx, client, key, &profile)
+	if err != nil {
+		t.Fatalf("GetHashIntoStruct() error = %v", err)
+	}
+	if found {
+		t.Error("Expected GetHashIntoStruct() to report a missing key")
+	}
+}
+
+func TestDecodeHashIntoStructErrors(t *testing.T) {
+	var profile testProfile
+	if err := decodeHashIntoStruct(map[string]string{}, profile); err == nil {
+		t.Error("Expected an error for a non-pointer destination")
+	}
+	if err := decodeHashIntoStruct(map[string]string{"age": "abc"}, &profile); err == nil {
+		t.Error("Expected an error for a non numeric age")
+	}
+}
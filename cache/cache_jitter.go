@@ -0,0 +1,79 @@
+package redis_cache
+
+import (
+	"math/rand/v2"
+	"sync"
+	"time"
+)
+
+// JitterPolicy spreads the TTLs written by the package, so keys set together
+// with the same expiry do not all expire in the same second.
+//
+// A policy is configured either as a percentage of the TTL or as an absolute
+// range, and is safe for concurrent use.
+type JitterPolicy struct {
+	// Percent spreads the TTL by a random amount of up to +/- Percent percent.
+	Percent float64
+	// Min and Max add a random offset in [Min, Max] to the TTL.
+	Min time.Duration
+	Max time.Duration
+
+	mu  sync.Mutex
+	rng *rand.Rand
+}
+
+// NewPercentJitter returns a policy that spreads each TTL by up to +/- percent percent.
+func NewPercentJitter(percent float64) *JitterPolicy {
+	return &JitterPolicy{Percent: percent}
+}
+
+// NewRangeJitter returns a policy that adds a random offset in [min, max] to each TTL.
+func NewRangeJitter(min, max time.Duration) *JitterPolicy {
+	return &JitterPolicy{Min: min, Max: max}
+}
+
+// WithSeed makes the policy draw from a deterministic random source, which
+// is mainly useful for tests.
+func (j *JitterPolicy) WithSeed(seed int64) *JitterPolicy {
+	j.mu.Lock()
+	defer j.mu.Unlock()
+	j.rng = rand.New(rand.NewPCG(uint64(seed), uint64(seed)))
+	return j
+}
+
+// float64 returns a random number in [0, 1) from the policy's source.
+func (j *JitterPolicy) float64() float64 {
+	j.mu.Lock()
+	defer j.mu.Unlock()
+	if j.rng != nil {
+		return j.rng.Float64()
+	}
+	return rand.Float64()
+}
+
+// Apply returns ttl with the jitter applied. A nil policy or a non positive
+// ttl is returned unchanged, and the result is never shorter than 1ms so a
+// jittered key can not end up without an expiry.
+func (j *JitterPolicy) Apply(ttl time.Duration) time.Duration {
+	if j == nil || ttl <= 0 {
+		return ttl
+	}
+
+	jittered := ttl
+	if j.Percent > 0 {
+		spread := float64(ttl) * j.Percent / 100
+		jittered += time.Duration((j.float64()*2 - 1) * spread)
+	}
+	if j.Min != 0 || j.Max != 0 {
+		offset := j.Min
+		if j.Max > j.Min {
+			offset += time.Duration(j.float64() * float64(j.Max-j.Min))
+		}
+		jittered += offset
+	}
+
+	if jittered < time.Millisecond {
+		return time.Millisecond
+	}
+	return jittered
+}
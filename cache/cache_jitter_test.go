@@ -0,0 +1,105 @@
+package redis_cache
+
+import (
+	"context"
+	"testing"
+	"time"
+)
+
+func TestJitterPolicyApply(t *testing.T) {
+	tests := []struct {
+		name   string
+		policy *JitterPolicy
+		ttl    time.Duration
+		min    time.Duration
+		max    time.Duration
+	}{
+		{
+			name:   "nil policy",
+			policy: nil,
+			ttl:    time.Minute,
+			min:    time.Minute,
+			max:    time.Minute,
+		},
+		{
+			name:   "percentage",
+			policy: NewPercentJitter(10).WithSeed(1),
+			ttl:    100 * time.Second,
+			min:    90 * time.Second,
+			max:    110 * time.Second,
+		},
+		{
+			name:   "absolute range",
+			policy: NewRangeJitter(time.Second, 5*time.Second).WithSeed(1),
+			ttl:    time.Minute,
+			min:    61 * time.Second,
+			max:    65 * time.Second,
+		},
+		{
+			name:   "never drops below 1ms",
+			policy: NewRangeJitter(-time.Hour, -time.Hour),
+			ttl:    time.Second,
+			min:    time.Millisecond,
+			max:    time.Millisecond,
+		},
+		{
+			name:   "no expiry stays untouched",
+			policy: NewPercentJitter(50),
+			ttl:    0,
+			min:    0,
+			max:    0,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			for i := 0; i < 100; i++ {
+				got := tt.policy.Apply(tt.ttl)
+				if got < tt.min || got > tt.max {
+					t.Fatalf("Apply(%v) = %v, want between %v and %v", tt.ttl, got, tt.min, tt.max)
+				}
+			}
+		})
+	}
+}
+
+func TestJitterPolicySeedIsDeterministic(t *testing.T) {
+	first := NewPercentJitter(20).WithSeed(42)
+	second := NewPercentJitter(20).WithSeed(42)
+
+	spread := false
+	for i := 0; i < 10; i++ {
+		a, b := first.Apply(time.Minute), second.Apply(time.Minute)
+		if a != b {
+			t.Fatalf("Apply() with the same seed = %v and %v, want equal", a, b)
+		}
+		if a != time.Minute {
+			spread = true
+		}
+	}
+	if !spread {
+		t.Error("Expected jitter to change the TTL at least once")
+	}
+}
+
+func TestSetStringDataToCacheWithJitter(t *testing.T) {
+	client := setupTestClient(t)
+	defer Close(client)
+
+	ctx := context.Background()
+	key := "jitter-key"
+	expiry := ExpireIn(time.Minute).WithJitter(NewRangeJitter(10*time.Second, 20*time.Second))
+
+	if err := SetStringDataToCacheWithExpiry(ctx, client, key, "value", expiry); err != nil {
+		t.Fatalf("SetStringDataToCacheWithExpiry() error = %v", err)
+	}
+
+	pttl, err := client.Do(ctx, client.B().Pttl().Key(key).Build()).AsInt64()
+	if err != nil {
+		t.Fatalf("PTTL error = %v", err)
+	}
+	got := time.Duration(pttl) * time.Millisecond
+	if got < 69*time.Second || got > 80*time.Second {
+		t.Errorf("PTTL = %v, want between 70s and 80s", got)
+	}
+}
@@ -0,0 +1,306 @@
+package redis_cache
+
+import (
+	"context"
+	"crypto/tls"
+	"errors"
+	"fmt"
+	"log"
+	"net"
+	"sync"
+	"time"
+
+	"github.com/redis/rueidis"
+	"github.com/redis/rueidis/rueidishook"
+)
+
+// This file contains the lazy connect mode, enabled with the lazy_connect section of the config :
+// 1. InitializeCacheConnection returns a usable client right away, even when Redis is down
+// 2. A background goroutine connects with a jittered exponential backoff until it succeeds
+// 3. Until then every command fails with ErrNotReady, without being retried or opening the circuit
+// 4. Ready and ReadyErr report when the client is connected, for readiness probes
+//
+// The connection is health checked and the scripts and function libraries are
+// loaded exactly as in the default mode, only failures are retried instead of returned.
+
+// ErrNotReady is returned by the commands of a lazy client that is not connected yet.
+var ErrNotReady = errors.New("redis client is not connected yet")
+
+// LazyConnectOptions configures the background connection of a lazy client.
+type LazyConnectOptions struct {
+	// BaseBackoff is the delay before the second attempt, doubled on every attempt. 100ms by default.
+	BaseBackoff time.Duration
+	// MaxBackoff caps the delay between attempts. 30s by default.
+	MaxBackoff time.Duration
+}
+
+func (o *LazyConnectOptions) setDefaults() {
+	if o.BaseBackoff <= 0 {
+		o.BaseBackoff = 100 * time.Millisecond
+	}
+	if o.MaxBackoff < o.BaseBackoff {
+		o.MaxBackoff = max(30*time.Second, o.BaseBackoff)
+	}
+}
+
+// closedReady is the Ready channel of the clients connected on creation.
+var closedReady = func() chan struct{} {
+	ready := make(chan struct{})
+	close(ready)
+	return ready
+}()
+
+// Ready returns a channel closed once client is connected. It is closed from
+// the start for clients that were not created with lazy_connect, and never
+// closed when the client is closed before connecting.
+func Ready(client rueidis.Client) <-chan struct{} {
+	if lazy := lazyOf(client); lazy != nil {
+		return lazy.ready
+	}
+	return closedReady
+}
+
+// ReadyErr returns nil once client is connected. Until then it returns
+// ErrNotReady, along with the error of the last connection attempt.
+func ReadyErr(client rueidis.Client) error {
+	lazy := lazyOf(client)
+	if lazy == nil {
+		return nil
+	}
+	_, err := lazy.current()
+	if errors.Is(err, ErrNotReady) {
+		lazy.mu.Lock()
+		defer lazy.mu.Unlock()
+		if lazy.err != nil {
+			return fmt.Errorf("%w: %v", ErrNotReady, lazy.err)
+		}
+	}
+	return err
+}
+
+// lazyOf returns the lazy client wrapped by client, nil when it was connected on creation.
+func lazyOf(client rueidis.Client) *lazyClient {
+	if c, ok := client.(*cacheClient); ok {
+		if lazy, ok := c.Client.(*lazyClient); ok {
+			return lazy
+		}
+	}
+	return nil
+}
+
+// lazyClient is the rueidis.Client of the lazy connect mode. It fails with
+// ErrNotReady until the background goroutine connected, then every call goes
+// to the connected client.
+type lazyClient struct {
+	builder rueidis.Builder
+	ready   chan struct{}
+	stop    context.CancelFunc
+	done    chan struct{}
+
+	mu     sync.Mutex
+	client rueidis.Client
+	// err is the error of the last connection attempt
+	err    error
+	closed bool
+}
+
+// newLazyClient returns a lazy client calling connect in the background until it succeeds.
+func newLazyClient(opts LazyConnectOptions, connect func(ctx context.Context) (rueidis.Client, error)) *lazyClient {
+	opts.setDefaults()
+	ctx, stop := context.WithCancel(context.Background())
+	l := &lazyClient{
+		builder: notReadyBuilder(),
+		ready:   make(chan struct{}),
+		stop:    stop,
+		done:    make(chan struct{}),
+	}
+	go l.connect(ctx, opts, connect)
+	return l
+}
+
+// connect calls connect until it succeeds or ctx is done.
+func (l *lazyClient) connect(ctx context.Context, opts LazyConnectOptions, connect func(ctx context.Context) (rueidis.Client, error)) {
+	defer close(l.done)
+	// The reconnect delays follow the retry backoff, with its default jitter
+	policy := RetryPolicy{BaseBackoff: opts.BaseBackoff, MaxBackoff: opts.MaxBackoff}
+	policy.setDefaults()
+
+	for attempt := 1; ; attempt++ {
+		attemptCtx, cancel := context.WithTimeout(ctx, 5*time.Second)
+		client, err := connect(attemptCtx)
+		cancel()
+
+		l.mu.Lock()
+		if err == nil {
+			if l.closed {
+				l.mu.Unlock()
+				client.Close()
+				return
+			}
+			l.client, l.err = client, nil
+			l.mu.Unlock()
+			close(l.ready)
+			log.Printf("redis_cache: connected to Redis on attempt %d", attempt)
+			return
+		}
+		l.err = err
+		l.mu.Unlock()
+
+		delay := policy.backoff(attempt)
+		log.Printf("redis_cache: connecting to Redis failed, retrying in %v: %v", delay, err)
+		if sleepContext(ctx, delay) != nil {
+			return
+		}
+	}
+}
+
+// current returns the connected client, ErrNotReady until then and ErrClosing once closed.
+func (l *lazyClient) current() (rueidis.Client, error) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	switch {
+	case l.client != nil:
+		return l.client, nil
+	case l.closed:
+		return nil, rueidis.ErrClosing
+	default:
+		return nil, ErrNotReady
+	}
+}
+
+// B returns the builder of the connected client. Until then commands are
+// built without hash slots, build them again once connected to send them to a cluster.
+func (l *lazyClient) B() rueidis.Builder {
+	if client, _ := l.current(); client != nil {
+		return client.B()
+	}
+	return l.builder
+}
+
+func (l *lazyClient) Do(ctx context.Context, cmd rueidis.Completed) rueidis.RedisResult {
+	client, err := l.current()
+	if err != nil {
+		return rueidishook.NewErrorResult(err)
+	}
+	return client.Do(ctx, cmd)
+}
+
+func (l *lazyClient) DoMulti(ctx context.Context, multi ...rueidis.Completed) []rueidis.RedisResult {
+	client, err := l.current()
+	if err != nil {
+		return errorResults(err, len(multi))
+	}
+	return client.DoMulti(ctx, multi...)
+}
+
+func (l *lazyClient) DoCache(ctx context.Context, cmd rueidis.Cacheable, ttl time.Duration) rueidis.RedisResult {
+	client, err := l.current()
+	if err != nil {
+		return rueidishook.NewErrorResult(err)
+	}
+	return client.DoCache(ctx, cmd, ttl)
+}
+
+func (l *lazyClient) DoMultiCache(ctx context.Context, multi ...rueidis.CacheableTTL) []rueidis.RedisResult {
+	client, err := l.current()
+	if err != nil {
+		return errorResults(err, len(multi))
+	}
+	return client.DoMultiCache(ctx, multi...)
+}
+
+func (l *lazyClient) DoStream(ctx context.Context, cmd rueidis.Completed) rueidis.RedisResultStream {
+	client, err := l.current()
+	if err != nil {
+		return rueidishook.NewErrorResultStream(err)
+	}
+	return client.DoStream(ctx, cmd)
+}
+
+func (l *lazyClient) DoMultiStream(ctx context.Context, multi ...rueidis.Completed) rueidis.MultiRedisResultStream {
+	client, err := l.current()
+	if err != nil {
+		return rueidishook.NewErrorResultStream(err)
+	}
+	return client.DoMultiStream(ctx, multi...)
+}
+
+func (l *lazyClient) Receive(ctx context.Context, subscribe rueidis.Completed, fn func(msg rueidis.PubSubMessage)) error {
+	client, err := l.current()
+	if err != nil {
+		return err
+	}
+	return client.Receive(ctx, subscribe, fn)
+}
+
+func (l *lazyClient) Dedicated(fn func(rueidis.DedicatedClient) error) error {
+	client, err := l.current()
+	if err != nil {
+		return err
+	}
+	return client.Dedicated(fn)
+}
+
+func (l *lazyClient) Dedicate() (rueidis.DedicatedClient, func()) {
+	client, err := l.current()
+	if err != nil {
+		return &failedDedicatedClient{builder: l.builder, err: err}, func() {}
+	}
+	return client.Dedicate()
+}
+
+// Nodes is empty until connected.
+func (l *lazyClient) Nodes() map[string]rueidis.Client {
+	client, _ := l.current()
+	if client == nil {
+		return map[string]rueidis.Client{}
+	}
+	return client.Nodes()
+}
+
+// Mode is empty until connected.
+func (l *lazyClient) Mode() rueidis.ClientMode {
+	client, _ := l.current()
+	if client == nil {
+		return ""
+	}
+	return client.Mode()
+}
+
+// Close stops connecting and closes the connected client.
+func (l *lazyClient) Close() {
+	l.stopConnecting()
+	if client, _ := l.current(); client != nil {
+		client.Close()
+	}
+}
+
+// stopConnecting stops the background connection, waiting for a pending attempt.
+func (l *lazyClient) stopConnecting() {
+	l.mu.Lock()
+	l.closed = true
+	l.mu.Unlock()
+	l.stop()
+	<-l.done
+}
+
+// errPlaceholderDial fails every dial of the placeholder client of notReadyBuilder.
+var errPlaceholderDial = errors.New("placeholder client never connects")
+
+// notReadyBuilder returns the builder of a standalone client, computing no
+// hash slots. rueidis only hands out builders from clients, so it comes from
+// a single client whose dial always fails, closed right away.
+func notReadyBuilder() rueidis.Builder {
+	client, err := rueidis.NewClient(rueidis.ClientOption{
+		InitAddress:       []string{"placeholder:6379"},
+		ForceSingleClient: true,
+		DialCtxFn: func(context.Context, string, *net.Dialer, *tls.Config) (net.Conn, error) {
+			return nil, errPlaceholderDial
+		},
+	})
+	if client == nil {
+		panic(fmt.Sprintf("redis_cache: failed to create the placeholder client: %v", err))
+	}
+	defer client.Close()
+	return client.B()
+}
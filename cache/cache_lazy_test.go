@@ -0,0 +1,170 @@
+package redis_cache
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/alicebob/miniredis/v2"
+	"github.com/redis/rueidis"
+)
+
+func TestNotReadyBuilder(t *testing.T) {
+	// Keys of different hash slots, a builder computing slots panics
+	builder := notReadyBuilder()
+	cmd := builder.Del().Key("a", "b").Build()
+	if got := cmd.Commands(); len(got) != 3 || got[0] != "DEL" {
+		t.Errorf("Commands() = %v, want DEL a b", got)
+	}
+	// The placeholder client is closed, its builder keeps working
+	cached := builder.Mget().Key("a", "b").Cache()
+	if got := cached.Commands(); len(got) != 3 || got[0] != "MGET" {
+		t.Errorf("Commands() = %v, want MGET a b", got)
+	}
+}
+
+// freeAddr returns the address of a port nothing listens on.
+func freeAddr(t *testing.T) string {
+	s, err := miniredis.Run()
+	if err != nil {
+		t.Fatalf("Failed to start miniredis: %v", err)
+	}
+	addr := s.Addr()
+	s.Close()
+	return addr
+}
+
+// setupLazyClient returns a lazy client of addr, retrying every 10 to 50ms.
+func setupLazyClient(t *testing.T, addr string, settings string) rueidis.Client {
+	host, port, err := net.SplitHostPort(addr)
+	if err != nil {
+		t.Fatalf("Invalid address %s: %v", addr, err)
+	}
+	config := fmt.Sprintf("cache:\n  usage_cache_db:\n    host: %q\n    port: %q\n    connection_mode: pool\n    lazy_connect:\n      enabled: true\n      base_backoff: 10ms\n      max_backoff: 50ms\n", host, port) + settings
+	configPath := filepath.Join(t.TempDir(), "lazy_config.yaml")
+	if err := os.WriteFile(configPath, []byte(config), 0644); err != nil {
+		t.Fatalf("Failed to write test config file: %v", err)
+	}
+	client, err := InitializeCacheConnection(configPath)
+	if err != nil {
+		t.Fatalf("InitializeCacheConnection() error = %v, want a lazy client", err)
+	}
+	return client
+}
+
+func TestLazyConnect(t *testing.T) {
+	// Redis is only started once the client is created
+	addr := freeAddr(t)
+	client := setupLazyClient(t, addr, "")
+	defer Close(client)
+
+	ctx := context.Background()
+	if err := SetStringDataToCacheWithExpiry(ctx, client, "lazy-key", "value", NoExpiry()); !errors.Is(err, ErrNotReady) {
+		t.Errorf("SetStringDataToCacheWithExpiry() before connecting error = %v, want ErrNotReady", err)
+	}
+	if _, err := GetStringDataFromCache(ctx, client, "lazy-key"); !errors.Is(err, ErrNotReady) {
+		t.Errorf("GetStringDataFromCache() before connecting error = %v, want ErrNotReady", err)
+	}
+	stream := client.DoStream(ctx, client.B().Get().Key("lazy-key").Build())
+	if stream.HasNext() || !errors.Is(stream.Error(), ErrNotReady) {
+		t.Errorf("DoStream() before connecting HasNext = %v, Error = %v, want a stream failing with ErrNotReady", stream.HasNext(), stream.Error())
+	}
+	// Wait for a failed attempt, reported by ReadyErr
+	deadline := time.Now().Add(5 * time.Second)
+	for ReadyErr(client) == ErrNotReady && time.Now().Before(deadline) {
+		time.Sleep(5 * time.Millisecond)
+	}
+	if err := ReadyErr(client); !errors.Is(err, ErrNotReady) || err == ErrNotReady {
+		t.Errorf("ReadyErr() before connecting = %v, want ErrNotReady with the last connection error", err)
+	}
+	if stats := GetRetryStats(client); stats.Retries != 0 || stats.Skipped != 0 {
+		t.Errorf("GetRetryStats() = %+v, want ErrNotReady not to be retried", stats)
+	}
+	select {
+	case <-Ready(client):
+		t.Fatal("Expected Ready() to stay open until Redis is up")
+	default:
+	}
+
+	s := miniredis.NewMiniRedis()
+	if err := s.StartAddr(addr); err != nil {
+		t.Fatalf("Failed to start miniredis on %s: %v", addr, err)
+	}
+	defer s.Close()
+
+	select {
+	case <-Ready(client):
+	case <-time.After(5 * time.Second):
+		t.Fatalf("Expected the client to connect once Redis is up, ReadyErr() = %v", ReadyErr(client))
+	}
+	if err := ReadyErr(client); err != nil {
+		t.Errorf("ReadyErr() once connected = %v", err)
+	}
+	if err := SetStringDataToCacheWithExpiry(ctx, client, "lazy-key", "value", NoExpiry()); err != nil {
+		t.Errorf("SetStringDataToCacheWithExpiry() once connected error = %v", err)
+	}
+	if value, err := GetStringDataFromCache(ctx, client, "lazy-key"); err != nil || value != "value" {
+		t.Errorf("GetStringDataFromCache() once connected = %q, %v", value, err)
+	}
+}
+
+func TestLazyConnectClose(t *testing.T) {
+	client := setupLazyClient(t, freeAddr(t), "")
+
+	done := make(chan struct{})
+	go func() {
+		Close(client)
+		close(done)
+	}()
+	select {
+	case <-done:
+	case <-time.After(5 * time.Second):
+		t.Fatal("Expected Close() to stop connecting")
+	}
+
+	if err := ReadyErr(client); !errors.Is(err, rueidis.ErrClosing) {
+		t.Errorf("ReadyErr() after Close() = %v, want ErrClosing", err)
+	}
+	select {
+	case <-Ready(client):
+		t.Error("Expected Ready() never to be closed")
+	default:
+	}
+}
+
+func TestLazyConnectFallback(t *testing.T) {
+	client := setupLazyClient(t, freeAddr(t), `
+    fallback:
+      enabled: true
+      failure_threshold: 1
+`)
+	defer Close(client)
+
+	// Until connected, the fallback serves the calls once past the threshold
+	ctx := context.Background()
+	if err := SetStringDataToCacheWithExpiry(ctx, client, "lazy-key", "local", NoExpiry()); err != nil {
+		t.Errorf("SetStringDataToCacheWithExpiry() error = %v, want the local store to be used", err)
+	}
+	if value, err := GetStringDataFromCache(ctx, client, "lazy-key"); err != nil || value != "local" {
+		t.Errorf("GetStringDataFromCache() = %q, %v, want the local value", value, err)
+	}
+}
+
+func TestReadyConnectedClient(t *testing.T) {
+	client := setupTestClient(t)
+	defer Close(client)
+
+	select {
+	case <-Ready(client):
+	default:
+		t.Error("Expected Ready() to be closed for a client connected on creation")
+	}
+	if err := ReadyErr(client); err != nil {
+		t.Errorf("ReadyErr() = %v, want nil", err)
+	}
+}
@@ -0,0 +1,194 @@
+package redis_cache
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"github.com/redis/rueidis"
+)
+
+// This file contains the following methods for lists :
+// 1. Methods to push and pop on both ends of a list
+// 2. Methods to read a range of a list and trim it
+// 3. Methods to block on a pop until an element arrives, the timeout elapses or ctx is done
+// 4. Queue, a FIFO work queue of structured payloads encoded with a Codec
+
+// ListEnd selects the end of a list an operation works on.
+type ListEnd int
+
+const (
+	ListHead ListEnd = iota // the left end, LPUSH / LPOP
+	ListTail                // the right end, RPUSH / RPOP
+)
+
+// PushToList pushes values onto the given end of the list and returns the new length.
+func PushToList(ctx context.Context, client rueidis.Client, key string, end ListEnd, values ...string) (int64, error) {
+	if len(values) == 0 {
+		return 0, fmt.Errorf("at least one value is required")
+	}
+
+	key = namespacedKey(client, key)
+	var cmd rueidis.Completed
+	if end == ListHead {
+		cmd = client.B().Lpush().Key(key).Element(values...).Build()
+	} else {
+		cmd = client.B().Rpush().Key(key).Element(values...).Build()
+	}
+
+	length, err := client.Do(ctx, cmd).AsInt64()
+	if err != nil {
+		return 0, fmt.Errorf("failed to push data to list: %w", err)
+	}
+	return length, nil
+}
+
+// PopFromList pops a value from the given end of the list.
+// It returns false when the list is empty or does not exist.
+func PopFromList(ctx context.Context, client rueidis.Client, key string, end ListEnd) (string, bool, error) {
+	key = namespacedKey(client, key)
+	var cmd rueidis.Completed
+	if end == ListHead {
+		cmd = client.B().Lpop().Key(key).Build()
+	} else {
+		cmd = client.B().Rpop().Key(key).Build()
+	}
+
+	value, err := client.Do(ctx, cmd).ToString()
+	if err != nil {
+		if rueidis.IsRedisNil(err) {
+			return "", false, nil
+		}
+		return "", false, fmt.Errorf("failed to pop data from list: %w", err)
+	}
+	return value, true, nil
+}
+
+// BlockingPopFromList pops a value from the given end of the first non-empty list
+// among keys, waiting up to timeout for one to arrive. A timeout of 0 waits until
+// ctx is done. It returns the key the value was popped from, without namespace,
+// and false when the timeout elapsed.
+func BlockingPopFromList(ctx context.Context, client rueidis.Client, timeout time.Duration, end ListEnd, keys ...string) (string, string, bool, error) {
+	if len(keys) == 0 {
+		return "", "", false, fmt.Errorf("at least one key is required")
+	}
+	if timeout < 0 {
+		return "", "", false, fmt.Errorf("timeout must not be negative")
+	}
+
+	namespaced := namespacedKeys(client, keys)
+	var cmd rueidis.Completed
+	if end == ListHead {
+		cmd = client.B().Blpop().Key(namespaced...).Timeout(timeout.Seconds()).Build()
+	} else {
+		cmd = client.B().Brpop().Key(namespaced...).Timeout(timeout.Seconds()).Build()
+	}
+
+	resp, err := client.Do(ctx, cmd).AsStrSlice()
+	if err != nil {
+		if rueidis.IsRedisNil(err) {
+			return "", "", false, nil
+		}
+		return "", "", false, fmt.Errorf("failed to pop data from list: %w", err)
+	}
+	if len(resp) != 2 {
+		return "", "", false, fmt.Errorf("failed to pop data from list: unexpected reply %v", resp)
+	}
+
+	// Report the caller's key rather than the namespaced one
+	for i, key := range namespaced {
+		if key == resp[0] {
+			return keys[i], resp[1], true, nil
+		}
+	}
+	return resp[0], resp[1], true, nil
+}
+
+// GetListRange returns the elements between start and stop, both inclusive.
+// Negative indexes count from the tail, so 0, -1 returns the whole list.
+func GetListRange(ctx context.Context, client rueidis.Client, key string, start int64, stop int64) ([]string, error) {
+	values, err := client.Do(ctx, client.B().Lrange().Key(namespacedKey(client, key)).Start(start).Stop(stop).Build()).AsStrSlice()
+	if err != nil {
+		return nil, fmt.Errorf("failed to get list range from cache: %w", err)
+	}
+	return values, nil
+}
+
+// TrimList keeps only the elements between start and stop, both inclusive.
+func TrimList(ctx context.Context, client rueidis.Client, key string, start int64, stop int64) error {
+	if err := client.Do(ctx, client.B().Ltrim().Key(namespacedKey(client, key)).Start(start).Stop(stop).Build()).Error(); err != nil {
+		return fmt.Errorf("failed to trim list: %w", err)
+	}
+	return nil
+}
+
+// GetListLength returns the number of elements in the list.
+func GetListLength(ctx context.Context, client rueidis.Client, key string) (int64, error) {
+	length, err := client.Do(ctx, client.B().Llen().Key(namespacedKey(client, key)).Build()).AsInt64()
+	if err != nil {
+		return 0, fmt.Errorf("failed to get list length: %w", err)
+	}
+	return length, nil
+}
+
+// Queue is a FIFO work queue of T stored in a Redis list. Producers push to
+// the tail and consumers pop from the head. Payloads are encoded with Codec.
+type Queue[T any] struct {
+	client rueidis.Client
+	key    string
+
+	// Codec encodes the payloads, DefaultCodec when nil.
+	Codec Codec
+}
+
+// NewQueue returns a queue of T stored under key.
+func NewQueue[T any](client rueidis.Client, key string) *Queue[T] {
+	return &Queue[T]{client: client, key: key}
+}
+
+// Push appends items to the tail of the queue and returns the new length.
+func (q *Queue[T]) Push(ctx context.Context, items ...T) (int64, error) {
+	values := make([]string, len(items))
+	for i, item := range items {
+		value, err := encodeValue(q.Codec, item)
+		if err != nil {
+			return 0, fmt.Errorf("failed to encode queue item: %v", err)
+		}
+		values[i] = value
+	}
+	return PushToList(ctx, q.client, q.key, ListTail, values...)
+}
+
+// Pop removes the item at the head of the queue. It returns false when the queue is empty.
+func (q *Queue[T]) Pop(ctx context.Context) (T, bool, error) {
+	var item T
+	value, ok, err := PopFromList(ctx, q.client, q.key, ListHead)
+	if err != nil || !ok {
+		return item, ok, err
+	}
+	item, err = decodeValue[T](q.Codec, value)
+	if err != nil {
+		return item, false, fmt.Errorf("failed to decode queue item: %v", err)
+	}
+	return item, true, nil
+}
+
+// BlockingPop waits up to timeout for an item, 0 waits until ctx is done.
+// It returns false when the timeout elapsed without an item.
+func (q *Queue[T]) BlockingPop(ctx context.Context, timeout time.Duration) (T, bool, error) {
+	var item T
+	_, value, ok, err := BlockingPopFromList(ctx, q.client, timeout, ListHead, q.key)
+	if err != nil || !ok {
+		return item, ok, err
+	}
+	item, err = decodeValue[T](q.Codec, value)
+	if err != nil {
+		return item, false, fmt.Errorf("failed to decode queue item: %v", err)
+	}
+	return item, true, nil
+}
+
+// Len returns the number of items waiting in the queue.
+func (q *Queue[T]) Len(ctx context.Context) (int64, error) {
+	return GetListLength(ctx, q.client, q.key)
+}
@@ -0,0 +1,196 @@
+package redis_cache
+
+import (
+	"context"
+	"errors"
+	"reflect"
+	"testing"
+	"time"
+)
+
+type testJob struct {
+	ID   int
+	Name string
+}
+
+func TestPushPopRangeAndTrimList(t *testing.T) {
+	client := setupTestClient(t)
+	defer Close(client)
+
+	ctx := context.Background()
+	key := "list-key-1"
+
+	if _, err := PushToList(ctx, client, key, ListTail, "b", "c"); err != nil {
+		t.Fatalf("PushToList() tail error = %v", err)
+	}
+	length, err := PushToList(ctx, client, key, ListHead, "a")
+	if err != nil {
+		t.Fatalf("PushToList() head error = %v", err)
+	}
+	if length != 3 {
+		t.Errorf("PushToList() = %d, want 3", length)
+	}
+
+	got, err := GetListRange(ctx, client, key, 0, -1)
+	if err != nil {
+		t.Fatalf("GetListRange() error = %v", err)
+	}
+	if !reflect.DeepEqual(got, []string{"a", "b", "c"}) {
+		t.Errorf("GetListRange() = %v, want [a b c]", got)
+	}
+
+	if err := TrimList(ctx, client, key, 0, 1); err != nil {
+		t.Fatalf("TrimList() error = %v", err)
+	}
+
+	tail, ok, err := PopFromList(ctx, client, key, ListTail)
+	if err != nil || !ok || tail != "b" {
+		t.Errorf("PopFromList() tail = %v, %v, %v, want b, true, nil", tail, ok, err)
+	}
+	head, ok, err := PopFromList(ctx, client, key, ListHead)
+	if err != nil || !ok || head != "a" {
+		t.Errorf("PopFromList() head = %v, %v, %v, want a, true, nil", head, ok, err)
+	}
+	_, ok, err = PopFromList(ctx, client, key, ListHead)
+	if err != nil || ok {
+		t.Errorf("PopFromList() on empty list = %v, %v, want false, nil", ok, err)
+	}
+}
+
+func TestBlockingPopFromList(t *testing.T) {
+	client := setupTestClient(t)
+	defer Close(client)
+
+	ctx := context.Background()
+
+	if _, err := PushToList(ctx, client, "{list-blocking}:2", ListTail, "job"); err != nil {
+		t.Fatalf("PushToList() error = %v", err)
+	}
+	key, value, ok, err := BlockingPopFromList(ctx, client, time.Second, ListHead, "{list-blocking}:1", "{list-blocking}:2")
+	if err != nil || !ok {
+		t.Fatalf("BlockingPopFromList() = %v, %v, want true, nil", ok, err)
+	}
+	if key != "{list-blocking}:2" || value != "job" {
+		t.Errorf("BlockingPopFromList() = %v, %v, want {list-blocking}:2, job", key, value)
+	}
+
+	// Cancelling the context stops a consumer waiting forever
+	cancelCtx, cancel := context.WithTimeout(ctx, 200*time.Millisecond)
+	defer cancel()
+	_, _, ok, err = BlockingPopFromList(cancelCtx, client, 0, ListHead, "{list-blocking}:1")
+	if ok || err == nil {
+		t.Errorf("BlockingPopFromList() after cancel = %v, %v, want false and an error", ok, err)
+	}
+	if !errors.Is(err, context.DeadlineExceeded) && cancelCtx.Err() == nil {
+		t.Errorf("Expected the context to be done, got %v", err)
+	}
+}
+
+func TestQueue(t *testing.T) {
+	client := setupTestClient(t)
+	defer Close(client)
+
+	ctx := context.Background()
+	queue := NewQueue[testJob](client, "queue-key-1")
+
+	jobs := []testJob{{ID: 1, Name: "first"}, {ID: 2, Name: "second"}}
+	if _, err := queue.Push(ctx, jobs...); err != nil {
+		t.Fatalf("Queue.Push() error = %v", err)
+	}
+
+	first, ok, err := queue.Pop(ctx)
+	if err != nil || !ok || first != jobs[0] {
+		t.Errorf("Queue.Pop() = %+v, %v, %v, want %+v", first, ok, err, jobs[0])
+	}
+	second, ok, err := queue.BlockingPop(ctx, time.Second)
+	if err != nil || !ok || second != jobs[1] {
+		t.Errorf("Queue.BlockingPop() = %+v, %v, %v, want %+v", second, ok, err, jobs[1])
+	}
+}
+
+func TestReliableQueue(t *testing.T) {
+	client := setupTestClient(t)
+	defer Close(client)
+
+	ctx := context.Background()
+	if _, err := NewReliableQueue[testJob](client, "reliable-queue-1", 0); err == nil {
+		t.Errorf("NewReliableQueue() with no visibility error = nil, want an error")
+	}
+	queue, err := NewReliableQueue[testJob](client, "reliable-queue-1", 100*time.Millisecond)
+	if err != nil {
+		t.Fatalf("NewReliableQueue() error = %v", err)
+	}
+
+	if _, err := queue.Push(ctx, testJob{ID: 1, Name: "done"}, testJob{ID: 2, Name: "abandoned"}); err != nil {
+		t.Fatalf("ReliableQueue.Push() error = %v", err)
+	}
+
+	done, err := queue.Reserve(ctx, time.Second)
+	if err != nil || done == nil || done.Value.ID != 1 {
+		t.Fatalf("ReliableQueue.Reserve() = %+v, %v, want job 1", done, err)
+	}
+	if err := queue.Ack(ctx, done); err != nil {
+		t.Fatalf("ReliableQueue.Ack() error = %v", err)
+	}
+	if err := queue.Ack(ctx, done); !errors.Is(err, ErrItemNotReserved) {
+		t.Errorf("ReliableQueue.Ack() twice error = %v, want ErrItemNotReserved", err)
+	}
+
+	abandoned, err := queue.TryReserve(ctx)
+	if err != nil || abandoned == nil || abandoned.Value.ID != 2 {
+		t.Fatalf("ReliableQueue.TryReserve() = %+v, %v, want job 2", abandoned, err)
+	}
+	if processing, _ := queue.Processing(ctx); processing != 1 {
+		t.Errorf("ReliableQueue.Processing() = %d, want 1", processing)
+	}
+
+	// The lease is still valid, nothing is reaped
+	if requeued, err := queue.Reap(ctx); err != nil || requeued != 0 {
+		t.Errorf("ReliableQueue.Reap() before expiry = %d, %v, want 0, nil", requeued, err)
+	}
+
+	time.Sleep(200 * time.Millisecond)
+	if requeued, err := queue.Reap(ctx); err != nil || requeued != 1 {
+		t.Errorf("ReliableQueue.Reap() after expiry = %d, %v, want 1, nil", requeued, err)
+	}
+	if err := queue.Ack(ctx, abandoned); !errors.Is(err, ErrItemNotReserved) {
+		t.Errorf("ReliableQueue.Ack() of a requeued item error = %v, want ErrItemNotReserved", err)
+	}
+
+	again, err := queue.TryReserve(ctx)
+	if err != nil || again == nil || again.ID != abandoned.ID {
+		t.Fatalf("ReliableQueue.TryReserve() after reap = %+v, %v, want the abandoned item", again, err)
+	}
+	// A late Ack of the expired reservation leaves the new one alone
+	if err := queue.Ack(ctx, abandoned); !errors.Is(err, ErrItemNotReserved) {
+		t.Errorf("ReliableQueue.Ack() of an expired reservation error = %v, want ErrItemNotReserved", err)
+	}
+	if processing, _ := queue.Processing(ctx); processing != 1 {
+		t.Errorf("ReliableQueue.Processing() after a late Ack = %d, want 1", processing)
+	}
+	if err := queue.Nack(ctx, again); err != nil {
+		t.Fatalf("ReliableQueue.Nack() error = %v", err)
+	}
+	if length, _ := queue.Len(ctx); length != 1 {
+		t.Errorf("ReliableQueue.Len() after Nack = %d, want 1", length)
+	}
+	if err := queue.Ack(ctx, again); !errors.Is(err, ErrItemNotReserved) {
+		t.Errorf("ReliableQueue.Ack() of a nacked item error = %v, want ErrItemNotReserved", err)
+	}
+
+	again, err = queue.TryReserve(ctx)
+	if err != nil || again == nil || again.ID != abandoned.ID {
+		t.Fatalf("ReliableQueue.TryReserve() after Nack = %+v, %v, want the nacked item", again, err)
+	}
+	if err := queue.Ack(ctx, again); err != nil {
+		t.Fatalf("ReliableQueue.Ack() error = %v", err)
+	}
+
+	empty, err := queue.TryReserve(ctx)
+	if err != nil || empty != nil {
+		t.Errorf("ReliableQueue.TryReserve() on empty queue = %+v, %v, want nil, nil", empty, err)
+	}
+	if err := queue.RunReaper(ctx, 0); err == nil {
+		t.Errorf("ReliableQueue.RunReaper() with no interval error = nil, want an error")
+	}
+}
@@ -0,0 +1,222 @@
+package redis_cache
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/redis/rueidis"
+)
+
+// This file contains the distributed lock built on the package's client :
+// 1. Acquire with SET NX PX and a random owner token, in try-lock or blocking mode
+// 2. A monotonically increasing fencing token handed out on every acquire
+// 3. A watchdog goroutine that extends the lease while the holder's context is alive
+// 4. Release with a compare-and-delete Lua script, so only the owner can unlock
+
+var (
+	// ErrLockNotAcquired is returned when the lock is held by someone else.
+	ErrLockNotAcquired = errors.New("lock not acquired")
+	// ErrLockNotHeld is returned when releasing a lock whose lease was lost.
+	ErrLockNotHeld = errors.New("lock not held")
+)
+
+// acquireScript sets the lock and bumps the fencing counter in one step.
+// KEYS[1] is the lock, KEYS[2] the fencing counter.
+// ARGV[1] is the owner token, ARGV[2] the lease in milliseconds.
+var acquireScript = rueidis.NewLuaScript(`
+if redis.call('SET', KEYS[1], ARGV[1], 'NX', 'PX', ARGV[2]) then
+	return redis.call('INCR', KEYS[2])
+end
+return false
+`)
+
+// extendScript extends the lease when the lock is still held by ARGV[1].
+var extendScript = rueidis.NewLuaScript(`
+if redis.call('GET', KEYS[1]) == ARGV[1] then
+	return redis.call('PEXPIRE', KEYS[1], ARGV[2])
+end
+return 0
+`)
+
+// releaseScript deletes the lock when it is still held by ARGV[1].
+var releaseScript = rueidis.NewLuaScript(`
+if redis.call('GET', KEYS[1]) == ARGV[1] then
+	return redis.call('DEL', KEYS[1])
+end
+return 0
+`)
+
+// LockOptions tunes a lock. The zero value uses the defaults below.
+type LockOptions struct {
+	// TTL is the lease, the lock expires on its own if the holder dies. Defaults to 10s.
+	TTL time.Duration
+	// RenewInterval is how often the watchdog extends the lease. Defaults to TTL/3.
+	RenewInterval time.Duration
+	// RetryInterval is how often a blocking acquire retries. Defaults to 50ms.
+	RetryInterval time.Duration
+}
+
+func (o LockOptions) withDefaults() LockOptions {
+	if o.TTL <= 0 {
+		o.TTL = 10 * time.Second
+	}
+	if o.RenewInterval <= 0 {
+		o.RenewInterval = o.TTL / 3
+	}
+	if o.RetryInterval <= 0 {
+		o.RetryInterval = 50 * time.Millisecond
+	}
+	return o
+}
+
+// Lock is a held distributed lock.
+type Lock struct {
+	client rueidis.Client
+	keys   []string
+	owner  string
+	fence  int64
+	opts   LockOptions
+
+	stopOnce sync.Once
+	stop     chan struct{}
+	done     chan struct{}
+	lost     chan struct{}
+}
+
+// lockKeys returns the lock and fencing counter keys, sharing a hash tag so
+// both live in the same cluster slot.
+func lockKeys(client rueidis.Client, key string) []string {
+	tagged := "{" + key + "}"
+	return namespacedKeys(client, []string{tagged + KeySeparator + "lock", tagged + KeySeparator + "fence"})
+}
+
+// TryAcquireLock acquires the lock once and returns ErrLockNotAcquired when it is held
+// by someone else. The lease is extended in the background until Unlock is called
+// or ctx is done, after which it simply expires.
+func TryAcquireLock(ctx context.Context, client rueidis.Client, key string, opts LockOptions) (*Lock, error) {
+	opts = opts.withDefaults()
+	owner, err := newRandomToken()
+	if err != nil {
+		return nil, err
+	}
+
+	keys := lockKeys(client, key)
+	ttl := strconv.FormatInt(opts.TTL.Milliseconds(), 10)
+	fence, err := acquireScript.Exec(ctx, client, keys, []string{owner, ttl}).AsInt64()
+	if err != nil {
+		if rueidis.IsRedisNil(err) {
+			return nil, ErrLockNotAcquired
+		}
+		return nil, fmt.Errorf("failed to acquire lock: %w", err)
+	}
+
+	l := &Lock{
+		client: client,
+		keys:   keys,
+		owner:  owner,
+		fence:  fence,
+		opts:   opts,
+		stop:   make(chan struct{}),
+		done:   make(chan struct{}),
+		lost:   make(chan struct{}),
+	}
+	// Shutdown waits for held locks, their lease is still extended until unlocked (see cache_shutdown.go)
+	optionsOf(client).life.spawn(workHeldLocks, func() {
+		l.watchdog(inFlight(ctx))
+	})
+	return l, nil
+}
+
+// AcquireLock retries TryAcquireLock until the lock is acquired, timeout elapses
+// or ctx is done. A timeout of 0 waits until ctx is done.
+func AcquireLock(ctx context.Context, client rueidis.Client, key string, timeout time.Duration, opts LockOptions) (*Lock, error) {
+	opts = opts.withDefaults()
+	var deadline <-chan time.Time
+	if timeout > 0 {
+		timer := time.NewTimer(timeout)
+		defer timer.Stop()
+		deadline = timer.C
+	}
+
+	for {
+		l, err := TryAcquireLock(ctx, client, key, opts)
+		if !errors.Is(err, ErrLockNotAcquired) {
+			return l, err
+		}
+		select {
+		case <-ctx.Done():
+			return nil, ctx.Err()
+		case <-deadline:
+			return nil, ErrLockNotAcquired
+		case <-time.After(opts.RetryInterval):
+		}
+	}
+}
+
+// FencingToken returns the token handed out when the lock was acquired. Tokens
+// only ever increase, so a storage layer can reject writes carrying an older one.
+func (l *Lock) FencingToken() int64 {
+	return l.fence
+}
+
+// Lost is closed when the watchdog finds the lease taken over or expired.
+func (l *Lock) Lost() <-chan struct{} {
+	return l.lost
+}
+
+// Unlock stops the watchdog and releases the lock. It returns ErrLockNotHeld
+// when the lease had already been lost.
+func (l *Lock) Unlock(ctx context.Context) error {
+	// Releasing is allowed while the client is shutting down, and waited for
+	// past the end of the watchdog
+	ctx = inFlight(ctx)
+	life := optionsOf(l.client).life
+	life.begin(ctx, workHeldLocks)
+	defer life.end(workHeldLocks)
+
+	l.stopOnce.Do(func() { close(l.stop) })
+	<-l.done
+
+	released, err := releaseScript.Exec(ctx, l.client, l.keys[:1], []string{l.owner}).AsInt64()
+	if err != nil {
+		return fmt.Errorf("failed to release lock: %w", err)
+	}
+	if released == 0 {
+		return ErrLockNotHeld
+	}
+	return nil
+}
+
+// watchdog extends the lease every RenewInterval while ctx is alive. If the
+// lease can not be extended before it runs out, the lock is reported as lost.
+func (l *Lock) watchdog(ctx context.Context) {
+	defer close(l.done)
+
+	ticker := time.NewTicker(l.opts.RenewInterval)
+	defer ticker.Stop()
+
+	expiresAt := time.Now().Add(l.opts.TTL)
+	ttl := strconv.FormatInt(l.opts.TTL.Milliseconds(), 10)
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-l.stop:
+			return
+		case <-ticker.C:
+			renewedAt := time.Now()
+			extended, err := extendScript.Exec(ctx, l.client, l.keys[:1], []string{l.owner, ttl}).AsInt64()
+			switch {
+			case err == nil && extended == 1:
+				expiresAt = renewedAt.Add(l.opts.TTL)
+			case err == nil || time.Now().After(expiresAt):
+				close(l.lost)
+				return
+			}
+		}
+	}
+}
@@ -0,0 +1,104 @@
+package redis_cache
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+)
+
+func TestTryAcquireLock(t *testing.T) {
+	client := setupTestClient(t)
+	defer Close(client)
+
+	ctx := context.Background()
+	key := "lock-try-1"
+
+	first, err := TryAcquireLock(ctx, client, key, LockOptions{TTL: time.Second})
+	if err != nil {
+		t.Fatalf("TryAcquireLock() error = %v", err)
+	}
+
+	if _, err := TryAcquireLock(ctx, client, key, LockOptions{TTL: time.Second}); !errors.Is(err, ErrLockNotAcquired) {
+		t.Errorf("TryAcquireLock() on a held lock error = %v, want %v", err, ErrLockNotAcquired)
+	}
+
+	if err := first.Unlock(ctx); err != nil {
+		t.Fatalf("Unlock() error = %v", err)
+	}
+	if err := first.Unlock(ctx); !errors.Is(err, ErrLockNotHeld) {
+		t.Errorf("Unlock() twice error = %v, want %v", err, ErrLockNotHeld)
+	}
+
+	second, err := TryAcquireLock(ctx, client, key, LockOptions{TTL: time.Second})
+	if err != nil {
+		t.Fatalf("TryAcquireLock() after unlock error = %v", err)
+	}
+	defer second.Unlock(ctx)
+
+	if second.FencingToken() <= first.FencingToken() {
+		t.Errorf("FencingToken() = %d, want greater than %d", second.FencingToken(), first.FencingToken())
+	}
+}
+
+func TestAcquireLockBlocking(t *testing.T) {
+	client := setupTestClient(t)
+	defer Close(client)
+
+	ctx := context.Background()
+	key := "lock-blocking-1"
+
+	held, err := TryAcquireLock(ctx, client, key, LockOptions{TTL: time.Second})
+	if err != nil {
+		t.Fatalf("TryAcquireLock() error = %v", err)
+	}
+
+	if _, err := AcquireLock(ctx, client, key, 150*time.Millisecond, LockOptions{}); !errors.Is(err, ErrLockNotAcquired) {
+		t.Errorf("AcquireLock() before release error = %v, want %v", err, ErrLockNotAcquired)
+	}
+
+	go func() {
+		time.Sleep(100 * time.Millisecond)
+		held.Unlock(ctx)
+	}()
+
+	waiter, err := AcquireLock(ctx, client, key, 2*time.Second, LockOptions{TTL: time.Second})
+	if err != nil {
+		t.Fatalf("AcquireLock() after release error = %v", err)
+	}
+	if err := waiter.Unlock(ctx); err != nil {
+		t.Errorf("Unlock() error = %v", err)
+	}
+}
+
+func TestLockWatchdog(t *testing.T) {
+	client := setupTestClient(t)
+	defer Close(client)
+
+	ctx := context.Background()
+	key := "lock-watchdog-1"
+
+	l, err := TryAcquireLock(ctx, client, key, LockOptions{TTL: 300 * time.Millisecond})
+	if err != nil {
+		t.Fatalf("TryAcquireLock() error = %v", err)
+	}
+
+	// The watchdog keeps the lease alive well past its TTL
+	time.Sleep(time.Second)
+	if _, err := TryAcquireLock(ctx, client, key, LockOptions{}); !errors.Is(err, ErrLockNotAcquired) {
+		t.Errorf("TryAcquireLock() while renewed error = %v, want %v", err, ErrLockNotAcquired)
+	}
+
+	// Losing the key is reported on Lost
+	if _, err := DeleteDataFromCache(ctx, client, "{"+key+"}:lock"); err != nil {
+		t.Fatalf("DeleteDataFromCache() error = %v", err)
+	}
+	select {
+	case <-l.Lost():
+	case <-time.After(time.Second):
+		t.Fatal("Expected Lost() to be closed after the lock key was removed")
+	}
+	if err := l.Unlock(ctx); !errors.Is(err, ErrLockNotHeld) {
+		t.Errorf("Unlock() after loss error = %v, want %v", err, ErrLockNotHeld)
+	}
+}
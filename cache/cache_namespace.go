@@ -0,0 +1,79 @@
+package redis_cache
+
+import (
+	"strconv"
+	"strings"
+
+	"github.com/redis/rueidis"
+)
+
+// This file contains the key namespacing helpers :
+// 1. Namespace with a version segment, applied to every key the package touches
+// 2. Method to derive a client for another namespace sharing the same connections
+// 3. Method to build keys from parts with consistent escaping
+
+// KeySeparator separates the parts of a key built by BuildKey.
+const KeySeparator = ":"
+
+// Namespace prefixes every key read, written or deleted through a client.
+// Bumping Version changes the prefix, which invalidates the whole namespace
+// at once: the old keys are no longer reachable and simply expire.
+type Namespace struct {
+	Name    string
+	Version int
+}
+
+// prefix returns "<name>:v<version>:" or "" when no namespace is set.
+func (n Namespace) prefix() string {
+	if n.Name == "" {
+		return ""
+	}
+	return BuildKey(n.Name, "v"+strconv.Itoa(n.Version)) + KeySeparator
+}
+
+// keyEscaper escapes the separator, and the escape character itself, so a
+// part containing ":" can never be mistaken for two parts.
+var keyEscaper = strings.NewReplacer(`\`, `\\`, KeySeparator, `\`+KeySeparator)
+
+// BuildKey joins the parts with KeySeparator, escaping each part so that
+// BuildKey("a:b", "c") and BuildKey("a", "b:c") never collide.
+func BuildKey(parts ...string) string {
+	escaped := make([]string, len(parts))
+	for i, part := range parts {
+		escaped[i] = keyEscaper.Replace(part)
+	}
+	return strings.Join(escaped, KeySeparator)
+}
+
+// WithNamespace returns a client that shares the connections of client but
+// prefixes every key with the given namespace and version. Closing either
+// client closes the shared connections.
+func WithNamespace(client rueidis.Client, name string, version int) rueidis.Client {
+	opts := *optionsOf(client)
+	opts.namespace = Namespace{Name: name, Version: version}
+	if c, ok := client.(*cacheClient); ok {
+		client = c.Client
+	}
+	return &cacheClient{Client: client, opts: &opts}
+}
+
+// NamespacedKey returns key with the client's namespace prefix applied, for
+// packages that build their own commands on the module's client.
+func NamespacedKey(client rueidis.Client, key string) string {
+	return namespacedKey(client, key)
+}
+
+// namespacedKey returns key with the client's namespace prefix applied.
+func namespacedKey(client rueidis.Client, key string) string {
+	return optionsOf(client).namespace.prefix() + key
+}
+
+// namespacedKeys applies the client's namespace prefix to every key.
+func namespacedKeys(client rueidis.Client, keys []string) []string {
+	prefix := optionsOf(client).namespace.prefix()
+	prefixed := make([]string, len(keys))
+	for i, key := range keys {
+		prefixed[i] = prefix + key
+	}
+	return prefixed
+}
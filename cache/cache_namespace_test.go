@@ -0,0 +1,114 @@
+package redis_cache
+
+import (
+	"context"
+	"testing"
+)
+
+func TestBuildKey(t *testing.T) {
+	tests := []struct {
+		name  string
+		parts []string
+		want  string
+	}{
+		{
+			name:  "single part",
+			parts: []string{"user"},
+			want:  "user",
+		},
+		{
+			name:  "multiple parts",
+			parts: []string{"user", "42", "profile"},
+			want:  "user:42:profile",
+		},
+		{
+			name:  "separator is escaped",
+			parts: []string{"a:b", "c"},
+			want:  `a\:b:c`,
+		},
+		{
+			name:  "escape character is escaped",
+			parts: []string{`a\`, "b"},
+			want:  `a\\:b`,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := BuildKey(tt.parts...); got != tt.want {
+				t.Errorf("BuildKey() = %q, want %q", got, tt.want)
+			}
+		})
+	}
+
+	if BuildKey("a:b", "c") == BuildKey("a", "b:c") {
+		t.Error("BuildKey() produced the same key for different parts")
+	}
+}
+
+func TestNamespacedClients(t *testing.T) {
+	client := setupTestClient(t)
+	defer Close(client)
+
+	ctx := context.Background()
+	teamA := WithNamespace(client, "team-a", 1)
+	teamB := WithNamespace(client, "team-b", 1)
+
+	if err := SetStringDataToCacheWithExpiry(ctx, teamA, "shared-key", "a", NoExpiry()); err != nil {
+		t.Fatalf("SetStringDataToCacheWithExpiry() error = %v", err)
+	}
+	if err := SetStringDataToCacheWithExpiry(ctx, teamB, "shared-key", "b", NoExpiry()); err != nil {
+		t.Fatalf("SetStringDataToCacheWithExpiry() error = %v", err)
+	}
+
+	for _, tc := range []struct {
+		name string
+		want string
+	}{
+		{name: "team-a", want: "a"},
+		{name: "team-b", want: "b"},
+	} {
+		ns := WithNamespace(client, tc.name, 1)
+		got, err := GetStringDataFromCache(ctx, ns, "shared-key")
+		if err != nil {
+			t.Fatalf("GetStringDataFromCache() error = %v", err)
+		}
+		if got != tc.want {
+			t.Errorf("GetStringDataFromCache() in %s = %v, want %v", tc.name, got, tc.want)
+		}
+	}
+
+	// The raw key carries the namespace and version prefix
+	raw, err := GetStringDataFromCache(ctx, client, "team-a:v1:shared-key")
+	if err != nil {
+		t.Fatalf("GetStringDataFromCache() error = %v", err)
+	}
+	if raw != "a" {
+		t.Errorf("Expected raw key team-a:v1:shared-key to hold %q, got %q", "a", raw)
+	}
+
+	// Bumping the version hides every key of the old version
+	bumped := WithNamespace(client, "team-a", 2)
+	got, err := GetStringDataFromCache(ctx, bumped, "shared-key")
+	if err != nil {
+		t.Fatalf("GetStringDataFromCache() error = %v", err)
+	}
+	if got != "" {
+		t.Errorf("Expected empty string after version bump, got %v", got)
+	}
+
+	deleted, err := DeleteDataFromCache(ctx, teamA, "shared-key")
+	if err != nil {
+		t.Fatalf("DeleteDataFromCache() error = %v", err)
+	}
+	if deleted != 1 {
+		t.Errorf("DeleteDataFromCache() = %d, want 1", deleted)
+	}
+	got, err = GetStringDataFromCache(ctx, teamB, "shared-key")
+	if err != nil {
+		t.Fatalf("GetStringDataFromCache() error = %v", err)
+	}
+	if got != "b" {
+		t.Errorf("Expected team-b key to survive team-a delete, got %v", got)
+	}
+}
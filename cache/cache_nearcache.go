@@ -0,0 +1,325 @@
+package redis_cache
+
+import (
+	"container/list"
+	"context"
+	"fmt"
+	"sync"
+	"time"
+
+	"github.com/redis/rueidis"
+)
+
+// This file contains the near cache, an in-process LRU in front of Redis :
+// 1. Reads are served from the local tier and fall back to the get functions of this package
+// 2. Writes and deletes go to Redis, then publish an invalidation so peers evict the key
+// 3. Both tiers have their own TTL, and the local tier is bounded in size
+//
+// Unlike server-assisted client side caching (disable_cache: false), this only
+// needs PUBLISH and SUBSCRIBE, so it also works behind proxies that do not
+// support CLIENT TRACKING. Invalidations published while an instance is
+// reconnecting are lost, so LocalTTL bounds how long a peer can serve a stale value.
+
+// NearCacheOptions configures a NearCache.
+type NearCacheOptions struct {
+	// MaxEntries bounds the local tier, the least recently used entry is evicted first. 10000 by default.
+	MaxEntries int
+	// LocalTTL is how long an entry lives in the local tier, 1 minute by default.
+	// A shorter expiry given to a setter wins.
+	LocalTTL time.Duration
+	// Channel is the pub/sub channel invalidations are published on, "near-cache:invalidations" by default.
+	// Every instance sharing the keys must use the same channel.
+	Channel string
+	// OnError is called with the errors of the invalidation subscription.
+	OnError func(err error)
+}
+
+func (o *NearCacheOptions) setDefaults() {
+	if o.MaxEntries <= 0 {
+		o.MaxEntries = 10000
+	}
+	if o.LocalTTL <= 0 {
+		o.LocalTTL = time.Minute
+	}
+	if o.Channel == "" {
+		o.Channel = "near-cache:invalidations"
+	}
+}
+
+// nearCacheInvalidation is the message published when keys change.
+type nearCacheInvalidation struct {
+	Origin string
+	Keys   []string
+}
+
+type nearCacheEntry struct {
+	key       string
+	value     interface{}
+	expiresAt time.Time
+}
+
+// NearCache is a two-tier cache: a bounded in-process LRU in front of Redis,
+// kept coherent across instances with pub/sub invalidations.
+type NearCache struct {
+	client rueidis.Client
+	opts   NearCacheOptions
+	origin string
+
+	mu      sync.Mutex
+	entries map[string]*list.Element
+	lru     *list.List
+	// epoch is bumped on every invalidation, so a value read from Redis before
+	// an invalidation arrived is not stored locally after it
+	epoch uint64
+
+	ready     chan struct{}
+	readyOnce sync.Once
+	cancel    context.CancelFunc
+	sub       *Subscription
+}
+
+// NewNearCache returns a near cache on client, once it is subscribed to the
+// invalidations of its peers. ctx bounds the wait for the subscription, which
+// then runs until Close is called.
+func NewNearCache(ctx context.Context, client rueidis.Client, opts NearCacheOptions) (*NearCache, error) {
+	opts.setDefaults()
+	origin, err := newRandomToken()
+	if err != nil {
+		return nil, err
+	}
+
+	c := &NearCache{
+		client:  client,
+		opts:    opts,
+		origin:  origin,
+		entries: make(map[string]*list.Element),
+		lru:     list.New(),
+		ready:   make(chan struct{}),
+	}
+
+	subCtx, cancel := context.WithCancel(context.Background())
+	sub, err := SubscribeFunc(subCtx, client, SubscribeOptions{OnError: c.onSubscriptionError}, c.onInvalidation, opts.Channel)
+	if err != nil {
+		cancel()
+		return nil, fmt.Errorf("failed to subscribe to invalidations: %w", err)
+	}
+	c.cancel, c.sub = cancel, sub
+
+	// Subscribing is asynchronous, publish an empty invalidation until it comes back
+	for {
+		if err := c.publish(ctx, nil); err != nil {
+			c.Close()
+			return nil, err
+		}
+		select {
+		case <-c.ready:
+			return c, nil
+		case <-ctx.Done():
+			c.Close()
+			return nil, fmt.Errorf("failed to subscribe to invalidations: %v", ctx.Err())
+		case <-time.After(20 * time.Millisecond):
+		}
+	}
+}
+
+// GetString returns the value of key, from the local tier when present.
+// Like GetStringDataFromCache it returns "" when the key does not exist.
+func (c *NearCache) GetString(ctx context.Context, key string) (string, error) {
+	if value, ok := c.get(key).(string); ok {
+		return value, nil
+	}
+
+	epoch := c.currentEpoch()
+	value, err := GetStringDataFromCache(ctx, c.client, key)
+	if err != nil {
+		return "", err
+	}
+	if value != "" {
+		c.fill(key, value, c.opts.LocalTTL, epoch)
+	}
+	return value, nil
+}
+
+// SetString writes value to Redis, caches it locally and invalidates it on every peer.
+func (c *NearCache) SetString(ctx context.Context, key string, value string, expiry Expiry) error {
+	if err := SetStringDataToCacheWithExpiry(ctx, c.client, key, value, expiry); err != nil {
+		return err
+	}
+	return c.afterWrite(ctx, key, value, expiry)
+}
+
+// GetInt returns the value of key, from the local tier when present.
+// Like GetIntDataFromCache it returns -1 when the key does not exist.
+func (c *NearCache) GetInt(ctx context.Context, key string) (int, error) {
+	if value, ok := c.get(key).(int); ok {
+		return value, nil
+	}
+
+	epoch := c.currentEpoch()
+	value, err := GetIntDataFromCache(ctx, c.client, key)
+	if err != nil {
+		return value, err
+	}
+	if value != -1 {
+		c.fill(key, value, c.opts.LocalTTL, epoch)
+	}
+	return value, nil
+}
+
+// SetInt writes value to Redis, caches it locally and invalidates it on every peer.
+func (c *NearCache) SetInt(ctx context.Context, key string, value int, expiry Expiry) error {
+	if err := SetIntDataToCacheWithExpiry(ctx, c.client, key, value, expiry); err != nil {
+		return err
+	}
+	return c.afterWrite(ctx, key, value, expiry)
+}
+
+// Delete deletes keys from Redis and from the local tier of every instance.
+func (c *NearCache) Delete(ctx context.Context, keys ...string) (int64, error) {
+	deleted, err := DeleteDataFromCache(ctx, c.client, keys...)
+	if err != nil {
+		return deleted, err
+	}
+	return deleted, c.Invalidate(ctx, keys...)
+}
+
+// Invalidate evicts keys from the local tier of every instance, for keys
+// written to Redis without going through the near cache.
+func (c *NearCache) Invalidate(ctx context.Context, keys ...string) error {
+	if len(keys) == 0 {
+		return nil
+	}
+	c.evict(keys)
+	return c.publish(ctx, keys)
+}
+
+// Flush empties the local tier of this instance.
+func (c *NearCache) Flush() {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.epoch++
+	c.entries = make(map[string]*list.Element)
+	c.lru.Init()
+}
+
+// Len returns the number of entries in the local tier, including expired ones not evicted yet.
+func (c *NearCache) Len() int {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.lru.Len()
+}
+
+// Close stops listening for invalidations. It does not close the client.
+func (c *NearCache) Close() {
+	c.cancel()
+	<-c.sub.Done()
+}
+
+// afterWrite evicts key everywhere, then caches the value that was just written.
+func (c *NearCache) afterWrite(ctx context.Context, key string, value interface{}, expiry Expiry) error {
+	c.evict([]string{key})
+	epoch := c.currentEpoch()
+	err := c.publish(ctx, []string{key})
+	if ttl := c.localTTL(expiry); ttl > 0 {
+		c.fill(key, value, ttl, epoch)
+	}
+	return err
+}
+
+// localTTL is LocalTTL, or less when the value expires sooner in Redis.
+func (c *NearCache) localTTL(expiry Expiry) time.Duration {
+	ttl := c.opts.LocalTTL
+	if expiry.ttl > 0 {
+		ttl = min(ttl, expiry.ttl)
+	}
+	if !expiry.deadline.IsZero() {
+		ttl = min(ttl, time.Until(expiry.deadline))
+	}
+	return ttl
+}
+
+func (c *NearCache) publish(ctx context.Context, keys []string) error {
+	if _, err := Publish(ctx, c.client, c.opts.Channel, nearCacheInvalidation{Origin: c.origin, Keys: keys}); err != nil {
+		return fmt.Errorf("failed to publish invalidation: %w", err)
+	}
+	return nil
+}
+
+func (c *NearCache) onInvalidation(msg Message[nearCacheInvalidation]) {
+	// This instance already evicted its own writes before publishing them
+	if msg.Payload.Origin == c.origin {
+		if len(msg.Payload.Keys) == 0 {
+			c.readyOnce.Do(func() { close(c.ready) })
+		}
+		return
+	}
+	c.evict(msg.Payload.Keys)
+}
+
+// onSubscriptionError flushes the local tier, since invalidations may have been missed.
+func (c *NearCache) onSubscriptionError(err error) {
+	c.Flush()
+	if c.opts.OnError != nil {
+		c.opts.OnError(err)
+	}
+}
+
+func (c *NearCache) currentEpoch() uint64 {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.epoch
+}
+
+// get returns the local value of key, or nil when it is missing or expired.
+func (c *NearCache) get(key string) interface{} {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	element, ok := c.entries[key]
+	if !ok {
+		return nil
+	}
+	entry := element.Value.(*nearCacheEntry)
+	if time.Now().After(entry.expiresAt) {
+		c.lru.Remove(element)
+		delete(c.entries, key)
+		return nil
+	}
+	c.lru.MoveToFront(element)
+	return entry.value
+}
+
+// fill stores value locally, unless an invalidation happened since epoch was read.
+func (c *NearCache) fill(key string, value interface{}, ttl time.Duration, epoch uint64) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if c.epoch != epoch {
+		return
+	}
+	entry := &nearCacheEntry{key: key, value: value, expiresAt: time.Now().Add(ttl)}
+	if element, ok := c.entries[key]; ok {
+		element.Value = entry
+		c.lru.MoveToFront(element)
+		return
+	}
+	c.entries[key] = c.lru.PushFront(entry)
+	for c.lru.Len() > c.opts.MaxEntries {
+		oldest := c.lru.Back()
+		c.lru.Remove(oldest)
+		delete(c.entries, oldest.Value.(*nearCacheEntry).key)
+	}
+}
+
+func (c *NearCache) evict(keys []string) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	c.epoch++
+	for _, key := range keys {
+		if element, ok := c.entries[key]; ok {
+			c.lru.Remove(element)
+			delete(c.entries, key)
+		}
+	}
+}
@@ -0,0 +1,130 @@
+package redis_cache
+
+import (
+	"context"
+	"testing"
+	"time"
+)
+
+// setupTestNearCache returns a near cache on its own client, standing in for one instance.
+func setupTestNearCache(t *testing.T, opts NearCacheOptions) *NearCache {
+	client := setupTestClient(t)
+	nearCache, err := NewNearCache(context.Background(), client, opts)
+	if err != nil {
+		t.Fatalf("NewNearCache() error = %v", err)
+	}
+	t.Cleanup(func() {
+		nearCache.Close()
+		Close(client)
+	})
+	return nearCache
+}
+
+func TestNearCacheServesLocalTier(t *testing.T) {
+	nearCache := setupTestNearCache(t, NearCacheOptions{LocalTTL: 200 * time.Millisecond})
+	ctx := context.Background()
+
+	if err := nearCache.SetString(ctx, "near-local", "cached", ExpireIn(time.Minute)); err != nil {
+		t.Fatalf("SetString() error = %v", err)
+	}
+	if err := nearCache.SetInt(ctx, "near-local-int", 7, ExpireIn(time.Minute)); err != nil {
+		t.Fatalf("SetInt() error = %v", err)
+	}
+
+	// Remove the keys behind the near cache's back, the local tier still has them
+	DeleteDataFromCache(ctx, nearCache.client, "near-local")
+	DeleteDataFromCache(ctx, nearCache.client, "near-local-int")
+	if got, err := nearCache.GetString(ctx, "near-local"); err != nil || got != "cached" {
+		t.Errorf("GetString() from the local tier = %q, %v, want %q", got, err, "cached")
+	}
+	if got, err := nearCache.GetInt(ctx, "near-local-int"); err != nil || got != 7 {
+		t.Errorf("GetInt() from the local tier = %d, %v, want 7", got, err)
+	}
+
+	// Until the local TTL runs out
+	time.Sleep(250 * time.Millisecond)
+	if got, err := nearCache.GetString(ctx, "near-local"); err != nil || got != "" {
+		t.Errorf("GetString() after the local TTL = %q, %v, want a miss", got, err)
+	}
+	if got, err := nearCache.GetInt(ctx, "near-local-int"); err != nil || got != -1 {
+		t.Errorf("GetInt() after the local TTL = %d, %v, want -1", got, err)
+	}
+}
+
+func TestNearCacheLocalTTLFollowsExpiry(t *testing.T) {
+	nearCache := setupTestNearCache(t, NearCacheOptions{})
+	ctx := context.Background()
+
+	if err := nearCache.SetString(ctx, "near-short", "value", ExpireIn(100*time.Millisecond).WithoutJitter()); err != nil {
+		t.Fatalf("SetString() error = %v", err)
+	}
+	DeleteDataFromCache(ctx, nearCache.client, "near-short")
+	time.Sleep(150 * time.Millisecond)
+	if got, _ := nearCache.GetString(ctx, "near-short"); got != "" {
+		t.Errorf("GetString() after the Redis expiry = %q, want a miss", got)
+	}
+}
+
+func TestNearCacheBoundedSize(t *testing.T) {
+	nearCache := setupTestNearCache(t, NearCacheOptions{MaxEntries: 2})
+	ctx := context.Background()
+
+	for _, key := range []string{"near-lru-1", "near-lru-2", "near-lru-3"} {
+		if err := nearCache.SetString(ctx, key, key, ExpireIn(time.Minute)); err != nil {
+			t.Fatalf("SetString() error = %v", err)
+		}
+	}
+	if got := nearCache.Len(); got != 2 {
+		t.Errorf("Len() = %d, want 2", got)
+	}
+
+	// The least recently used key was evicted and is read from Redis again
+	DeleteDataFromCache(ctx, nearCache.client, "near-lru-1")
+	if got, _ := nearCache.GetString(ctx, "near-lru-1"); got != "" {
+		t.Errorf("GetString() of the evicted key = %q, want a miss", got)
+	}
+}
+
+func TestNearCacheInvalidatesPeers(t *testing.T) {
+	first := setupTestNearCache(t, NearCacheOptions{})
+	second := setupTestNearCache(t, NearCacheOptions{})
+	ctx := context.Background()
+
+	if err := first.SetString(ctx, "near-shared", "v1", ExpireIn(time.Minute)); err != nil {
+		t.Fatalf("SetString() error = %v", err)
+	}
+	if got, _ := second.GetString(ctx, "near-shared"); got != "v1" {
+		t.Fatalf("GetString() on the peer = %q, want %q", got, "v1")
+	}
+
+	waitFor := func(want string) {
+		deadline := time.Now().Add(2 * time.Second)
+		for time.Now().Before(deadline) {
+			if got, _ := second.GetString(ctx, "near-shared"); got == want {
+				return
+			}
+			time.Sleep(10 * time.Millisecond)
+		}
+		t.Fatalf("Expected the peer to see %q after the invalidation", want)
+	}
+
+	if err := first.SetString(ctx, "near-shared", "v2", ExpireIn(time.Minute)); err != nil {
+		t.Fatalf("SetString() error = %v", err)
+	}
+	waitFor("v2")
+
+	if _, err := first.Delete(ctx, "near-shared"); err != nil {
+		t.Fatalf("Delete() error = %v", err)
+	}
+	waitFor("")
+
+	// The writer keeps its own fresh value despite receiving nothing from itself
+	if err := first.SetString(ctx, "near-shared", "v3", ExpireIn(time.Minute)); err != nil {
+		t.Fatalf("SetString() error = %v", err)
+	}
+	DeleteDataFromCache(ctx, first.client, "near-shared")
+	time.Sleep(50 * time.Millisecond)
+	if got, _ := first.GetString(ctx, "near-shared"); got != "v3" {
+		t.Errorf("GetString() on the writer = %q, want %q from the local tier", got, "v3")
+	}
+}
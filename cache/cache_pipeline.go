@@ -0,0 +1,243 @@
+package redis_cache
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strconv"
+
+	"github.com/redis/rueidis"
+)
+
+// This file contains the explicit pipeline, a batch of mixed commands sent in one round trip :
+// 1. Typed methods queueing the package's operations (strings, ints, counters, expiry, hashes, deletes)
+// 2. Exec sends the whole batch with DoMulti, whatever connection_mode is set to
+// 3. Every queued operation returns a typed handle whose result is read back after Exec
+//
+// A pipeline is not a transaction: other clients' commands may run between the
+// queued ones, and a failing command does not stop the next ones. Use
+// Transaction for atomic read-modify-write flows.
+
+// ErrPipelineNotExecuted is returned when reading a result before Exec.
+var ErrPipelineNotExecuted = errors.New("pipeline not executed")
+
+// Pipeline queues commands and sends them in a single round trip on Exec.
+// It is not safe for concurrent use, and can only be executed once.
+type Pipeline struct {
+	client rueidis.Client
+	cmds   rueidis.Commands
+	// tagRuns maps the index of the queued tag index updates to their run
+	tagRuns map[int]rueidis.LuaExec
+	resps   []rueidis.RedisResult
+	err     error
+	execErr error
+	done    bool
+}
+
+// NewPipeline returns an empty pipeline on client.
+func NewPipeline(client rueidis.Client) *Pipeline {
+	return &Pipeline{client: client}
+}
+
+// PipelineResult is the handle of a queued operation.
+type PipelineResult[T any] struct {
+	pipeline *Pipeline
+	index    int
+	decode   func(rueidis.RedisResult) (T, error)
+	// err is set when the operation could not be queued
+	err error
+}
+
+// Result returns the result of the operation, once the pipeline was executed.
+func (r *PipelineResult[T]) Result() (T, error) {
+	var zero T
+	if r.err != nil {
+		return zero, r.err
+	}
+	if !r.pipeline.done {
+		return zero, ErrPipelineNotExecuted
+	}
+	if r.pipeline.resps == nil {
+		return zero, r.pipeline.execErr
+	}
+	return r.decode(r.pipeline.resps[r.index])
+}
+
+// queue adds cmds and returns the handle of the last one, the command whose result is read.
+func queue[T any](p *Pipeline, decode func(rueidis.RedisResult) (T, error), cmds ...rueidis.Completed) *PipelineResult[T] {
+	p.cmds = append(p.cmds, cmds...)
+	return &PipelineResult[T]{pipeline: p, index: len(p.cmds) - 1, decode: decode}
+}
+
+// failed records an operation that could not be queued, Exec then returns err.
+func failed[T any](p *Pipeline, err error) *PipelineResult[T] {
+	if p.err == nil {
+		p.err = err
+	}
+	return &PipelineResult[T]{pipeline: p, err: err}
+}
+
+// queueTags queues adding key, already namespaced, to the index of every tag
+// of a resolved expiry, ahead of the write as addToTags does.
+func (p *Pipeline) queueTags(key string, expiry Expiry) {
+	for _, run := range tagIndexRuns(p.client, key, expiry) {
+		if p.tagRuns == nil {
+			p.tagRuns = make(map[int]rueidis.LuaExec)
+		}
+		p.tagRuns[len(p.cmds)] = run
+		p.cmds = append(p.cmds, tagIndexScript.build(p.client, run.Keys, run.Args...))
+	}
+}
+
+// Len returns the number of queued commands.
+func (p *Pipeline) Len() int {
+	return len(p.cmds)
+}
+
+// SetString queues SetStringDataToCacheWithExpiry.
+func (p *Pipeline) SetString(key string, value string, expiry Expiry) *PipelineResult[bool] {
+	if err := expiry.validate(); err != nil {
+		return failed[bool](p, err)
+	}
+	expiry = expiry.resolve(p.client)
+
+	key = namespacedKey(p.client, key)
+	cmd, err := buildSetCommand(p.client, key, value, expiry)
+	if err != nil {
+		return failed[bool](p, err)
+	}
+	p.queueTags(key, expiry)
+	return queue(p, decodeOK, cmd)
+}
+
+// SetInt queues SetIntDataToCacheWithExpiry.
+func (p *Pipeline) SetInt(key string, value int, expiry Expiry) *PipelineResult[bool] {
+	return p.SetString(key, strconv.Itoa(value), expiry)
+}
+
+// GetString queues GetStringDataFromCache, the result is "" when the key does not exist.
+func (p *Pipeline) GetString(key string) *PipelineResult[string] {
+	return queue(p, func(resp rueidis.RedisResult) (string, error) {
+		value, err := resp.ToString()
+		if rueidis.IsRedisNil(err) {
+			return "", nil
+		}
+		return value, err
+	}, p.client.B().Get().Key(namespacedKey(p.client, key)).Build())
+}
+
+// GetInt queues GetIntDataFromCache, the result is -1 when the key does not exist.
+func (p *Pipeline) GetInt(key string) *PipelineResult[int] {
+	return queue(p, func(resp rueidis.RedisResult) (int, error) {
+		value, err := resp.ToString()
+		if rueidis.IsRedisNil(err) {
+			return -1, nil
+		}
+		if err != nil {
+			return -2, err
+		}
+		return strconv.Atoi(value)
+	}, p.client.B().Get().Key(namespacedKey(p.client, key)).Build())
+}
+
+// Incr queues INCRBY, the result is the new value.
+func (p *Pipeline) Incr(key string, by int64) *PipelineResult[int64] {
+	return queue(p, rueidis.RedisResult.AsInt64, p.client.B().Incrby().Key(namespacedKey(p.client, key)).Increment(by).Build())
+}
+
+// Expire queues applying expiry to an existing key, the result is false when the key does not exist.
+func (p *Pipeline) Expire(key string, expiry Expiry) *PipelineResult[bool] {
+	cmd, ok, err := buildKeyExpiryCommand(p.client, namespacedKey(p.client, key), expiry)
+	if err != nil {
+		return failed[bool](p, err)
+	}
+	if !ok {
+		return failed[bool](p, fmt.Errorf("keepttl can not be applied to an existing key"))
+	}
+	return queue(p, rueidis.RedisResult.AsBool, cmd)
+}
+
+// Delete queues deleting key, the result is true when it existed.
+func (p *Pipeline) Delete(key string) *PipelineResult[bool] {
+	return queue(p, rueidis.RedisResult.AsBool, p.client.B().Del().Key(namespacedKey(p.client, key)).Build())
+}
+
+// SetHashFields queues SetHashFieldsToCache, the result is the number of new fields.
+// The expiry is queued as a separate command, unlike SetHashFieldsToCache it is not atomic.
+func (p *Pipeline) SetHashFields(key string, fields map[string]string, expiry Expiry) *PipelineResult[int64] {
+	if len(fields) == 0 {
+		return failed[int64](p, fmt.Errorf("at least one hash field is required"))
+	}
+	if err := expiry.validate(); err != nil {
+		return failed[int64](p, err)
+	}
+	expiry = expiry.resolve(p.client)
+
+	key = namespacedKey(p.client, key)
+	hset := p.client.B().Hset().Key(key).FieldValue()
+	for field, value := range fields {
+		hset = hset.FieldValue(field, value)
+	}
+	p.queueTags(key, expiry)
+	result := queue(p, rueidis.RedisResult.AsInt64, hset.Build())
+
+	if expire, ok, err := buildKeyExpiryCommand(p.client, key, expiry); err != nil {
+		return failed[int64](p, err)
+	} else if ok {
+		p.cmds = append(p.cmds, expire)
+	}
+	return result
+}
+
+// GetHashField queues GetHashFieldFromCache, the result is "" when the key or field does not exist.
+func (p *Pipeline) GetHashField(key string, field string) *PipelineResult[string] {
+	return queue(p, func(resp rueidis.RedisResult) (string, error) {
+		value, err := resp.ToString()
+		if rueidis.IsRedisNil(err) {
+			return "", nil
+		}
+		return value, err
+	}, p.client.B().Hget().Key(namespacedKey(p.client, key)).Field(field).Build())
+}
+
+// Do queues any command built with the client's builder. Keys are not namespaced.
+func (p *Pipeline) Do(cmd rueidis.Completed) *PipelineResult[rueidis.RedisMessage] {
+	return queue(p, rueidis.RedisResult.ToMessage, cmd)
+}
+
+// Exec sends every queued command in one round trip. It returns the first
+// command error, the results of the other commands can still be read; a nil
+// reply is not an error. Nothing is sent when an operation could not be queued.
+func (p *Pipeline) Exec(ctx context.Context) error {
+	if p.done {
+		return fmt.Errorf("pipeline already executed")
+	}
+	p.done = true
+	if p.err != nil {
+		p.execErr = fmt.Errorf("failed to execute pipeline: %v", p.err)
+		return p.execErr
+	}
+	if len(p.cmds) == 0 {
+		return nil
+	}
+
+	p.resps = p.client.DoMulti(ctx, p.cmds...)
+	// A node that restarted lost the preloaded tag index script, the rerun
+	// then lands after the write instead of before it
+	tagIndexScript.rerunNoScript(ctx, p.client, p.tagRuns, p.resps)
+	for i, resp := range p.resps {
+		if err := resp.Error(); err != nil && !rueidis.IsRedisNil(err) {
+			p.execErr = fmt.Errorf("failed to execute pipeline: command %d: %w", i, err)
+			return p.execErr
+		}
+	}
+	return nil
+}
+
+// decodeOK decodes the reply of a write answering OK.
+func decodeOK(resp rueidis.RedisResult) (bool, error) {
+	if err := resp.Error(); err != nil {
+		return false, err
+	}
+	return true, nil
+}
@@ -0,0 +1,112 @@
+package redis_cache
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+)
+
+func TestPipeline(t *testing.T) {
+	for _, mode := range connectionModes {
+		t.Run("connection_mode="+mode, func(t *testing.T) {
+			client := setupTestClientWithConnectionMode(t, mode)
+			defer Close(client)
+
+			ctx := context.Background()
+			for _, key := range []string{"pipe-a", "pipe-b", "pipe-c", "pipe-d", "pipe-hash"} {
+				DeleteDataFromCache(ctx, client, key)
+			}
+			SetStringDataToCacheWithExpiry(ctx, client, "pipe-c", "c", NoExpiry())
+			SetStringDataToCacheWithExpiry(ctx, client, "pipe-d", "existing", NoExpiry())
+
+			p := NewPipeline(client)
+			setA := p.SetString("pipe-a", "a", ExpireIn(time.Minute))
+			incrB := p.Incr("pipe-b", 5)
+			expireC := p.Expire("pipe-c", ExpireIn(time.Hour))
+			getD := p.GetString("pipe-d")
+			getMissing := p.GetInt("pipe-missing")
+			setHash := p.SetHashFields("pipe-hash", map[string]string{"name": "ada"}, ExpireIn(time.Minute))
+			getField := p.GetHashField("pipe-hash", "name")
+			deleteD := p.Delete("pipe-d")
+
+			if _, err := setA.Result(); !errors.Is(err, ErrPipelineNotExecuted) {
+				t.Errorf("Result() before Exec error = %v, want ErrPipelineNotExecuted", err)
+			}
+			if err := p.Exec(ctx); err != nil {
+				t.Fatalf("Exec() error = %v", err)
+			}
+
+			if ok, err := setA.Result(); err != nil || !ok {
+				t.Errorf("SetString() = %v, %v", ok, err)
+			}
+			if n, err := incrB.Result(); err != nil || n != 5 {
+				t.Errorf("Incr() = %d, %v, want 5", n, err)
+			}
+			if ok, err := expireC.Result(); err != nil || !ok {
+				t.Errorf("Expire() = %v, %v", ok, err)
+			}
+			if value, err := getD.Result(); err != nil || value != "existing" {
+				t.Errorf("GetString() = %q, %v, want the value read before the delete", value, err)
+			}
+			if value, err := getMissing.Result(); err != nil || value != -1 {
+				t.Errorf("GetInt() of a missing key = %d, %v, want -1", value, err)
+			}
+			if n, err := setHash.Result(); err != nil || n != 1 {
+				t.Errorf("SetHashFields() = %d, %v, want 1", n, err)
+			}
+			if value, err := getField.Result(); err != nil || value != "ada" {
+				t.Errorf("GetHashField() = %q, %v", value, err)
+			}
+			if ok, err := deleteD.Result(); err != nil || !ok {
+				t.Errorf("Delete() = %v, %v", ok, err)
+			}
+
+			if got, _ := GetStringDataFromCache(ctx, client, "pipe-a"); got != "a" {
+				t.Errorf("pipe-a = %q, want %q", got, "a")
+			}
+			if ms, _ := client.Do(ctx, client.B().Pttl().Key("pipe-c").Build()).AsInt64(); ms <= 0 {
+				t.Errorf("pipe-c PTTL = %d, want the expiry applied", ms)
+			}
+		})
+	}
+}
+
+func TestPipelineErrors(t *testing.T) {
+	client := setupTestClient(t)
+	defer Close(client)
+
+	ctx := context.Background()
+	SetStringDataToCacheWithExpiry(ctx, client, "pipe-text", "not a number", ExpireIn(time.Minute))
+
+	// A failing command does not stop the others
+	p := NewPipeline(client)
+	incr := p.Incr("pipe-text", 1)
+	get := p.GetString("pipe-text")
+	if err := p.Exec(ctx); err == nil {
+		t.Errorf("Exec() error = nil, want the INCR error")
+	}
+	if _, err := incr.Result(); err == nil {
+		t.Errorf("Incr() of a string error = nil")
+	}
+	if value, err := get.Result(); err != nil || value != "not a number" {
+		t.Errorf("GetString() = %q, %v", value, err)
+	}
+	if err := p.Exec(ctx); err == nil {
+		t.Errorf("Expected an error executing a pipeline twice")
+	}
+
+	// An operation that can not be queued fails the whole pipeline before anything is sent
+	p = NewPipeline(client)
+	set := p.SetString("pipe-invalid", "value", ExpireIn(-time.Second))
+	p.SetString("pipe-valid", "value", ExpireIn(time.Minute))
+	if err := p.Exec(ctx); err == nil {
+		t.Errorf("Exec() error = nil, want the invalid expiry")
+	}
+	if _, err := set.Result(); err == nil {
+		t.Errorf("SetString() with an invalid expiry error = nil")
+	}
+	if got, _ := GetStringDataFromCache(ctx, client, "pipe-valid"); got != "" {
+		t.Errorf("Expected nothing to be sent, got pipe-valid = %q", got)
+	}
+}
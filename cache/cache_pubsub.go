@@ -0,0 +1,214 @@
+package redis_cache
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strings"
+	"sync/atomic"
+	"time"
+
+	"github.com/redis/rueidis"
+)
+
+// This file contains the following methods for pub/sub :
+// 1. Method to publish a payload on a channel (PUBLISH)
+// 2. Methods to subscribe to channels or patterns, delivering on a Go channel or to a callback
+// 3. Subscriptions resubscribe after a reconnect and stop when their context is done or the client shuts down
+//
+// Payloads are encoded with DefaultCodec, except strings and byte slices which are sent as-is.
+// Channel names are namespaced like keys, so clients in different namespaces do not see
+// each other's messages.
+
+// Message is a payload received on a subscription.
+type Message[T any] struct {
+	// Channel is the channel the message was published on, without the namespace prefix.
+	Channel string
+	// Pattern is the pattern that matched the channel, empty for Subscribe.
+	Pattern string
+	Payload T
+}
+
+// SubscribeOptions configures a subscription.
+type SubscribeOptions struct {
+	// Buffer is the capacity of the channel returned by Subscribe and PSubscribe, 64 by default.
+	Buffer int
+	// ReconnectDelay is the first delay before resubscribing after the
+	// connection was lost, 100ms by default. It doubles on every failed
+	// attempt up to MaxReconnectDelay, 5s by default.
+	ReconnectDelay    time.Duration
+	MaxReconnectDelay time.Duration
+	// OnError is called with payloads that could not be decoded and with the
+	// errors that caused a resubscribe. Such payloads are dropped.
+	OnError func(err error)
+}
+
+func (o *SubscribeOptions) setDefaults() {
+	if o.Buffer <= 0 {
+		o.Buffer = 64
+	}
+	if o.ReconnectDelay <= 0 {
+		o.ReconnectDelay = 100 * time.Millisecond
+	}
+	if o.MaxReconnectDelay <= 0 {
+		o.MaxReconnectDelay = 5 * time.Second
+	}
+}
+
+// Subscription tracks a running subscription.
+type Subscription struct {
+	done chan struct{}
+	err  error
+}
+
+// Done is closed once the subscription has stopped.
+func (s *Subscription) Done() <-chan struct{} {
+	return s.done
+}
+
+// Err returns why the subscription stopped once Done is closed: nil when its
+// context was done or the channels were unsubscribed, rueidis.ErrClosing when
+// the client was closed and ErrShutdown when it was shut down.
+func (s *Subscription) Err() error {
+	<-s.done
+	return s.err
+}
+
+// Publish publishes payload on channel and returns how many subscribers received it.
+func Publish[T any](ctx context.Context, client rueidis.Client, channel string, payload T) (int64, error) {
+	message, err := encodeMember(nil, payload)
+	if err != nil {
+		return 0, fmt.Errorf("failed to encode message: %v", err)
+	}
+	receivers, err := client.Do(ctx, client.B().Publish().Channel(namespacedKey(client, channel)).Message(message).Build()).AsInt64()
+	if err != nil {
+		return 0, fmt.Errorf("failed to publish message: %w", err)
+	}
+	return receivers, nil
+}
+
+// Subscribe subscribes to channels and delivers their messages on the
+// returned channel, which is closed when the subscription stops. The
+// subscription runs until ctx is done. When the connection is lost, rueidis
+// resubscribes on a new one; if its retries are disabled or give up, the
+// subscription resubscribes itself with backoff. Messages published while the
+// connection is being re-established are lost, as with any Redis pub/sub.
+//
+// The channel must be drained: once its buffer is full, delivery blocks the
+// connection the subscription shares with the other subscriptions of client.
+func Subscribe[T any](ctx context.Context, client rueidis.Client, opts SubscribeOptions, channels ...string) (<-chan Message[T], *Subscription, error) {
+	return subscribeToChannel[T](ctx, client, opts, false, channels)
+}
+
+// PSubscribe is Subscribe for glob-style patterns.
+func PSubscribe[T any](ctx context.Context, client rueidis.Client, opts SubscribeOptions, patterns ...string) (<-chan Message[T], *Subscription, error) {
+	return subscribeToChannel[T](ctx, client, opts, true, patterns)
+}
+
+// SubscribeFunc subscribes to channels and calls fn for every message until
+// ctx is done. fn runs on the connection's reader and must return quickly.
+func SubscribeFunc[T any](ctx context.Context, client rueidis.Client, opts SubscribeOptions, fn func(Message[T]), channels ...string) (*Subscription, error) {
+	return subscribe(ctx, client, opts, false, channels, fn)
+}
+
+// PSubscribeFunc is SubscribeFunc for glob-style patterns.
+func PSubscribeFunc[T any](ctx context.Context, client rueidis.Client, opts SubscribeOptions, fn func(Message[T]), patterns ...string) (*Subscription, error) {
+	return subscribe(ctx, client, opts, true, patterns, fn)
+}
+
+func subscribeToChannel[T any](ctx context.Context, client rueidis.Client, opts SubscribeOptions, pattern bool, channels []string) (<-chan Message[T], *Subscription, error) {
+	opts.setDefaults()
+	messages := make(chan Message[T], opts.Buffer)
+	sub, err := subscribe(ctx, client, opts, pattern, channels, func(msg Message[T]) {
+		select {
+		case messages <- msg:
+		case <-ctx.Done():
+		}
+	})
+	if err != nil {
+		return nil, nil, err
+	}
+	go func() {
+		<-sub.done
+		close(messages)
+	}()
+	return messages, sub, nil
+}
+
+// subscribe starts the goroutine that keeps the subscription alive.
+func subscribe[T any](ctx context.Context, client rueidis.Client, opts SubscribeOptions, pattern bool, channels []string, fn func(Message[T])) (*Subscription, error) {
+	if len(channels) == 0 {
+		return nil, fmt.Errorf("at least one channel is required to subscribe")
+	}
+	opts.setDefaults()
+
+	prefix := optionsOf(client).namespace.prefix()
+	// The command is pinned so it can be sent again on every resubscribe
+	var cmd rueidis.Completed
+	if pattern {
+		cmd = client.B().Psubscribe().Pattern(namespacedKeys(client, channels)...).Build().Pin()
+	} else {
+		cmd = client.B().Subscribe().Channel(namespacedKeys(client, channels)...).Build().Pin()
+	}
+
+	// Shutdown stops the subscription (see cache_shutdown.go)
+	life := optionsOf(client).life
+	if err := life.begin(ctx, workSubscriptions); err != nil {
+		return nil, err
+	}
+	ctx, stop := life.bind(ctx)
+
+	sub := &Subscription{done: make(chan struct{})}
+	go func() {
+		defer life.end(workSubscriptions)
+		defer stop()
+		defer close(sub.done)
+		defer func() {
+			if sub.err == nil && ctx.Err() != nil && life.stopped() {
+				sub.err = ErrShutdown
+			}
+		}()
+
+		delay := opts.ReconnectDelay
+		for {
+			var received atomic.Bool
+			err := client.Receive(ctx, cmd, func(msg rueidis.PubSubMessage) {
+				received.Store(true)
+				payload, err := decodeMember[T](nil, msg.Message)
+				if err != nil {
+					if opts.OnError != nil {
+						opts.OnError(fmt.Errorf("failed to decode message on %s: %v", msg.Channel, err))
+					}
+					return
+				}
+				fn(Message[T]{
+					Channel: strings.TrimPrefix(msg.Channel, prefix),
+					Pattern: strings.TrimPrefix(msg.Pattern, prefix),
+					Payload: payload,
+				})
+			})
+
+			switch {
+			case ctx.Err() != nil || err == nil:
+				return
+			case errors.Is(err, rueidis.ErrClosing):
+				sub.err = err
+				return
+			}
+
+			if opts.OnError != nil {
+				opts.OnError(fmt.Errorf("subscription lost, resubscribing: %w", err))
+			}
+			if received.Load() {
+				delay = opts.ReconnectDelay
+			}
+			select {
+			case <-ctx.Done():
+				return
+			case <-time.After(delay):
+			}
+			delay = min(delay*2, opts.MaxReconnectDelay)
+		}
+	}()
+	return sub, nil
+}
@@ -0,0 +1,192 @@
+package redis_cache
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/alicebob/miniredis/v2"
+	"github.com/redis/rueidis"
+)
+
+type testEvent struct {
+	Name  string
+	Count int
+}
+
+// publishUntilDelivered publishes payload until it arrives on messages, since
+// messages published before the subscription is registered are not delivered.
+// Publish errors are retried too, as the publisher may be reconnecting.
+func publishUntilDelivered[T any](t *testing.T, client rueidis.Client, channel string, payload T, messages <-chan Message[T]) Message[T] {
+	deadline := time.After(2 * time.Second)
+	var err error
+	for {
+		_, err = Publish(context.Background(), client, channel, payload)
+		select {
+		case msg := <-messages:
+			return msg
+		case <-deadline:
+			t.Fatalf("Timed out waiting for a message on %s, last Publish() error = %v", channel, err)
+		case <-time.After(20 * time.Millisecond):
+		}
+	}
+}
+
+func TestPublishSubscribe(t *testing.T) {
+	client := setupTestClient(t)
+	defer Close(client)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	messages, sub, err := Subscribe[testEvent](ctx, client, SubscribeOptions{}, "pubsub-events")
+	if err != nil {
+		t.Fatalf("Subscribe() error = %v", err)
+	}
+
+	want := testEvent{Name: "created", Count: 3}
+	if msg := publishUntilDelivered(t, client, "pubsub-events", want, messages); msg.Channel != "pubsub-events" || msg.Payload != want {
+		t.Errorf("received %+v, want %+v on pubsub-events", msg, want)
+	}
+
+	receivers, err := Publish(ctx, client, "pubsub-events", want)
+	if err != nil {
+		t.Fatalf("Publish() error = %v", err)
+	}
+	if receivers != 1 {
+		t.Errorf("Publish() receivers = %d, want 1", receivers)
+	}
+	<-messages
+
+	cancel()
+	select {
+	case <-sub.Done():
+	case <-time.After(2 * time.Second):
+		t.Fatal("Expected the subscription to stop when its context is done")
+	}
+	if err := sub.Err(); err != nil {
+		t.Errorf("Err() = %v, want nil", err)
+	}
+	if _, ok := <-messages; ok {
+		t.Error("Expected the messages channel to be closed")
+	}
+}
+
+func TestPSubscribeFunc(t *testing.T) {
+	client := WithNamespace(setupTestClient(t), "pubsub", 1)
+	defer Close(client)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	received := make(chan Message[string], 16)
+	if _, err := PSubscribeFunc(ctx, client, SubscribeOptions{}, func(msg Message[string]) {
+		received <- msg
+	}, "invalidate:*"); err != nil {
+		t.Fatalf("PSubscribeFunc() error = %v", err)
+	}
+
+	msg := publishUntilDelivered(t, client, "invalidate:users", "user-1", received)
+	if msg.Channel != "invalidate:users" || msg.Pattern != "invalidate:*" || msg.Payload != "user-1" {
+		t.Errorf("received %+v, want user-1 on invalidate:users matching invalidate:*", msg)
+	}
+}
+
+func TestSubscribeResubscribesAfterReconnect(t *testing.T) {
+	tests := []struct {
+		name         string
+		disableRetry bool
+	}{
+		// rueidis retries Receive on a new connection by itself
+		{name: "client retry"},
+		// without client retries Subscribe resubscribes, reporting the loss on OnError
+		{name: "subscription retry", disableRetry: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			m := miniredis.RunT(t)
+			option := rueidis.ClientOption{InitAddress: []string{m.Addr()}, DisableCache: true, DisableRetry: tt.disableRetry}
+			client, err := rueidis.NewClient(option)
+			if err != nil {
+				t.Fatalf("Failed to connect to the test server: %v", err)
+			}
+			defer client.Close()
+			// The stand-in server refuses other commands on a connection in
+			// subscribe mode, so publish from a separate client
+			publisher, err := rueidis.NewClient(option)
+			if err != nil {
+				t.Fatalf("Failed to connect to the test server: %v", err)
+			}
+			defer publisher.Close()
+
+			ctx, cancel := context.WithCancel(context.Background())
+			defer cancel()
+
+			lost := make(chan error, 1)
+			messages, _, err := Subscribe[string](ctx, client, SubscribeOptions{
+				ReconnectDelay: 10 * time.Millisecond,
+				OnError: func(err error) {
+					select {
+					case lost <- err:
+					default:
+					}
+				},
+			}, "pubsub-reconnect")
+			if err != nil {
+				t.Fatalf("Subscribe() error = %v", err)
+			}
+			publishUntilDelivered(t, publisher, "pubsub-reconnect", "before-restart", messages)
+
+			// Drop every connection by replacing the server on the same address
+			addr := m.Addr()
+			m.Close()
+			m = miniredis.NewMiniRedis()
+			if err := m.StartAddr(addr); err != nil {
+				t.Fatalf("Failed to restart the test server: %v", err)
+			}
+			defer m.Close()
+
+			for {
+				msg := publishUntilDelivered(t, publisher, "pubsub-reconnect", "after-restart", messages)
+				// Skip copies of the first message still in flight before the restart
+				if msg.Payload == "after-restart" {
+					break
+				}
+			}
+
+			select {
+			case <-lost:
+				if !tt.disableRetry {
+					t.Error("Expected the client to resubscribe without reporting an error")
+				}
+			default:
+				if tt.disableRetry {
+					t.Error("Expected OnError to report the lost subscription")
+				}
+			}
+		})
+	}
+}
+
+func TestSubscribeStopsWhenClientCloses(t *testing.T) {
+	client := setupTestClient(t)
+
+	sub, err := SubscribeFunc(context.Background(), client, SubscribeOptions{}, func(Message[string]) {}, "pubsub-close")
+	if err != nil {
+		t.Fatalf("SubscribeFunc() error = %v", err)
+	}
+	client.Close()
+
+	select {
+	case <-sub.Done():
+	case <-time.After(2 * time.Second):
+		t.Fatal("Expected the subscription to stop when the client is closed")
+	}
+	if err := sub.Err(); !errors.Is(err, rueidis.ErrClosing) {
+		t.Errorf("Err() = %v, want %v", err, rueidis.ErrClosing)
+	}
+
+	if _, _, err := Subscribe[string](context.Background(), client, SubscribeOptions{}); err == nil {
+		t.Error("Expected Subscribe() without channels to fail")
+	}
+}
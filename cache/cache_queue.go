@@ -0,0 +1,277 @@
+package redis_cache
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strconv"
+	"time"
+
+	"github.com/redis/rueidis"
+)
+
+// This file contains the reliable queue built on LMOVE/BLMOVE :
+// 1. Reserve moves an item from the queue onto a processing list and leases it
+// 2. Ack removes a finished item from the processing list, Nack returns it to the head of the queue
+// 3. Reap moves items whose lease expired back to the head of the queue
+//
+// Leases are kept in a sorted set scored by their deadline in milliseconds,
+// computed from the Redis server clock so consumers with skewed clocks agree.
+// Every reservation also gets a random lease token, kept in a hash, and Ack
+// and Nack only settle the item while it still holds theirs: a consumer whose
+// lease expired cannot settle the item once someone else reserved it again.
+
+// leaseScript leases ARGV[1] for ARGV[2] milliseconds under the token ARGV[3].
+// KEYS[1] is the leases sorted set and KEYS[2] the lease tokens hash.
+var leaseScript = rueidis.NewLuaScript(`
+local now = redis.call('TIME')
+local deadline = tonumber(now[1]) * 1000 + math.floor(tonumber(now[2]) / 1000) + tonumber(ARGV[2])
+redis.call('ZADD', KEYS[1], deadline, ARGV[1])
+redis.call('HSET', KEYS[2], ARGV[1], ARGV[3])
+return deadline
+`)
+
+// settleScript removes ARGV[1] from the processing list when it still holds
+// the lease token ARGV[2], and pushes it back to the head of the queue when
+// ARGV[3] is 1. It returns 0 when the item holds another token or none.
+// KEYS[1] is the queue, KEYS[2] the processing list, KEYS[3] the leases and
+// KEYS[4] the lease tokens.
+var settleScript = rueidis.NewLuaScript(`
+if redis.call('HGET', KEYS[4], ARGV[1]) ~= ARGV[2] then
+	return 0
+end
+redis.call('HDEL', KEYS[4], ARGV[1])
+redis.call('ZREM', KEYS[3], ARGV[1])
+if redis.call('LREM', KEYS[2], 1, ARGV[1]) == 0 then
+	return 0
+end
+if ARGV[3] == '1' then
+	redis.call('LPUSH', KEYS[1], ARGV[1])
+end
+return 1
+`)
+
+// reapScript requeues the processing items whose lease expired.
+// KEYS[1] is the queue, KEYS[2] the processing list, KEYS[3] the leases and
+// KEYS[4] the lease tokens.
+// ARGV[1] is the lease duration in milliseconds. Items found without a lease,
+// e.g. because the consumer died between BLMOVE and the lease, get a fresh
+// lease instead of being requeued straight away.
+var reapScript = rueidis.NewLuaScript(`
+local now = redis.call('TIME')
+local nowms = tonumber(now[1]) * 1000 + math.floor(tonumber(now[2]) / 1000)
+local requeued = 0
+for _, item in ipairs(redis.call('LRANGE', KEYS[2], 0, -1)) do
+	local deadline = redis.call('ZSCORE', KEYS[3], item)
+	if not deadline then
+		redis.call('ZADD', KEYS[3], nowms + tonumber(ARGV[1]), item)
+	elseif tonumber(deadline) <= nowms then
+		redis.call('LREM', KEYS[2], 1, item)
+		redis.call('ZREM', KEYS[3], item)
+		redis.call('HDEL', KEYS[4], item)
+		redis.call('LPUSH', KEYS[1], item)
+		requeued = requeued + 1
+	end
+end
+return requeued
+`)
+
+// ErrItemNotReserved is returned by Ack and Nack when the item is no longer
+// reserved by the caller, because it was already settled or its lease expired
+// and Reap requeued it.
+var ErrItemNotReserved = errors.New("queue item not reserved")
+
+// ReliableQueue is a work queue of T where reserved items stay on a
+// processing list until they are acknowledged. Items a consumer reserved but
+// never acknowledged are returned to the queue by Reap once their lease expires.
+type ReliableQueue[T any] struct {
+	client     rueidis.Client
+	key        string
+	processing string
+	leases     string
+	tokens     string
+	visibility time.Duration
+
+	// Codec encodes the payloads, DefaultCodec when nil.
+	Codec Codec
+}
+
+// QueueItem is an item reserved from a ReliableQueue.
+type QueueItem[T any] struct {
+	ID    string
+	Value T
+
+	raw string
+	// token is the lease token of this reservation
+	token string
+}
+
+// queueEnvelope gives every payload a unique id, so identical payloads can
+// be told apart on the processing list.
+type queueEnvelope[T any] struct {
+	ID      string `msgpack:"id" json:"id"`
+	Payload T      `msgpack:"payload" json:"payload"`
+}
+
+// NewReliableQueue returns a reliable queue of T stored under key. Reserved
+// items are leased for visibility before Reap considers them abandoned.
+// The queue, processing list, leases and lease tokens are stored as {key},
+// {key}:processing, {key}:leases and {key}:tokens, so the hash tag keeps them
+// in one cluster slot.
+func NewReliableQueue[T any](client rueidis.Client, key string, visibility time.Duration) (*ReliableQueue[T], error) {
+	if visibility <= 0 {
+		return nil, fmt.Errorf("visibility must be positive")
+	}
+	tagged := "{" + key + "}"
+	return &ReliableQueue[T]{
+		client:     client,
+		key:        tagged,
+		processing: tagged + KeySeparator + "processing",
+		leases:     tagged + KeySeparator + "leases",
+		tokens:     tagged + KeySeparator + "tokens",
+		visibility: visibility,
+	}, nil
+}
+
+// Push appends items to the tail of the queue and returns the new length.
+func (q *ReliableQueue[T]) Push(ctx context.Context, items ...T) (int64, error) {
+	values := make([]string, len(items))
+	for i, item := range items {
+		id, err := newRandomToken()
+		if err != nil {
+			return 0, err
+		}
+		value, err := encodeValue(q.Codec, queueEnvelope[T]{ID: id, Payload: item})
+		if err != nil {
+			return 0, fmt.Errorf("failed to encode queue item: %v", err)
+		}
+		values[i] = value
+	}
+	return PushToList(ctx, q.client, q.key, ListTail, values...)
+}
+
+// Reserve waits up to timeout for an item and moves it onto the processing
+// list, 0 waits until ctx is done. It returns nil when the timeout elapsed.
+func (q *ReliableQueue[T]) Reserve(ctx context.Context, timeout time.Duration) (*QueueItem[T], error) {
+	if timeout < 0 {
+		return nil, fmt.Errorf("timeout must not be negative")
+	}
+	cmd := q.client.B().Blmove().
+		Source(namespacedKey(q.client, q.key)).
+		Destination(namespacedKey(q.client, q.processing)).
+		Left().Right().Timeout(timeout.Seconds()).Build()
+	return q.reserve(ctx, cmd)
+}
+
+// TryReserve moves the item at the head of the queue onto the processing
+// list without waiting. It returns nil when the queue is empty.
+func (q *ReliableQueue[T]) TryReserve(ctx context.Context) (*QueueItem[T], error) {
+	cmd := q.client.B().Lmove().
+		Source(namespacedKey(q.client, q.key)).
+		Destination(namespacedKey(q.client, q.processing)).
+		Left().Right().Build()
+	return q.reserve(ctx, cmd)
+}
+
+func (q *ReliableQueue[T]) reserve(ctx context.Context, move rueidis.Completed) (*QueueItem[T], error) {
+	raw, err := q.client.Do(ctx, move).ToString()
+	if err != nil {
+		if rueidis.IsRedisNil(err) {
+			return nil, nil
+		}
+		return nil, fmt.Errorf("failed to reserve queue item: %w", err)
+	}
+
+	token, err := newRandomToken()
+	if err != nil {
+		// The item is on the processing list already, Reap will lease it
+		return nil, err
+	}
+	keys := namespacedKeys(q.client, []string{q.leases, q.tokens})
+	lease := strconv.FormatInt(q.visibility.Milliseconds(), 10)
+	if err := leaseScript.Exec(ctx, q.client, keys, []string{raw, lease, token}).Error(); err != nil {
+		// The item is on the processing list already, Reap will lease it
+		return nil, fmt.Errorf("failed to lease queue item: %w", err)
+	}
+
+	envelope, err := decodeValue[queueEnvelope[T]](q.Codec, raw)
+	if err != nil {
+		return nil, fmt.Errorf("failed to decode queue item: %v", err)
+	}
+	return &QueueItem[T]{ID: envelope.ID, Value: envelope.Payload, raw: raw, token: token}, nil
+}
+
+// Ack removes a finished item from the processing list. It returns
+// ErrItemNotReserved when the item is no longer reserved by this reservation,
+// e.g. because its lease expired and it was requeued, in which case it may be
+// processed again.
+func (q *ReliableQueue[T]) Ack(ctx context.Context, item *QueueItem[T]) error {
+	return q.settle(ctx, item, false)
+}
+
+// Nack gives up a reserved item and pushes it back to the head of the queue,
+// so it is reserved again right away. It returns ErrItemNotReserved like Ack.
+func (q *ReliableQueue[T]) Nack(ctx context.Context, item *QueueItem[T]) error {
+	return q.settle(ctx, item, true)
+}
+
+func (q *ReliableQueue[T]) settle(ctx context.Context, item *QueueItem[T], requeue bool) error {
+	action, flag := "ack", "0"
+	if requeue {
+		action, flag = "nack", "1"
+	}
+	keys := namespacedKeys(q.client, []string{q.key, q.processing, q.leases, q.tokens})
+	settled, err := settleScript.Exec(ctx, q.client, keys, []string{item.raw, item.token, flag}).AsInt64()
+	if err != nil {
+		return fmt.Errorf("failed to %s queue item: %w", action, err)
+	}
+	if settled == 0 {
+		return ErrItemNotReserved
+	}
+	return nil
+}
+
+// Reap moves items whose lease expired back to the head of the queue and
+// returns how many were requeued.
+func (q *ReliableQueue[T]) Reap(ctx context.Context) (int64, error) {
+	keys := namespacedKeys(q.client, []string{q.key, q.processing, q.leases, q.tokens})
+	lease := strconv.FormatInt(q.visibility.Milliseconds(), 10)
+	requeued, err := reapScript.Exec(ctx, q.client, keys, []string{lease}).AsInt64()
+	if err != nil {
+		return 0, fmt.Errorf("failed to reap queue items: %w", err)
+	}
+	return requeued, nil
+}
+
+// RunReaper calls Reap every interval until ctx is done, which returns nil,
+// or until Reap fails.
+func (q *ReliableQueue[T]) RunReaper(ctx context.Context, interval time.Duration) error {
+	if interval <= 0 {
+		return fmt.Errorf("interval must be positive")
+	}
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return nil
+		case <-ticker.C:
+			if _, err := q.Reap(ctx); err != nil {
+				if ctx.Err() != nil {
+					return nil
+				}
+				return err
+			}
+		}
+	}
+}
+
+// Len returns the number of items waiting in the queue, not counting reserved ones.
+func (q *ReliableQueue[T]) Len(ctx context.Context) (int64, error) {
+	return GetListLength(ctx, q.client, q.key)
+}
+
+// Processing returns the number of reserved items that were not acknowledged yet.
+func (q *ReliableQueue[T]) Processing(ctx context.Context) (int64, error) {
+	return GetListLength(ctx, q.client, q.processing)
+}
@@ -0,0 +1,318 @@
+package redis_cache
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"math/rand/v2"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/redis/rueidis"
+)
+
+// This file contains the Redlock quorum lock across independent Redis nodes :
+// 1. Method to connect to every node listed under redlock.nodes in the config, with plain clients
+// 2. Lock sets the key on every node and succeeds when a majority accepted it in time
+// 3. Failed attempts are undone on every node and retried after a jittered delay
+// 4. Unlock releases the key on every node with the compare-and-delete script
+//
+// Ref : https://redis.io/docs/latest/develop/use/patterns/distributed-locks/
+
+// redlockSetScript is SET NX PX as a script, so it can share the EVALSHA path
+// with releaseScript. KEYS[1] is the lock, ARGV[1] the owner, ARGV[2] the lease in ms.
+var redlockSetScript = rueidis.NewLuaScript(`
+if redis.call('SET', KEYS[1], ARGV[1], 'NX', 'PX', ARGV[2]) then
+	return 1
+end
+return 0
+`)
+
+// redlockReconnectInterval limits how often an unreachable node is redialled.
+const redlockReconnectInterval = time.Second
+
+// redlockDialTimeout bounds a connection attempt to a node.
+const redlockDialTimeout = 5 * time.Second
+
+// Redlock acquires locks on a majority of independent Redis nodes.
+type Redlock struct {
+	nodes       []*redlockNode
+	quorum      int
+	driftFactor float64
+	retryCount  int
+	retryDelay  time.Duration
+	nodeTimeout time.Duration
+}
+
+// redlockNode is one Redis endpoint. A node that could not be reached is
+// redialled in the background, at most once every redlockReconnectInterval.
+type redlockNode struct {
+	config   *CacheConnectionConfig
+	address  string
+	password string
+	database int
+
+	mu         sync.Mutex
+	client     rueidis.Client
+	dialing    bool
+	lastDialAt time.Time
+	closed     bool
+}
+
+// RedlockLease is a lock held on a majority of nodes.
+type RedlockLease struct {
+	redlock    *Redlock
+	key        string
+	owner      string
+	validUntil time.Time
+}
+
+// InitializeRedlock connects to every node listed under redlock.nodes in the
+// config. It can be called without arguments to use the default config path,
+// or with a custom config file path. Nodes that are down are retried on later
+// lock attempts, but at least a majority must be reachable at startup.
+func InitializeRedlock(configFilePath ...string) (*Redlock, error) {
+	path := DefaultConfigPath
+	if len(configFilePath) > 0 && configFilePath[0] != "" {
+		path = configFilePath[0]
+	}
+
+	config, err := LoadCacheConfigFromFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("failed to load cache config: %v", err)
+	}
+	return newRedlock(config)
+}
+
+func newRedlock(config *CacheConnectionConfig) (*Redlock, error) {
+	settings := config.Cache.Usage_Cache_DB.Redlock
+	if len(settings.Nodes) == 0 {
+		return nil, fmt.Errorf("redlock requires at least one node under redlock.nodes")
+	}
+
+	r := &Redlock{
+		quorum:      len(settings.Nodes)/2 + 1,
+		driftFactor: settings.Clock_Drift_Factor,
+		retryCount:  settings.Retry_Count,
+		retryDelay:  settings.Retry_Delay,
+		nodeTimeout: settings.Node_Timeout,
+	}
+
+	dialed := make(chan error, len(settings.Nodes))
+	for _, n := range settings.Nodes {
+		node := &redlockNode{
+			config:   config,
+			address:  fmt.Sprintf("%s:%s", n.Host, n.Port),
+			password: n.Password,
+			database: n.Database,
+			dialing:  true,
+		}
+		r.nodes = append(r.nodes, node)
+		go func() {
+			dialed <- node.dial()
+		}()
+	}
+
+	// Once a quorum is connected, wait at most the node timeout for the other
+	// nodes, which keep connecting in the background
+	var grace <-chan time.Time
+	reachable, unreachable := 0, 0
+wait:
+	for reachable+unreachable < len(r.nodes) && unreachable <= len(r.nodes)-r.quorum {
+		select {
+		case err := <-dialed:
+			if err != nil {
+				unreachable++
+				continue
+			}
+			reachable++
+			if reachable == r.quorum {
+				grace = time.After(r.nodeTimeout)
+			}
+		case <-grace:
+			break wait
+		}
+	}
+	if reachable < r.quorum {
+		r.Close()
+		return nil, fmt.Errorf("only %d of %d redlock nodes are reachable, %d required", reachable, len(r.nodes), r.quorum)
+	}
+	return r, nil
+}
+
+// get returns the node's client. A node that is not connected is redialled
+// in the background, so an unreachable node never delays a lock attempt.
+func (n *redlockNode) get() (rueidis.Client, error) {
+	n.mu.Lock()
+	defer n.mu.Unlock()
+
+	if n.client != nil {
+		return n.client, nil
+	}
+	if !n.dialing && !n.closed && time.Since(n.lastDialAt) >= redlockReconnectInterval {
+		n.dialing = true
+		go n.dial()
+	}
+	return nil, fmt.Errorf("redlock node %s is unreachable", n.address)
+}
+
+// dial connects to the node, the caller sets dialing.
+func (n *redlockNode) dial() error {
+	ctx, cancel := context.WithTimeout(context.Background(), redlockDialTimeout)
+	defer cancel()
+	client, err := dialLockNode(ctx, n.config, n.address, n.password, n.database)
+
+	n.mu.Lock()
+	defer n.mu.Unlock()
+	n.dialing = false
+	n.lastDialAt = time.Now()
+	if err != nil {
+		return err
+	}
+	if n.closed {
+		client.Close()
+		return rueidis.ErrClosing
+	}
+	n.client = client
+	return nil
+}
+
+// dialLockNode connects to a node with a plain client that only keeps the
+// namespace. The lock has its own retries and quorum, so the nodes skip the
+// retry policy, circuit breaker and fallback of the cache client, and the
+// scripts they run are loaded on first use.
+func dialLockNode(ctx context.Context, config *CacheConnectionConfig, address string, password string, database int) (rueidis.Client, error) {
+	client, err := dialPlainAddress(ctx, config, address, password, database)
+	if err != nil {
+		return nil, err
+	}
+	return &cacheClient{Client: client, opts: &clientOptions{namespace: config.namespace()}}, nil
+}
+
+// Lock acquires key on a majority of nodes for ttl. The returned lease is
+// only valid until Validity(), which accounts for the time spent acquiring and
+// for clock drift. It returns ErrLockNotAcquired when every retry failed.
+func (r *Redlock) Lock(ctx context.Context, key string, ttl time.Duration) (*RedlockLease, error) {
+	owner, err := newRandomToken()
+	if err != nil {
+		return nil, err
+	}
+	lease := &RedlockLease{redlock: r, key: key, owner: owner}
+
+	for attempt := 0; attempt <= r.retryCount; attempt++ {
+		if attempt > 0 {
+			// Sleep for a random delay in [retryDelay/2, retryDelay*3/2), so
+			// contending clients do not keep retrying in lockstep
+			delay := r.retryDelay/2 + time.Duration(rand.Int64N(int64(r.retryDelay)+1))
+			select {
+			case <-ctx.Done():
+				return nil, ctx.Err()
+			case <-time.After(delay):
+			}
+		}
+
+		start := time.Now()
+		acquired := r.forEachNode(ctx, func(ctx context.Context, client rueidis.Client) error {
+			ok, err := redlockSetScript.Exec(ctx, client, []string{namespacedKey(client, key)}, []string{owner, strconv.FormatInt(ttl.Milliseconds(), 10)}).AsInt64()
+			if err != nil {
+				return err
+			}
+			if ok != 1 {
+				return ErrLockNotAcquired
+			}
+			return nil
+		})
+
+		// Clock drift allowance, plus 2ms for the Redis expire precision
+		drift := time.Duration(float64(ttl)*r.driftFactor) + 2*time.Millisecond
+		validity := ttl - time.Since(start) - drift
+		if acquired >= r.quorum && validity > 0 {
+			lease.validUntil = start.Add(ttl - drift)
+			return lease, nil
+		}
+
+		// Undo the partial acquire so the nodes we did lock are free for others
+		lease.release(context.WithoutCancel(ctx))
+		if ctx.Err() != nil {
+			return nil, ctx.Err()
+		}
+	}
+	return nil, ErrLockNotAcquired
+}
+
+// forEachNode runs fn on every node in parallel, each bounded by the node
+// timeout, and returns how many succeeded.
+func (r *Redlock) forEachNode(ctx context.Context, fn func(ctx context.Context, client rueidis.Client) error) int {
+	errs := r.forEachNodeErrors(ctx, fn)
+	succeeded := 0
+	for _, err := range errs {
+		if err == nil {
+			succeeded++
+		}
+	}
+	return succeeded
+}
+
+// forEachNodeErrors runs fn on every node in parallel and returns each node's error.
+func (r *Redlock) forEachNodeErrors(ctx context.Context, fn func(ctx context.Context, client rueidis.Client) error) []error {
+	errs := make([]error, len(r.nodes))
+	var wg sync.WaitGroup
+	for i, node := range r.nodes {
+		wg.Add(1)
+		go func(i int, node *redlockNode) {
+			defer wg.Done()
+			client, err := node.get()
+			if err != nil {
+				errs[i] = err
+				return
+			}
+			nodeCtx, cancel := context.WithTimeout(ctx, r.nodeTimeout)
+			defer cancel()
+			errs[i] = fn(nodeCtx, client)
+		}(i, node)
+	}
+	wg.Wait()
+	return errs
+}
+
+// Validity returns the time until which the lease can be relied upon.
+func (l *RedlockLease) Validity() time.Time {
+	return l.validUntil
+}
+
+// Unlock releases the lock on every node, including nodes that did not
+// acknowledge the acquire. It returns the errors of the nodes that could not be reached.
+func (l *RedlockLease) Unlock(ctx context.Context) error {
+	return l.release(ctx)
+}
+
+func (l *RedlockLease) release(ctx context.Context) error {
+	errs := l.redlock.forEachNodeErrors(ctx, func(ctx context.Context, client rueidis.Client) error {
+		return releaseScript.Exec(ctx, client, []string{namespacedKey(client, l.key)}, []string{l.owner}).Error()
+	})
+
+	var failed []error
+	for i, err := range errs {
+		if err != nil {
+			failed = append(failed, fmt.Errorf("node %s: %w", l.redlock.nodes[i].address, err))
+		}
+	}
+	if len(failed) > 0 {
+		return fmt.Errorf("failed to release lock on every node: %w", errors.Join(failed...))
+	}
+	return nil
+}
+
+// Close closes the connections to every node.
+func (r *Redlock) Close() {
+	for _, node := range r.nodes {
+		node.mu.Lock()
+		node.closed = true
+		if node.client != nil {
+			node.client.Close()
+			node.client = nil
+		}
+		node.mu.Unlock()
+	}
+}
@@ -0,0 +1,226 @@
+package redis_cache
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/alicebob/miniredis/v2"
+)
+
+// setupRedlockNodes starts n local stand-in Redis servers and writes a config
+// listing them as redlock nodes, followed by the extra addresses.
+func setupRedlockNodes(t *testing.T, n int, extra ...string) ([]*miniredis.Miniredis, string) {
+	var nodes []*miniredis.Miniredis
+	var yaml strings.Builder
+	yaml.WriteString("cache:\n  usage_cache_db:\n    redlock:\n      retry_count: 1\n      retry_delay: 10ms\n      node_timeout: 100ms\n      nodes:\n")
+	for i := 0; i < n; i++ {
+		m := miniredis.RunT(t)
+		nodes = append(nodes, m)
+		fmt.Fprintf(&yaml, "        - host: %q\n          port: %q\n", m.Host(), m.Port())
+	}
+	for _, addr := range extra {
+		host, port, _ := net.SplitHostPort(addr)
+		fmt.Fprintf(&yaml, "        - host: %q\n          port: %q\n", host, port)
+	}
+
+	tmpFile := filepath.Join(t.TempDir(), "redlock_config.yaml")
+	if err := os.WriteFile(tmpFile, []byte(yaml.String()), 0644); err != nil {
+		t.Fatalf("Failed to write test config file: %v", err)
+	}
+	return nodes, tmpFile
+}
+
+// unresponsiveAddr returns the address of a listener accepting connections but never replying.
+func unresponsiveAddr(t *testing.T) string {
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("Failed to listen: %v", err)
+	}
+	var mu sync.Mutex
+	var conns []net.Conn
+	go func() {
+		for {
+			conn, err := ln.Accept()
+			if err != nil {
+				return
+			}
+			mu.Lock()
+			conns = append(conns, conn)
+			mu.Unlock()
+		}
+	}()
+	t.Cleanup(func() {
+		ln.Close()
+		mu.Lock()
+		defer mu.Unlock()
+		for _, conn := range conns {
+			conn.Close()
+		}
+	})
+	return ln.Addr().String()
+}
+
+func TestRedlockAllNodesUp(t *testing.T) {
+	nodes, configPath := setupRedlockNodes(t, 5)
+	redlock, err := InitializeRedlock(configPath)
+	if err != nil {
+		t.Fatalf("InitializeRedlock() error = %v", err)
+	}
+	defer redlock.Close()
+
+	ctx := context.Background()
+	lease, err := redlock.Lock(ctx, "redlock-key", time.Second)
+	if err != nil {
+		t.Fatalf("Lock() error = %v", err)
+	}
+	if !lease.Validity().After(time.Now()) {
+		t.Errorf("Validity() = %v, want a time in the future", lease.Validity())
+	}
+	for i, m := range nodes {
+		if !m.Exists("redlock-key") {
+			t.Errorf("Expected node %d to hold the lock", i)
+		}
+	}
+
+	if _, err := redlock.Lock(ctx, "redlock-key", time.Second); !errors.Is(err, ErrLockNotAcquired) {
+		t.Errorf("Lock() on a held lock error = %v, want %v", err, ErrLockNotAcquired)
+	}
+
+	if err := lease.Unlock(ctx); err != nil {
+		t.Fatalf("Unlock() error = %v", err)
+	}
+	for i, m := range nodes {
+		if m.Exists("redlock-key") {
+			t.Errorf("Expected node %d to be unlocked", i)
+		}
+	}
+}
+
+func TestRedlockPartialFailure(t *testing.T) {
+	tests := []struct {
+		name    string
+		down    int
+		held    int
+		wantErr error
+	}{
+		{name: "minority of nodes down", down: 2},
+		{name: "majority of nodes down", down: 3, wantErr: ErrLockNotAcquired},
+		{name: "minority held by another owner", held: 2},
+		{name: "majority held by another owner", held: 3, wantErr: ErrLockNotAcquired},
+		{name: "nodes down and held add up to a majority", down: 1, held: 2, wantErr: ErrLockNotAcquired},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			nodes, configPath := setupRedlockNodes(t, 5)
+			redlock, err := InitializeRedlock(configPath)
+			if err != nil {
+				t.Fatalf("InitializeRedlock() error = %v", err)
+			}
+			defer redlock.Close()
+
+			for i := 0; i < tt.down; i++ {
+				nodes[i].Close()
+			}
+			for i := tt.down; i < tt.down+tt.held; i++ {
+				nodes[i].Set("redlock-key", "someone-else")
+			}
+
+			ctx := context.Background()
+			lease, err := redlock.Lock(ctx, "redlock-key", time.Second)
+			if !errors.Is(err, tt.wantErr) {
+				t.Fatalf("Lock() error = %v, want %v", err, tt.wantErr)
+			}
+
+			for i := tt.down + tt.held; i < len(nodes); i++ {
+				if tt.wantErr != nil && nodes[i].Exists("redlock-key") {
+					t.Errorf("Expected node %d to be released after a failed acquire", i)
+				}
+			}
+			for i := tt.down; i < tt.down+tt.held; i++ {
+				if got, _ := nodes[i].Get("redlock-key"); got != "someone-else" {
+					t.Errorf("Expected node %d to keep the other owner's lock, got %q", i, got)
+				}
+			}
+
+			if lease != nil {
+				err := lease.Unlock(ctx)
+				if tt.down > 0 && err == nil {
+					t.Error("Expected Unlock() to report the unreachable nodes")
+				}
+				if tt.down == 0 && err != nil {
+					t.Errorf("Unlock() error = %v", err)
+				}
+			}
+		})
+	}
+}
+
+func TestRedlockRequiresQuorumAtStartup(t *testing.T) {
+	nodes, configPath := setupRedlockNodes(t, 3)
+	nodes[0].Close()
+
+	redlock, err := InitializeRedlock(configPath)
+	if err != nil {
+		t.Fatalf("InitializeRedlock() with one node down error = %v", err)
+	}
+	redlock.Close()
+
+	nodes[1].Close()
+	if _, err := InitializeRedlock(configPath); err == nil {
+		t.Error("Expected InitializeRedlock() to fail without a quorum of reachable nodes")
+	}
+}
+
+func TestRedlockUnresponsiveNodes(t *testing.T) {
+	// Two of five nodes accept connections but never reply
+	nodes, configPath := setupRedlockNodes(t, 3, unresponsiveAddr(t), unresponsiveAddr(t))
+
+	start := time.Now()
+	redlock, err := InitializeRedlock(configPath)
+	if err != nil {
+		t.Fatalf("InitializeRedlock() error = %v", err)
+	}
+	defer redlock.Close()
+	if elapsed := time.Since(start); elapsed > time.Second {
+		t.Errorf("InitializeRedlock() took %v, want it not to wait for the unresponsive nodes", elapsed)
+	}
+
+	ctx := context.Background()
+	start = time.Now()
+	lease, err := redlock.Lock(ctx, "redlock-key", time.Second)
+	if err != nil {
+		t.Fatalf("Lock() error = %v, want the quorum of responsive nodes to grant it", err)
+	}
+	if elapsed := time.Since(start); elapsed > 500*time.Millisecond {
+		t.Errorf("Lock() took %v, want it not to wait for the unresponsive nodes", elapsed)
+	}
+	for i, m := range nodes {
+		if !m.Exists("redlock-key") {
+			t.Errorf("Expected node %d to hold the lock", i)
+		}
+	}
+
+	// The nodes use plain clients, without the cache client's retries or breaker
+	for _, node := range redlock.nodes[:len(nodes)] {
+		client, err := node.get()
+		if err != nil {
+			t.Fatalf("Expected the responsive nodes to be connected, got %v", err)
+		}
+		if opts := optionsOf(client); opts.retry != nil || opts.breaker != nil || opts.fallback != nil {
+			t.Errorf("Expected a plain client for node %s", node.address)
+		}
+	}
+
+	if err := lease.Unlock(ctx); err == nil {
+		t.Error("Expected Unlock() to report the unresponsive nodes")
+	}
+}
@@ -0,0 +1,370 @@
+package redis_cache
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"math/rand/v2"
+	"net"
+	"strings"
+	"sync/atomic"
+	"syscall"
+	"time"
+
+	"github.com/redis/rueidis"
+)
+
+// This file contains the retry policy applied to every command sent with a client :
+// 1. Classification of transient errors (READONLY, LOADING, TRYAGAIN, CLUSTERDOWN, MASTERDOWN, connection resets)
+// 2. Classification of idempotent commands, only those are retried unless the caller allows it
+// 3. Exponential backoff with jitter between attempts, within the context deadline
+// 4. Retry counters (GetRetryStats) and a log line for every retry
+//
+// rueidis already retries read-only commands on connection errors, this policy
+// also covers writes and the errors reported by Redis while it fails over or
+// loads its dataset.
+
+// RetryPolicy configures the retries of a client, set with the retry section of the config.
+type RetryPolicy struct {
+	// MaxAttempts is the number of attempts, the first one included. 1 by default,
+	// which disables retries, so callers opt in.
+	MaxAttempts int
+	// BaseBackoff is the delay before the first retry, doubled on every retry. 10ms by default.
+	BaseBackoff time.Duration
+	// MaxBackoff caps the delay between attempts. 1s by default.
+	MaxBackoff time.Duration
+	// Jitter is the fraction of each delay that is random, from 0 to 1. 0.5 by default.
+	Jitter float64
+	// RetryNonIdempotent retries every command, see WithNonIdempotentRetries to allow it per call.
+	RetryNonIdempotent bool
+
+	// Rand returns a uniform number in [0, 1), math/rand by default.
+	Rand func() float64
+	// Now is the clock, time.Now by default.
+	Now func() time.Time
+	// Sleep waits for d or until ctx is done, a timer by default.
+	Sleep func(ctx context.Context, d time.Duration) error
+	// Logf logs the retries, log.Printf by default.
+	Logf func(format string, args ...any)
+}
+
+func (p *RetryPolicy) setDefaults() {
+	if p.MaxAttempts <= 0 {
+		p.MaxAttempts = 1
+	}
+	if p.BaseBackoff <= 0 {
+		p.BaseBackoff = 10 * time.Millisecond
+	}
+	if p.MaxBackoff < p.BaseBackoff {
+		p.MaxBackoff = max(time.Second, p.BaseBackoff)
+	}
+	if p.Jitter <= 0 || p.Jitter > 1 {
+		p.Jitter = 0.5
+	}
+	if p.Rand == nil {
+		p.Rand = rand.Float64
+	}
+	if p.Now == nil {
+		p.Now = time.Now
+	}
+	if p.Sleep == nil {
+		p.Sleep = sleepContext
+	}
+	if p.Logf == nil {
+		p.Logf = log.Printf
+	}
+}
+
+// backoff returns the delay before the given retry, starting at 1.
+func (p *RetryPolicy) backoff(retry int) time.Duration {
+	delay := p.BaseBackoff
+	for i := 1; i < retry && delay < p.MaxBackoff; i++ {
+		delay *= 2
+	}
+	delay = min(delay, p.MaxBackoff)
+	// Drop up to Jitter of the delay, so clients failing together do not retry in lockstep
+	return delay - time.Duration(p.Jitter*p.Rand()*float64(delay))
+}
+
+// sleepContext waits for d or until ctx is done.
+func sleepContext(ctx context.Context, d time.Duration) error {
+	timer := time.NewTimer(d)
+	defer timer.Stop()
+	select {
+	case <-ctx.Done():
+		return ctx.Err()
+	case <-timer.C:
+		return nil
+	}
+}
+
+// RetryStats counts the retries of a client since it was created.
+type RetryStats struct {
+	// Retries is the number of attempts made after a retryable error.
+	Retries uint64
+	// Recovered is the number of commands that succeeded after at least one retry.
+	Recovered uint64
+	// Exhausted is the number of commands still failing when the attempts, or the deadline, ran out.
+	Exhausted uint64
+	// Skipped is the number of retryable errors of non idempotent commands, which were not retried.
+	Skipped uint64
+}
+
+// retrier applies a RetryPolicy and counts its retries.
+type retrier struct {
+	policy RetryPolicy
+
+	retries   atomic.Uint64
+	recovered atomic.Uint64
+	exhausted atomic.Uint64
+	skipped   atomic.Uint64
+}
+
+// newRetrier returns a retrier applying policy, or nil when it disables retries.
+func newRetrier(policy RetryPolicy) *retrier {
+	policy.setDefaults()
+	if policy.MaxAttempts == 1 {
+		return nil
+	}
+	return &retrier{policy: policy}
+}
+
+// GetRetryStats returns the retry counters of client, zero when retries are disabled.
+func GetRetryStats(client rueidis.Client) RetryStats {
+	r := optionsOf(client).retry
+	if r == nil {
+		return RetryStats{}
+	}
+	return RetryStats{
+		Retries:   r.retries.Load(),
+		Recovered: r.recovered.Load(),
+		Exhausted: r.exhausted.Load(),
+		Skipped:   r.skipped.Load(),
+	}
+}
+
+type nonIdempotentRetriesKey struct{}
+
+// WithNonIdempotentRetries allows retrying the non idempotent commands sent
+// with ctx, such as INCR or LPUSH. A connection reset may happen after Redis
+// ran the command, so a retry may apply it twice.
+func WithNonIdempotentRetries(ctx context.Context) context.Context {
+	return context.WithValue(ctx, nonIdempotentRetriesKey{}, true)
+}
+
+// run calls attempt until it returns no retryable error or the policy gives
+// up. attempt returns the first error of its replies, name describes the
+// commands in the logs.
+func (r *retrier) run(ctx context.Context, name func() string, idempotent bool, attempt func() error) {
+	err := attempt()
+	if !IsRetryableError(err) {
+		return
+	}
+	if !idempotent && !r.policy.RetryNonIdempotent && ctx.Value(nonIdempotentRetriesKey{}) == nil {
+		r.skipped.Add(1)
+		return
+	}
+
+	for n := 1; n < r.policy.MaxAttempts; n++ {
+		delay := r.policy.backoff(n)
+		if deadline, ok := ctx.Deadline(); ok && deadline.Sub(r.policy.Now()) < delay {
+			break
+		}
+		r.policy.Logf("redis_cache: retrying %s in %v after: %v (attempt %d of %d)", name(), delay, err, n+1, r.policy.MaxAttempts)
+		if r.policy.Sleep(ctx, delay) != nil {
+			break
+		}
+
+		r.retries.Add(1)
+		if err = attempt(); !IsRetryableError(err) {
+			r.recovered.Add(1)
+			return
+		}
+	}
+	r.exhausted.Add(1)
+	r.policy.Logf("redis_cache: giving up %s after: %v", name(), err)
+}
+
+// do sends cmd with the retry policy, a nil retrier sends it once.
+func (r *retrier) do(ctx context.Context, cmd rueidis.Completed, send func(context.Context, rueidis.Completed) rueidis.RedisResult) (resp rueidis.RedisResult) {
+	if r == nil {
+		return send(ctx, cmd)
+	}
+	// Keep rueidis from recycling the command after the first attempt
+	cmd = cmd.Pin()
+	r.run(ctx, func() string { return commandName(cmd) }, isIdempotent(cmd), func() error {
+		resp = send(ctx, cmd)
+		return resp.Error()
+	})
+	return resp
+}
+
+// doMulti sends multi with the retry policy. The whole batch is sent again,
+// so it is only retried when every command is idempotent.
+func (r *retrier) doMulti(ctx context.Context, multi []rueidis.Completed, send func(context.Context, ...rueidis.Completed) []rueidis.RedisResult) (resps []rueidis.RedisResult) {
+	if r == nil {
+		return send(ctx, multi...)
+	}
+	pinned := make([]rueidis.Completed, len(multi))
+	idempotent := true
+	for i, cmd := range multi {
+		pinned[i] = cmd.Pin()
+		idempotent = idempotent && isIdempotent(pinned[i])
+	}
+	name := func() string {
+		return fmt.Sprintf("a batch of %d commands", len(pinned))
+	}
+	r.run(ctx, name, idempotent, func() error {
+		resps = send(ctx, pinned...)
+		for _, resp := range resps {
+			if err := resp.Error(); IsRetryableError(err) {
+				return err
+			}
+		}
+		return nil
+	})
+	return resps
+}
+
+// doCache sends the cacheable cmd with the retry policy, cacheable commands
+// are reads and always idempotent.
+func (r *retrier) doCache(ctx context.Context, cmd rueidis.Cacheable, ttl time.Duration, send func(context.Context, rueidis.Cacheable, time.Duration) rueidis.RedisResult) (resp rueidis.RedisResult) {
+	if r == nil {
+		return send(ctx, cmd, ttl)
+	}
+	cmd = cmd.Pin()
+	r.run(ctx, func() string { return commandName(rueidis.Completed(cmd)) }, true, func() error {
+		resp = send(ctx, cmd, ttl)
+		return resp.Error()
+	})
+	return resp
+}
+
+// doMultiCache sends multi with the retry policy, the whole batch is sent again.
+func (r *retrier) doMultiCache(ctx context.Context, multi []rueidis.CacheableTTL, send func(context.Context, ...rueidis.CacheableTTL) []rueidis.RedisResult) (resps []rueidis.RedisResult) {
+	if r == nil {
+		return send(ctx, multi...)
+	}
+	pinned := make([]rueidis.CacheableTTL, len(multi))
+	for i, cmd := range multi {
+		pinned[i] = rueidis.CacheableTTL{Cmd: cmd.Cmd.Pin(), TTL: cmd.TTL}
+	}
+	name := func() string {
+		return fmt.Sprintf("a batch of %d cacheable commands", len(pinned))
+	}
+	r.run(ctx, name, true, func() error {
+		resps = send(ctx, pinned...)
+		for _, resp := range resps {
+			if err := resp.Error(); IsRetryableError(err) {
+				return err
+			}
+		}
+		return nil
+	})
+	return resps
+}
+
+// doStream sends cmd with the retry policy. Only a failure to send it is
+// retried, its reply is read once doStream returned.
+func (r *retrier) doStream(ctx context.Context, cmd rueidis.Completed, send func(context.Context, rueidis.Completed) rueidis.RedisResultStream) (stream rueidis.RedisResultStream) {
+	if r == nil {
+		return send(ctx, cmd)
+	}
+	cmd = cmd.Pin()
+	r.run(ctx, func() string { return commandName(cmd) }, isIdempotent(cmd), func() error {
+		stream = send(ctx, cmd)
+		return stream.Error()
+	})
+	return stream
+}
+
+// doMultiStream sends multi like doStream, only when every command is idempotent.
+func (r *retrier) doMultiStream(ctx context.Context, multi []rueidis.Completed, send func(context.Context, ...rueidis.Completed) rueidis.MultiRedisResultStream) (stream rueidis.MultiRedisResultStream) {
+	if r == nil {
+		return send(ctx, multi...)
+	}
+	pinned := make([]rueidis.Completed, len(multi))
+	idempotent := true
+	for i, cmd := range multi {
+		pinned[i] = cmd.Pin()
+		idempotent = idempotent && isIdempotent(pinned[i])
+	}
+	name := func() string {
+		return fmt.Sprintf("a stream of %d commands", len(pinned))
+	}
+	r.run(ctx, name, idempotent, func() error {
+		stream = send(ctx, pinned...)
+		return stream.Error()
+	})
+	return stream
+}
+
+// IsRetryableError reports whether err is transient: Redis is loading its
+// dataset, failing over or resharding, or the connection was reset.
+// Nil replies, command errors and cancelled contexts are not.
+func IsRetryableError(err error) bool {
+	if err == nil || rueidis.IsRedisNil(err) {
+		return false
+	}
+	if errors.Is(err, context.Canceled) || errors.Is(err, context.DeadlineExceeded) || errors.Is(err, rueidis.ErrClosing) {
+		return false
+	}
+	if redisErr, ok := rueidis.IsRedisErr(err); ok {
+		message := redisErr.Error()
+		return redisErr.IsLoading() || redisErr.IsTryAgain() || redisErr.IsClusterDown() ||
+			strings.HasPrefix(message, "READONLY") || strings.HasPrefix(message, "MASTERDOWN")
+	}
+	if errors.Is(err, io.EOF) || errors.Is(err, io.ErrUnexpectedEOF) || errors.Is(err, net.ErrClosed) ||
+		errors.Is(err, syscall.ECONNRESET) || errors.Is(err, syscall.ECONNREFUSED) || errors.Is(err, syscall.EPIPE) {
+		return true
+	}
+	var netErr net.Error
+	return errors.As(err, &netErr) && netErr.Timeout()
+}
+
+// idempotentWrites are the writes leaving the same data when run twice. Their
+// reply may differ, DEL of a key deleted by the first attempt returns 0.
+// MULTI and EXEC are listed so a transaction of idempotent writes is retried.
+var idempotentWrites = map[string]bool{
+	"SET": true, "MSET": true, "DEL": true, "UNLINK": true,
+	"EXPIRE": true, "PEXPIRE": true, "EXPIREAT": true, "PEXPIREAT": true, "PERSIST": true,
+	"HSET": true, "HMSET": true, "HDEL": true,
+	"SADD": true, "SREM": true, "ZADD": true, "ZREM": true,
+	"MULTI": true, "EXEC": true, "DISCARD": true,
+}
+
+// isIdempotent reports whether cmd can be sent again without changing the outcome.
+func isIdempotent(cmd rueidis.Completed) bool {
+	if cmd.IsReadOnly() {
+		return true
+	}
+	args := cmd.Commands()
+	name := strings.ToUpper(args[0])
+	if !idempotentWrites[name] {
+		return false
+	}
+	switch name {
+	case "SET":
+		// NX, XX and GET make the outcome depend on the previous value
+		for _, arg := range args[3:] {
+			switch strings.ToUpper(arg) {
+			case "NX", "XX", "GET":
+				return false
+			}
+		}
+	case "ZADD":
+		for _, arg := range args[2:] {
+			if strings.EqualFold(arg, "INCR") {
+				return false
+			}
+		}
+	}
+	return true
+}
+
+// commandName returns the name of cmd, without its keys and values.
+func commandName(cmd rueidis.Completed) string {
+	return strings.ToUpper(cmd.Commands()[0])
+}
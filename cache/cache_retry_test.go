@@ -0,0 +1,310 @@
+package redis_cache
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+	"sync"
+	"syscall"
+	"testing"
+	"time"
+
+	"github.com/alicebob/miniredis/v2"
+	"github.com/alicebob/miniredis/v2/server"
+	"github.com/redis/rueidis"
+)
+
+// faultyServer is a local stand-in Redis replying with errors to the next commands.
+type faultyServer struct {
+	*miniredis.Miniredis
+
+	mu     sync.Mutex
+	faults map[string][]string
+	calls  map[string]int
+}
+
+func startFaultyServer(t *testing.T) *faultyServer {
+	s := &faultyServer{Miniredis: miniredis.RunT(t), faults: map[string][]string{}, calls: map[string]int{}}
+	s.Server().SetPreHook(func(c *server.Peer, cmd string, args ...string) bool {
+		s.mu.Lock()
+		defer s.mu.Unlock()
+		cmd = strings.ToUpper(cmd)
+		s.calls[cmd]++
+		if faults := s.faults[cmd]; len(faults) > 0 {
+			s.faults[cmd] = faults[1:]
+			c.WriteError(faults[0])
+			return true
+		}
+		return false
+	})
+	return s
+}
+
+// fail makes the next calls of cmd reply with errs, in order.
+func (s *faultyServer) fail(cmd string, errs ...string) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.faults[cmd] = append(s.faults[cmd], errs...)
+}
+
+// callsOf returns how many times cmd was received, and resets the count.
+func (s *faultyServer) callsOf(cmd string) int {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	calls := s.calls[cmd]
+	s.calls[cmd] = 0
+	return calls
+}
+
+// connectToFaultyServer connects to s in pool mode, settings are added to usage_cache_db.
+func connectToFaultyServer(t *testing.T, s *faultyServer, settings string) rueidis.Client {
+	config := fmt.Sprintf("cache:\n  usage_cache_db:\n    host: %q\n    port: %q\n    connection_mode: pool\n", s.Host(), s.Port()) + settings
+	configPath := filepath.Join(t.TempDir(), "faulty_config.yaml")
+	if err := os.WriteFile(configPath, []byte(config), 0644); err != nil {
+		t.Fatalf("Failed to write test config file: %v", err)
+	}
+	client, err := InitializeCacheConnection(configPath)
+	if err != nil {
+		t.Fatalf("Failed to initialize test client: %v", err)
+	}
+	return client
+}
+
+// setupRetryClient connects to s with max_attempts 3 and a 10ms base backoff.
+// Retries sleep on clock, without jitter, and their log lines are returned.
+func setupRetryClient(t *testing.T, s *faultyServer, clock *fakeClock) (rueidis.Client, *[]string) {
+	client := connectToFaultyServer(t, s, `
+    retry:
+      max_attempts: 3
+      base_backoff: 10ms
+`)
+
+	var logs []string
+	policy := &optionsOf(client).retry.policy
+	policy.Rand = func() float64 { return 0 }
+	policy.Now = clock.Now
+	policy.Sleep = clock.Sleep
+	policy.Logf = func(format string, args ...any) {
+		logs = append(logs, fmt.Sprintf(format, args...))
+	}
+	return client, &logs
+}
+
+func TestIsRetryableError(t *testing.T) {
+	tests := []struct {
+		name string
+		err  error
+		want bool
+	}{
+		{name: "nil", err: nil, want: false},
+		{name: "nil reply", err: rueidis.Nil, want: false},
+		{name: "connection reset", err: &net.OpError{Op: "read", Net: "tcp", Err: syscall.ECONNRESET}, want: true},
+		{name: "broken pipe", err: fmt.Errorf("write: %w", syscall.EPIPE), want: true},
+		{name: "connection closed by the server", err: io.EOF, want: true},
+		{name: "cancelled", err: context.Canceled, want: false},
+		{name: "deadline exceeded", err: context.DeadlineExceeded, want: false},
+		{name: "client closed", err: rueidis.ErrClosing, want: false},
+		{name: "other error", err: errors.New("boom"), want: false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := IsRetryableError(tt.err); got != tt.want {
+				t.Errorf("IsRetryableError(%v) = %v, want %v", tt.err, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestRetryPolicyBackoff(t *testing.T) {
+	draw := 0.0
+	policy := RetryPolicy{BaseBackoff: 10 * time.Millisecond, MaxBackoff: 50 * time.Millisecond, Jitter: 0.5, Rand: func() float64 { return draw }}
+	policy.setDefaults()
+
+	var got []time.Duration
+	for retry := 1; retry <= 5; retry++ {
+		got = append(got, policy.backoff(retry))
+	}
+	want := []time.Duration{10 * time.Millisecond, 20 * time.Millisecond, 40 * time.Millisecond, 50 * time.Millisecond, 50 * time.Millisecond}
+	if !slices.Equal(got, want) {
+		t.Errorf("backoff() = %v, want %v", got, want)
+	}
+
+	// The jitter drops up to half of the delay
+	draw = 0.5
+	if got := policy.backoff(2); got != 15*time.Millisecond {
+		t.Errorf("backoff(2) with jitter = %v, want 15ms", got)
+	}
+}
+
+func TestIsIdempotent(t *testing.T) {
+	client, _ := setupRetryClient(t, startFaultyServer(t), &fakeClock{})
+	defer Close(client)
+	b := client.B()
+
+	tests := []struct {
+		name string
+		cmd  rueidis.Completed
+		want bool
+	}{
+		{name: "GET", cmd: b.Get().Key("k").Build(), want: true},
+		{name: "SET with an expiry", cmd: b.Set().Key("k").Value("v").PxMilliseconds(100).Build(), want: true},
+		{name: "SET NX", cmd: b.Set().Key("k").Value("v").Nx().Build(), want: false},
+		{name: "SET of the value NX", cmd: b.Set().Key("k").Value("NX").Build(), want: true},
+		{name: "DEL", cmd: b.Del().Key("k").Build(), want: true},
+		{name: "HSET", cmd: b.Hset().Key("k").FieldValue().FieldValue("f", "v").Build(), want: true},
+		{name: "ZADD INCR", cmd: b.Zadd().Key("k").Incr().ScoreMember().ScoreMember(1, "m").Build(), want: false},
+		{name: "INCR", cmd: b.Incr().Key("k").Build(), want: false},
+		{name: "LPUSH", cmd: b.Lpush().Key("k").Element("v").Build(), want: false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := isIdempotent(tt.cmd); got != tt.want {
+				t.Errorf("isIdempotent(%v) = %v, want %v", tt.cmd.Commands(), got, tt.want)
+			}
+		})
+	}
+}
+
+func TestRetryTransientErrors(t *testing.T) {
+	s := startFaultyServer(t)
+	clock := &fakeClock{now: time.Now()}
+	client, logs := setupRetryClient(t, s, clock)
+	defer Close(client)
+
+	ctx := context.Background()
+	s.callsOf("SET")
+
+	// Transient errors are retried with an exponential backoff
+	s.fail("SET", "LOADING Redis is loading the dataset in memory", "READONLY You can't write against a read only replica.")
+	if err := SetStringDataToCacheWithExpiry(ctx, client, "retry-key", "value", ExpireIn(time.Minute)); err != nil {
+		t.Fatalf("SetStringDataToCacheWithExpiry() error = %v", err)
+	}
+	if got := s.callsOf("SET"); got != 3 {
+		t.Errorf("SET was sent %d times, want 3", got)
+	}
+	if want := []time.Duration{10 * time.Millisecond, 20 * time.Millisecond}; !slices.Equal(clock.sleeps, want) {
+		t.Errorf("slept %v, want %v", clock.sleeps, want)
+	}
+	if len(*logs) != 2 || !strings.Contains((*logs)[0], "retrying SET in 10ms after: LOADING") {
+		t.Errorf("logs = %q, want a line per retry", *logs)
+	}
+	if got, want := GetRetryStats(client), (RetryStats{Retries: 2, Recovered: 1}); got != want {
+		t.Errorf("GetRetryStats() = %+v, want %+v", got, want)
+	}
+
+	// The error of the last attempt is returned once they ran out
+	s.fail("SET", "TRYAGAIN", "TRYAGAIN", "TRYAGAIN")
+	if err := SetStringDataToCacheWithExpiry(ctx, client, "retry-key", "value", ExpireIn(time.Minute)); err == nil || !strings.Contains(err.Error(), "TRYAGAIN") {
+		t.Errorf("SetStringDataToCacheWithExpiry() error = %v, want TRYAGAIN", err)
+	}
+	if got := s.callsOf("SET"); got != 3 {
+		t.Errorf("SET was sent %d times, want 3", got)
+	}
+	if got := GetRetryStats(client).Exhausted; got != 1 {
+		t.Errorf("GetRetryStats().Exhausted = %d, want 1", got)
+	}
+
+	// Command errors are not retried
+	s.fail("SET", "ERR syntax error")
+	if err := SetStringDataToCacheWithExpiry(ctx, client, "retry-key", "value", ExpireIn(time.Minute)); err == nil {
+		t.Errorf("Expected the syntax error to be returned")
+	}
+	if got := s.callsOf("SET"); got != 1 {
+		t.Errorf("SET was sent %d times, want 1", got)
+	}
+
+	// A deadline closer than the backoff stops retrying
+	clock.now = time.Now()
+	deadlineCtx, cancel := context.WithTimeout(ctx, 5*time.Millisecond)
+	defer cancel()
+	s.fail("SET", "LOADING Redis is loading the dataset in memory")
+	if err := SetStringDataToCacheWithExpiry(deadlineCtx, client, "retry-key", "value", ExpireIn(time.Minute)); err == nil {
+		t.Errorf("Expected the LOADING error within a 5ms deadline")
+	}
+	if got := s.callsOf("SET"); got != 1 {
+		t.Errorf("SET was sent %d times within the deadline, want 1", got)
+	}
+}
+
+func TestRetryNonIdempotentCommands(t *testing.T) {
+	s := startFaultyServer(t)
+	client, _ := setupRetryClient(t, s, &fakeClock{now: time.Now()})
+	defer Close(client)
+
+	ctx := context.Background()
+	incr := client.B().Incrby().Key("retry-counter").Increment(1).Build()
+
+	// INCR may have been applied before a connection reset, so it is not retried
+	s.fail("INCRBY", "READONLY You can't write against a read only replica.")
+	if err := client.Do(ctx, incr).Error(); err == nil {
+		t.Errorf("Expected INCRBY not to be retried")
+	}
+	if got := GetRetryStats(client); got.Skipped != 1 || got.Retries != 0 {
+		t.Errorf("GetRetryStats() = %+v, want 1 skipped", got)
+	}
+
+	// unless the caller allows it
+	s.fail("INCRBY", "READONLY You can't write against a read only replica.")
+	incr = client.B().Incrby().Key("retry-counter").Increment(1).Build()
+	if n, err := client.Do(WithNonIdempotentRetries(ctx), incr).AsInt64(); err != nil || n != 1 {
+		t.Errorf("INCRBY with WithNonIdempotentRetries = %d, %v, want 1", n, err)
+	}
+
+	// A batch is sent again as a whole, only when every command is idempotent
+	s.callsOf("SET")
+	s.fail("SET", "LOADING Redis is loading the dataset in memory")
+	p := NewPipeline(client)
+	p.SetString("retry-a", "a", ExpireIn(time.Minute))
+	p.SetString("retry-b", "b", ExpireIn(time.Minute))
+	if err := p.Exec(ctx); err != nil {
+		t.Errorf("Exec() error = %v", err)
+	}
+	if got := s.callsOf("SET"); got != 4 {
+		t.Errorf("SET was sent %d times, want 4", got)
+	}
+
+	s.fail("SET", "LOADING Redis is loading the dataset in memory")
+	p = NewPipeline(client)
+	p.SetString("retry-a", "a", ExpireIn(time.Minute))
+	p.Incr("retry-counter", 1)
+	if err := p.Exec(ctx); err == nil {
+		t.Errorf("Expected a batch with INCRBY not to be retried")
+	}
+	if value, _ := s.Get(namespacedKey(client, "retry-counter")); value != "2" {
+		t.Errorf("retry-counter = %q, want INCRBY applied once", value)
+	}
+}
+
+func TestRetryCacheableCommands(t *testing.T) {
+	s := startFaultyServer(t)
+	client, _ := setupRetryClient(t, s, &fakeClock{now: time.Now()})
+	defer Close(client)
+
+	ctx := context.Background()
+	s.Set("retry-cached", "value")
+	s.callsOf("GET")
+
+	s.fail("GET", "MASTERDOWN Link with MASTER is down and replica-serve-stale-data is set to no")
+	if value, err := client.DoCache(ctx, client.B().Get().Key("retry-cached").Cache(), time.Minute).ToString(); err != nil || value != "value" {
+		t.Errorf("DoCache() = %q, %v, want value", value, err)
+	}
+	s.fail("GET", "MASTERDOWN Link with MASTER is down and replica-serve-stale-data is set to no")
+	resps := client.DoMultiCache(ctx, rueidis.CT(client.B().Get().Key("retry-cached").Cache(), time.Minute))
+	if value, err := resps[0].ToString(); err != nil || value != "value" {
+		t.Errorf("DoMultiCache() = %q, %v, want value", value, err)
+	}
+	if got := s.callsOf("GET"); got != 4 {
+		t.Errorf("GET was sent %d times, want 4", got)
+	}
+	if got := GetRetryStats(client); got.Recovered != 2 {
+		t.Errorf("GetRetryStats() = %+v, want 2 recovered commands", got)
+	}
+}
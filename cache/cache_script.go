@@ -0,0 +1,253 @@
+package redis_cache
+
+import (
+	"context"
+	"crypto/sha1"
+	"encoding/hex"
+	"fmt"
+	"io/fs"
+	"path"
+	"strings"
+	"sync"
+
+	"github.com/redis/rueidis"
+)
+
+// This file contains the Lua script registry :
+// 1. Methods to register scripts from Go strings or from .lua files, such as an embed.FS
+// 2. Methods to run a script with EVALSHA, falling back to EVAL on NOSCRIPT, or read-only with EVALSHA_RO / EVAL_RO
+// 3. Method to preload every script with SCRIPT LOAD, DefaultScripts is preloaded on connect
+// 4. Methods to decode script results into typed Go values
+//
+// Keys passed to a script are namespaced like every other key of the package.
+
+// DefaultScripts is preloaded on every node by InitializeCacheConnection.
+// Register scripts on it before connecting, the NOSCRIPT fallback covers
+// scripts registered later and nodes that restarted.
+var DefaultScripts = NewScriptRegistry()
+
+// Script is a registered Lua script.
+type Script struct {
+	name     string
+	source   string
+	sha      string
+	lua      *rueidis.Lua
+	readOnly *rueidis.Lua
+}
+
+// Name returns the name the script was registered with.
+func (s *Script) Name() string {
+	return s.name
+}
+
+// SHA returns the SHA1 digest Redis identifies the script with.
+func (s *Script) SHA() string {
+	return s.sha
+}
+
+// Exec runs the script with EVALSHA, falling back to EVAL when Redis does not know it yet.
+func (s *Script) Exec(ctx context.Context, client rueidis.Client, keys []string, args ...string) rueidis.RedisResult {
+	return s.lua.Exec(ctx, client, namespacedKeys(client, keys), args)
+}
+
+// ExecRO runs the script with EVALSHA_RO, falling back to EVAL_RO. Read-only
+// runs may be served by replicas and fail if the script writes (Redis 7+).
+func (s *Script) ExecRO(ctx context.Context, client rueidis.Client, keys []string, args ...string) rueidis.RedisResult {
+	return s.readOnly.Exec(ctx, client, namespacedKeys(client, keys), args)
+}
+
+// build returns the EVALSHA command of a run on keys, already namespaced, to
+// be sent with other commands. Redis answers NOSCRIPT when it does not know
+// the script, see rerunNoScript.
+func (s *Script) build(client rueidis.Client, keys []string, args ...string) rueidis.Completed {
+	return client.B().Evalsha().Sha1(s.sha).Numkeys(int64(len(keys))).Key(keys...).Arg(args...).Build()
+}
+
+// rerunNoScript runs again the commands of build that failed with NOSCRIPT,
+// runs maps their index in resps to their keys and arguments, and replaces
+// their results. The rerun falls back to EVAL, which also loads the script.
+func (s *Script) rerunNoScript(ctx context.Context, client rueidis.Client, runs map[int]rueidis.LuaExec, resps []rueidis.RedisResult) {
+	for i, run := range runs {
+		if err, ok := rueidis.IsRedisErr(resps[i].Error()); ok && err.IsNoScript() {
+			resps[i] = s.lua.Exec(ctx, client, run.Keys, run.Args)
+		}
+	}
+}
+
+// newScript returns source as a Script, without registering it.
+func newScript(name string, source string) *Script {
+	sum := sha1.Sum([]byte(source))
+	return &Script{
+		name:     name,
+		source:   source,
+		sha:      hex.EncodeToString(sum[:]),
+		lua:      rueidis.NewLuaScript(source),
+		readOnly: rueidis.NewLuaScriptReadOnly(source),
+	}
+}
+
+// ScriptRegistry holds named Lua scripts.
+type ScriptRegistry struct {
+	mu      sync.RWMutex
+	scripts map[string]*Script
+}
+
+// NewScriptRegistry returns an empty registry.
+func NewScriptRegistry() *ScriptRegistry {
+	return &ScriptRegistry{scripts: make(map[string]*Script)}
+}
+
+// Register adds source under name. Registering another source under a name
+// already taken is an error, registering the same source again is not.
+func (r *ScriptRegistry) Register(name string, source string) (*Script, error) {
+	if name == "" {
+		return nil, fmt.Errorf("script name must not be empty")
+	}
+	script := newScript(name, source)
+
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if existing, ok := r.scripts[name]; ok {
+		if existing.sha != script.sha {
+			return nil, fmt.Errorf("script %s is already registered with another source", name)
+		}
+		return existing, nil
+	}
+	r.scripts[name] = script
+	return script, nil
+}
+
+// RegisterFS registers every file of fsys matching the patterns, "*.lua" by
+// default, named after the file without its extension: scripts/unlock.lua
+// is registered as "unlock".
+func (r *ScriptRegistry) RegisterFS(fsys fs.FS, patterns ...string) error {
+	if len(patterns) == 0 {
+		patterns = []string{"*.lua"}
+	}
+	for _, pattern := range patterns {
+		files, err := fs.Glob(fsys, pattern)
+		if err != nil {
+			return fmt.Errorf("failed to list scripts: %v", err)
+		}
+		for _, file := range files {
+			source, err := fs.ReadFile(fsys, file)
+			if err != nil {
+				return fmt.Errorf("failed to read script %s: %v", file, err)
+			}
+			name := strings.TrimSuffix(path.Base(file), path.Ext(file))
+			if _, err := r.Register(name, string(source)); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+// Script returns the script registered under name.
+func (r *ScriptRegistry) Script(name string) (*Script, bool) {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+	script, ok := r.scripts[name]
+	return script, ok
+}
+
+// Preload loads every registered script on every node with SCRIPT LOAD, so
+// the first runs do not pay for the NOSCRIPT fallback.
+func (r *ScriptRegistry) Preload(ctx context.Context, client rueidis.Client) error {
+	r.mu.RLock()
+	scripts := make([]*Script, 0, len(r.scripts))
+	for _, script := range r.scripts {
+		scripts = append(scripts, script)
+	}
+	r.mu.RUnlock()
+	if len(scripts) == 0 {
+		return nil
+	}
+
+	for _, node := range client.Nodes() {
+		cmds := make(rueidis.Commands, len(scripts))
+		for i, script := range scripts {
+			cmds[i] = node.B().ScriptLoad().Script(script.source).Build()
+		}
+		for i, resp := range node.DoMulti(ctx, cmds...) {
+			sha, err := resp.ToString()
+			if err != nil {
+				return fmt.Errorf("failed to load script %s: %w", scripts[i].name, err)
+			}
+			if sha != scripts[i].sha {
+				return fmt.Errorf("failed to load script %s: got sha %s, want %s", scripts[i].name, sha, scripts[i].sha)
+			}
+		}
+	}
+	return nil
+}
+
+// RunScript runs script and decodes its result into T, see decodeScriptResult.
+func RunScript[T any](ctx context.Context, client rueidis.Client, script *Script, keys []string, args ...string) (T, error) {
+	return decodeScriptResult[T](script.Exec(ctx, client, keys, args...))
+}
+
+// RunScriptRO runs script read-only and decodes its result into T, see decodeScriptResult.
+func RunScriptRO[T any](ctx context.Context, client rueidis.Client, script *Script, keys []string, args ...string) (T, error) {
+	return decodeScriptResult[T](script.ExecRO(ctx, client, keys, args...))
+}
+
+// decodeScriptResult converts the reply of a script into T:
+//   - string, []byte, int64, int, float64 and bool are converted from the Lua
+//     string, number or boolean reply, return tostring(x) for a fractional float64
+//   - []string, []int64 and map[string]string from a Lua table, the map from a
+//     flat {field, value, ...} table
+//   - rueidis.RedisMessage is returned as is
+//   - any other type is decoded from a string reply with DefaultCodec, see
+//     cmsgpack.pack or cjson.encode on the Lua side
+//
+// A nil reply, Lua false or nil, decodes to the zero value of T.
+func decodeScriptResult[T any](resp rueidis.RedisResult) (T, error) {
+	var v T
+	err := resp.Error()
+	if rueidis.IsRedisNil(err) {
+		return v, nil
+	}
+	if err != nil {
+		return v, fmt.Errorf("failed to run script: %w", err)
+	}
+
+	switch p := any(&v).(type) {
+	case *string:
+		*p, err = resp.ToString()
+	case *[]byte:
+		*p, err = resp.AsBytes()
+	case *int64:
+		*p, err = resp.AsInt64()
+	case *int:
+		var n int64
+		n, err = resp.AsInt64()
+		*p = int(n)
+	case *float64:
+		// Lua numbers are truncated to integers, fractions come back as strings
+		if n, intErr := resp.AsInt64(); intErr == nil {
+			*p = float64(n)
+		} else {
+			*p, err = resp.AsFloat64()
+		}
+	case *bool:
+		*p, err = resp.AsBool()
+	case *[]string:
+		*p, err = resp.AsStrSlice()
+	case *[]int64:
+		*p, err = resp.AsIntSlice()
+	case *map[string]string:
+		*p, err = resp.AsStrMap()
+	case *rueidis.RedisMessage:
+		*p, err = resp.ToMessage()
+	default:
+		var data string
+		if data, err = resp.ToString(); err == nil {
+			v, err = decodeValue[T](DefaultCodec, data)
+		}
+	}
+	if err != nil {
+		return v, fmt.Errorf("failed to decode script result: %v", err)
+	}
+	return v, nil
+}
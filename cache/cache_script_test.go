@@ -0,0 +1,134 @@
+package redis_cache
+
+import (
+	"context"
+	"embed"
+	"testing"
+	"time"
+)
+
+//go:embed testdata/scripts/*.lua
+var testScripts embed.FS
+
+func TestScriptRegistry(t *testing.T) {
+	registry := NewScriptRegistry()
+	if err := registry.RegisterFS(testScripts, "testdata/scripts/*.lua"); err != nil {
+		t.Fatalf("RegisterFS() error = %v", err)
+	}
+	for _, name := range []string{"incr_capped", "hash_fields"} {
+		if _, ok := registry.Script(name); !ok {
+			t.Errorf("Expected script %s to be registered from its file", name)
+		}
+	}
+
+	if _, err := registry.Register("incr_capped", "return 1"); err == nil {
+		t.Errorf("Expected an error registering another source under a taken name")
+	}
+	first, _ := registry.Register("constant", "return 1")
+	if second, err := registry.Register("constant", "return 1"); err != nil || second != first {
+		t.Errorf("Register() of the same source = %v, %v, want the registered script", second, err)
+	}
+}
+
+func TestRunScript(t *testing.T) {
+	client := setupTestClient(t)
+	defer Close(client)
+
+	ctx := context.Background()
+	registry := NewScriptRegistry()
+	if err := registry.RegisterFS(testScripts, "testdata/scripts/*.lua"); err != nil {
+		t.Fatalf("RegisterFS() error = %v", err)
+	}
+	incrCapped, _ := registry.Script("incr_capped")
+
+	// Without preloading, EVALSHA fails with NOSCRIPT and falls back to EVAL
+	client.Do(ctx, client.B().ScriptFlush().Build())
+	DeleteDataFromCache(ctx, client, "script-counter")
+	for _, want := range []int64{4, 8, 10} {
+		if got, err := RunScript[int64](ctx, client, incrCapped, []string{"script-counter"}, "4", "10"); err != nil || got != want {
+			t.Errorf("RunScript() = %d, %v, want %d", got, err, want)
+		}
+	}
+
+	// Read-only runs reject writes
+	if _, err := RunScriptRO[int64](ctx, client, incrCapped, []string{"script-counter"}, "1", "20"); err == nil {
+		t.Errorf("Expected RunScriptRO() of a writing script to fail")
+	}
+
+	SetHashFieldsToCache(ctx, client, "script-hash", map[string]string{"name": "ada", "role": "admin"}, ExpireIn(time.Minute))
+	hashFields, _ := registry.Script("hash_fields")
+	fields, err := RunScriptRO[map[string]string](ctx, client, hashFields, []string{"script-hash"})
+	if err != nil || fields["name"] != "ada" || fields["role"] != "admin" {
+		t.Errorf("RunScriptRO() = %v, %v, want the hash fields", fields, err)
+	}
+}
+
+func TestDecodeScriptResult(t *testing.T) {
+	client := setupTestClient(t)
+	defer Close(client)
+
+	ctx := context.Background()
+	registry := NewScriptRegistry()
+	run := func(source string) *Script {
+		script, err := registry.Register(source, source)
+		if err != nil {
+			t.Fatalf("Register() error = %v", err)
+		}
+		return script
+	}
+
+	if got, err := RunScript[string](ctx, client, run("return 'hello'"), nil); err != nil || got != "hello" {
+		t.Errorf("RunScript[string]() = %q, %v", got, err)
+	}
+	if got, err := RunScript[int](ctx, client, run("return 42"), nil); err != nil || got != 42 {
+		t.Errorf("RunScript[int]() = %d, %v", got, err)
+	}
+	if got, err := RunScript[float64](ctx, client, run("return tostring(1.5)"), nil); err != nil || got != 1.5 {
+		t.Errorf("RunScript[float64]() = %v, %v", got, err)
+	}
+	if got, err := RunScript[bool](ctx, client, run("return true"), nil); err != nil || !got {
+		t.Errorf("RunScript[bool]() = %v, %v", got, err)
+	}
+	if got, err := RunScript[bool](ctx, client, run("return false"), nil); err != nil || got {
+		t.Errorf("RunScript[bool]() of false = %v, %v, want the zero value", got, err)
+	}
+	if got, err := RunScript[[]string](ctx, client, run("return {'a', 'b'}"), nil); err != nil || len(got) != 2 || got[1] != "b" {
+		t.Errorf("RunScript[[]string]() = %v, %v", got, err)
+	}
+	if got, err := RunScript[[]int64](ctx, client, run("return {1, 2, 3}"), nil); err != nil || len(got) != 3 || got[2] != 3 {
+		t.Errorf("RunScript[[]int64]() = %v, %v", got, err)
+	}
+
+	// Other types are decoded with DefaultCodec
+	type profile struct {
+		Name string `json:"name"`
+		Age  int    `json:"age"`
+	}
+	defer func(codec Codec) { DefaultCodec = codec }(DefaultCodec)
+	DefaultCodec = JSONCodec{}
+	if got, err := RunScript[profile](ctx, client, run("return cjson.encode({name = 'ada', age = 36})"), nil); err != nil || got != (profile{Name: "ada", Age: 36}) {
+		t.Errorf("RunScript[profile]() = %+v, %v", got, err)
+	}
+
+	if _, err := RunScript[int64](ctx, client, run("return 'not a number'"), nil); err == nil {
+		t.Errorf("Expected an error decoding a string into int64")
+	}
+}
+
+func TestDefaultScriptsPreloadedOnConnect(t *testing.T) {
+	script, err := DefaultScripts.Register("preload-test", "return 'preloaded'")
+	if err != nil {
+		t.Fatalf("Register() error = %v", err)
+	}
+
+	flusher := setupTestClient(t)
+	flusher.Do(context.Background(), flusher.B().ScriptFlush().Build())
+	Close(flusher)
+
+	client := setupTestClient(t)
+	defer Close(client)
+	exists, err := client.Do(context.Background(), client.B().ScriptExists().Sha1(script.SHA()).Build()).AsIntSlice()
+	if err != nil || len(exists) != 1 || exists[0] != 1 {
+		t.Errorf("SCRIPT EXISTS = %v, %v, want the script loaded on connect", exists, err)
+	}
+}
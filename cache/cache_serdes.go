@@ -1,11 +1,108 @@
 package redis_cache
 
-import "github.com/vmihailenco/msgpack"
+import (
+	"encoding/json"
 
-func (c *CacheDataUnit) Serialize(data CacheDataUnit) ([]byte, error) {
+	"github.com/vmihailenco/msgpack/v5"
+)
+
+// Codec converts structured values to and from the bytes stored in Redis.
+type Codec interface {
+	Marshal(v interface{}) ([]byte, error)
+	Unmarshal(data []byte, v interface{}) error
+}
+
+// MsgpackCodec encodes values with msgpack, the same encoding as CacheDataUnit.Serialize.
+type MsgpackCodec struct{}
+
+func (MsgpackCodec) Marshal(v interface{}) ([]byte, error) {
+	return msgpack.Marshal(v)
+}
+
+func (MsgpackCodec) Unmarshal(data []byte, v interface{}) error {
+	return msgpack.Unmarshal(data, v)
+}
+
+// JSONCodec encodes values as JSON, useful when other services read the payloads.
+type JSONCodec struct{}
+
+func (JSONCodec) Marshal(v interface{}) ([]byte, error) {
+	return json.Marshal(v)
+}
+
+func (JSONCodec) Unmarshal(data []byte, v interface{}) error {
+	return json.Unmarshal(data, v)
+}
+
+// DefaultCodec is the codec used for structured payloads unless one is given explicitly.
+var DefaultCodec Codec = MsgpackCodec{}
+
+func (c *CacheDataUnit[T]) Serialize(data CacheDataUnit[T]) ([]byte, error) {
 	return msgpack.Marshal(data)
 }
 
 func Desiarlize(data []byte, output_data interface{}) error {
 	return msgpack.Unmarshal(data, output_data)
 }
+
+// encodeValue encodes v with codec, falling back to DefaultCodec.
+func encodeValue(codec Codec, v interface{}) (string, error) {
+	if codec == nil {
+		codec = DefaultCodec
+	}
+	data, err := codec.Marshal(v)
+	if err != nil {
+		return "", err
+	}
+	return string(data), nil
+}
+
+// decodeValue decodes data into a new T with codec, falling back to DefaultCodec.
+func decodeValue[T any](codec Codec, data string) (T, error) {
+	var v T
+	if codec == nil {
+		codec = DefaultCodec
+	}
+	err := codec.Unmarshal([]byte(data), &v)
+	return v, err
+}
+
+// encodeMember encodes a set or sorted set member. Strings and byte slices are
+// stored as-is, so they stay readable and keep their lexicographic order;
+// every other type goes through codec.
+func encodeMember[T any](codec Codec, member T) (string, error) {
+	switch v := any(member).(type) {
+	case string:
+		return v, nil
+	case []byte:
+		return string(v), nil
+	}
+	return encodeValue(codec, member)
+}
+
+// encodeMembers encodes every member with encodeMember.
+func encodeMembers[T any](codec Codec, members []T) ([]string, error) {
+	encoded := make([]string, len(members))
+	for i, member := range members {
+		value, err := encodeMember(codec, member)
+		if err != nil {
+			return nil, err
+		}
+		encoded[i] = value
+	}
+	return encoded, nil
+}
+
+// decodeMember is the inverse of encodeMember.
+func decodeMember[T any](codec Codec, data string) (T, error) {
+	var v T
+	switch p := any(&v).(type) {
+	case *string:
+		*p = data
+		return v, nil
+	case *[]byte:
+		*p = []byte(data)
+		return v, nil
+	}
+	return decodeValue[T](codec, data)
+}
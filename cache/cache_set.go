@@ -0,0 +1,124 @@
+package redis_cache
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/redis/rueidis"
+)
+
+// This file contains the following methods for sets :
+// 1. Methods to add and remove members (SADD / SREM)
+// 2. Methods to check membership, list members and count them (SISMEMBER / SMEMBERS / SCARD)
+// 3. Set, the same methods on a set of T whose members are encoded with a Codec
+//
+// Members are encoded with DefaultCodec, or the Codec of a Set, except strings
+// and byte slices which are stored as-is.
+
+// AddToSet adds members to the set and returns how many were not already present.
+func AddToSet[T any](ctx context.Context, client rueidis.Client, key string, members ...T) (int64, error) {
+	return NewSet[T](client, key).Add(ctx, members...)
+}
+
+// RemoveFromSet removes members from the set and returns how many were present.
+func RemoveFromSet[T any](ctx context.Context, client rueidis.Client, key string, members ...T) (int64, error) {
+	return NewSet[T](client, key).Remove(ctx, members...)
+}
+
+// IsSetMember reports whether member is in the set.
+func IsSetMember[T any](ctx context.Context, client rueidis.Client, key string, member T) (bool, error) {
+	return NewSet[T](client, key).IsMember(ctx, member)
+}
+
+// GetSetMembers returns every member of the set, in no particular order.
+func GetSetMembers[T any](ctx context.Context, client rueidis.Client, key string) ([]T, error) {
+	return NewSet[T](client, key).Members(ctx)
+}
+
+// GetSetSize returns the number of members in the set.
+func GetSetSize(ctx context.Context, client rueidis.Client, key string) (int64, error) {
+	size, err := client.Do(ctx, client.B().Scard().Key(namespacedKey(client, key)).Build()).AsInt64()
+	if err != nil {
+		return 0, fmt.Errorf("failed to get set size: %w", err)
+	}
+	return size, nil
+}
+
+// Set is a set of T stored under a key. Members are encoded with Codec.
+type Set[T any] struct {
+	client rueidis.Client
+	key    string
+
+	// Codec encodes the members, DefaultCodec when nil.
+	Codec Codec
+}
+
+// NewSet returns a set of T stored under key.
+func NewSet[T any](client rueidis.Client, key string) *Set[T] {
+	return &Set[T]{client: client, key: key}
+}
+
+// Add adds members to the set and returns how many were not already present.
+func (s *Set[T]) Add(ctx context.Context, members ...T) (int64, error) {
+	if len(members) == 0 {
+		return 0, nil
+	}
+	encoded, err := encodeMembers(s.Codec, members)
+	if err != nil {
+		return 0, fmt.Errorf("failed to encode set members: %v", err)
+	}
+	added, err := s.client.Do(ctx, s.client.B().Sadd().Key(namespacedKey(s.client, s.key)).Member(encoded...).Build()).AsInt64()
+	if err != nil {
+		return 0, fmt.Errorf("failed to add members to set: %w", err)
+	}
+	return added, nil
+}
+
+// Remove removes members from the set and returns how many were present.
+func (s *Set[T]) Remove(ctx context.Context, members ...T) (int64, error) {
+	if len(members) == 0 {
+		return 0, nil
+	}
+	encoded, err := encodeMembers(s.Codec, members)
+	if err != nil {
+		return 0, fmt.Errorf("failed to encode set members: %v", err)
+	}
+	removed, err := s.client.Do(ctx, s.client.B().Srem().Key(namespacedKey(s.client, s.key)).Member(encoded...).Build()).AsInt64()
+	if err != nil {
+		return 0, fmt.Errorf("failed to remove members from set: %w", err)
+	}
+	return removed, nil
+}
+
+// IsMember reports whether member is in the set.
+func (s *Set[T]) IsMember(ctx context.Context, member T) (bool, error) {
+	encoded, err := encodeMember(s.Codec, member)
+	if err != nil {
+		return false, fmt.Errorf("failed to encode set member: %v", err)
+	}
+	found, err := s.client.Do(ctx, s.client.B().Sismember().Key(namespacedKey(s.client, s.key)).Member(encoded).Build()).AsBool()
+	if err != nil {
+		return false, fmt.Errorf("failed to check set membership: %w", err)
+	}
+	return found, nil
+}
+
+// Members returns every member of the set, in no particular order.
+func (s *Set[T]) Members(ctx context.Context) ([]T, error) {
+	values, err := s.client.Do(ctx, s.client.B().Smembers().Key(namespacedKey(s.client, s.key)).Build()).AsStrSlice()
+	if err != nil {
+		return nil, fmt.Errorf("failed to get set members: %w", err)
+	}
+	members := make([]T, len(values))
+	for i, value := range values {
+		if members[i], err = decodeMember[T](s.Codec, value); err != nil {
+			return nil, fmt.Errorf("failed to decode set member: %v", err)
+		}
+	}
+	return members, nil
+}
+
+// Size returns the number of members in the set.
+func (s *Set[T]) Size(ctx context.Context) (int64, error) {
+	return GetSetSize(ctx, s.client, s.key)
+}
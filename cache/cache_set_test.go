@@ -0,0 +1,282 @@
+package redis_cache
+
+import (
+	"context"
+	"slices"
+	"sort"
+	"testing"
+)
+
+func TestSetOperations(t *testing.T) {
+	client := setupTestClient(t)
+	ctx := context.Background()
+	key := "set-seen-ids"
+	DeleteDataFromCache(ctx, client, key)
+	DeleteDataFromCache(ctx, client, "set-raw-strings")
+	t.Cleanup(func() {
+		DeleteDataFromCache(ctx, client, key)
+		DeleteDataFromCache(ctx, client, "set-raw-strings")
+		Close(client)
+	})
+
+	added, err := AddToSet(ctx, client, key, 1, 2, 3, 3)
+	if err != nil {
+		t.Fatalf("AddToSet() error = %v", err)
+	}
+	if added != 3 {
+		t.Errorf("AddToSet() = %d, want 3", added)
+	}
+
+	found, err := IsSetMember(ctx, client, key, 2)
+	if err != nil || !found {
+		t.Errorf("IsSetMember(2) = %v, %v, want true, nil", found, err)
+	}
+	found, err = IsSetMember(ctx, client, key, 4)
+	if err != nil || found {
+		t.Errorf("IsSetMember(4) = %v, %v, want false, nil", found, err)
+	}
+
+	removed, err := RemoveFromSet(ctx, client, key, 1, 4)
+	if err != nil || removed != 1 {
+		t.Errorf("RemoveFromSet() = %d, %v, want 1, nil", removed, err)
+	}
+
+	members, err := GetSetMembers[int](ctx, client, key)
+	if err != nil {
+		t.Fatalf("GetSetMembers() error = %v", err)
+	}
+	sort.Ints(members)
+	if len(members) != 2 || members[0] != 2 || members[1] != 3 {
+		t.Errorf("GetSetMembers() = %v, want [2 3]", members)
+	}
+
+	size, err := GetSetSize(ctx, client, key)
+	if err != nil || size != 2 {
+		t.Errorf("GetSetSize() = %d, %v, want 2, nil", size, err)
+	}
+
+	// Strings are stored as-is
+	if _, err := AddToSet(ctx, client, "set-raw-strings", "alice"); err != nil {
+		t.Fatalf("AddToSet() error = %v", err)
+	}
+	raw, err := client.Do(ctx, client.B().Smembers().Key("set-raw-strings").Build()).AsStrSlice()
+	if err != nil || len(raw) != 1 || raw[0] != "alice" {
+		t.Errorf("Expected the raw member alice, got %v, %v", raw, err)
+	}
+}
+
+func TestSortedSetOperations(t *testing.T) {
+	client := setupTestClient(t)
+	ctx := context.Background()
+	key := "zset-leaderboard"
+	DeleteDataFromCache(ctx, client, key)
+	DeleteDataFromCache(ctx, client, "zset-lex")
+	t.Cleanup(func() {
+		DeleteDataFromCache(ctx, client, key)
+		DeleteDataFromCache(ctx, client, "zset-lex")
+		Close(client)
+	})
+
+	added, err := AddToSortedSet(ctx, client, key, SortedSetAddOptions{},
+		ScoredMember[string]{Member: "alice", Score: 10},
+		ScoredMember[string]{Member: "bob", Score: 20},
+		ScoredMember[string]{Member: "carol", Score: 30},
+	)
+	if err != nil || added != 3 {
+		t.Fatalf("AddToSortedSet() = %d, %v, want 3, nil", added, err)
+	}
+
+	// GT only raises scores
+	changed, err := AddToSortedSet(ctx, client, key, SortedSetAddOptions{OnlyExisting: true, OnlyGreater: true, Changed: true},
+		ScoredMember[string]{Member: "alice", Score: 5},
+		ScoredMember[string]{Member: "bob", Score: 25},
+		ScoredMember[string]{Member: "dave", Score: 50},
+	)
+	if err != nil || changed != 1 {
+		t.Errorf("AddToSortedSet() with XX GT CH = %d, %v, want 1, nil", changed, err)
+	}
+
+	if _, err := AddToSortedSet[string](ctx, client, key, SortedSetAddOptions{OnlyNew: true, OnlyLess: true}); err != nil {
+		t.Errorf("AddToSortedSet() without members error = %v", err)
+	}
+	if _, err := AddToSortedSet(ctx, client, key, SortedSetAddOptions{OnlyNew: true, OnlyLess: true}, ScoredMember[string]{Member: "x"}); err == nil {
+		t.Error("Expected an error for NX combined with LT")
+	}
+
+	score, err := IncrementSortedSetScore(ctx, client, key, "alice", 100)
+	if err != nil || score != 110 {
+		t.Errorf("IncrementSortedSetScore() = %v, %v, want 110, nil", score, err)
+	}
+
+	top, err := GetSortedSetRange[string](ctx, client, key, SortedSetByRank(0, -1).Rev().Limit(0, 2))
+	if err != nil {
+		t.Fatalf("GetSortedSetRange() by rank error = %v", err)
+	}
+	if len(top) != 2 || top[0].Member != "alice" || top[0].Score != 110 || top[1].Member != "carol" {
+		t.Errorf("GetSortedSetRange() by rank = %+v, want alice then carol", top)
+	}
+
+	page, err := GetSortedSetRange[string](ctx, client, key, SortedSetByScore("-inf", "+inf").Limit(1, 1))
+	if err != nil {
+		t.Fatalf("GetSortedSetRange() by score error = %v", err)
+	}
+	if len(page) != 1 || page[0].Member != "carol" {
+		t.Errorf("GetSortedSetRange() by score page = %+v, want carol", page)
+	}
+
+	rank, found, err := GetSortedSetRank(ctx, client, key, "bob", false)
+	if err != nil || !found || rank != 0 {
+		t.Errorf("GetSortedSetRank(bob) = %d, %v, %v, want 0, true, nil", rank, found, err)
+	}
+	_, found, err = GetSortedSetRank(ctx, client, key, "dave", false)
+	if err != nil || found {
+		t.Errorf("GetSortedSetRank(dave) = %v, %v, want false, nil", found, err)
+	}
+
+	removed, err := RemoveFromSortedSet(ctx, client, key, "bob")
+	if err != nil || removed != 1 {
+		t.Errorf("RemoveFromSortedSet() = %d, %v, want 1, nil", removed, err)
+	}
+
+	lexKey := "zset-lex"
+	if _, err := AddToSortedSet(ctx, client, lexKey, SortedSetAddOptions{},
+		ScoredMember[string]{Member: "apple"},
+		ScoredMember[string]{Member: "banana"},
+		ScoredMember[string]{Member: "cherry"},
+	); err != nil {
+		t.Fatalf("AddToSortedSet() error = %v", err)
+	}
+	lex, err := GetSortedSetRange[string](ctx, client, lexKey, SortedSetByLex("[b", "+"))
+	if err != nil {
+		t.Fatalf("GetSortedSetRange() by lex error = %v", err)
+	}
+	if len(lex) != 2 || lex[0].Member != "banana" || lex[1].Member != "cherry" {
+		t.Errorf("GetSortedSetRange() by lex = %+v, want banana and cherry", lex)
+	}
+}
+
+func TestSortedSetRangePagination(t *testing.T) {
+	client := setupTestClient(t)
+	ctx := context.Background()
+	key := "zset-pages"
+	DeleteDataFromCache(ctx, client, key)
+	t.Cleanup(func() {
+		DeleteDataFromCache(ctx, client, key)
+		Close(client)
+	})
+
+	members := make([]ScoredMember[int], 20)
+	for i := range members {
+		members[i] = ScoredMember[int]{Member: i, Score: float64(i)}
+	}
+	if _, err := AddToSortedSet(ctx, client, key, SortedSetAddOptions{}, members...); err != nil {
+		t.Fatalf("AddToSortedSet() error = %v", err)
+	}
+
+	tests := []struct {
+		name    string
+		r       SortedSetRange
+		want    []int
+		wantErr bool
+	}{
+		{name: "page clamped to the rank stop", r: SortedSetByRank(0, 9).Limit(5, 10), want: []int{5, 6, 7, 8, 9}},
+		{name: "page inside the rank range", r: SortedSetByRank(2, 9).Limit(1, 2), want: []int{3, 4}},
+		{name: "page past the rank stop", r: SortedSetByRank(0, 9).Limit(10, 5), want: []int{}},
+		{name: "rank page up to the last member", r: SortedSetByRank(0, -1).Limit(17, 5), want: []int{17, 18, 19}},
+		{name: "rank offset without count", r: SortedSetByRank(0, 9).Limit(7, 0), want: []int{7, 8, 9}},
+		{name: "reversed rank page", r: SortedSetByRank(0, 4).Rev().Limit(3, 5), want: []int{16, 15}},
+		{name: "score offset without count", r: SortedSetByScore("10", "13").Limit(2, 0), want: []int{12, 13}},
+		{name: "score page", r: SortedSetByScore("-inf", "+inf").Limit(4, 2), want: []int{4, 5}},
+		{name: "negative rank start", r: SortedSetByRank(-5, -1).Limit(1, 1), wantErr: true},
+		{name: "negative rank stop other than -1", r: SortedSetByRank(0, -2).Limit(1, 1), wantErr: true},
+		{name: "negative offset", r: SortedSetByScore("-inf", "+inf").Limit(-1, 1), wantErr: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			page, err := GetSortedSetRange[int](ctx, client, key, tt.r)
+			if tt.wantErr {
+				if err == nil {
+					t.Errorf("GetSortedSetRange() = %+v, want an error", page)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("GetSortedSetRange() error = %v", err)
+			}
+			got := make([]int, len(page))
+			for i, m := range page {
+				got[i] = m.Member
+			}
+			if !slices.Equal(got, tt.want) {
+				t.Errorf("GetSortedSetRange() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestSortedSetAddCommand(t *testing.T) {
+	client := setupTestClient(t)
+	defer Close(client)
+
+	tests := []struct {
+		name string
+		opts SortedSetAddOptions
+		want []string
+	}{
+		{name: "no flags", want: []string{"ZADD", "k", "1", "m"}},
+		{name: "NX CH", opts: SortedSetAddOptions{OnlyNew: true, Changed: true}, want: []string{"ZADD", "k", "NX", "CH", "1", "m"}},
+		{name: "XX GT CH", opts: SortedSetAddOptions{OnlyExisting: true, OnlyGreater: true, Changed: true}, want: []string{"ZADD", "k", "XX", "GT", "CH", "1", "m"}},
+		{name: "LT", opts: SortedSetAddOptions{OnlyLess: true}, want: []string{"ZADD", "k", "LT", "1", "m"}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			cmd := tt.opts.build(client, "k", []float64{1}, []string{"m"})
+			if got := cmd.Commands(); !slices.Equal(got, tt.want) {
+				t.Errorf("ZADD = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestSetsWithCodec(t *testing.T) {
+	client := setupTestClient(t)
+	ctx := context.Background()
+	DeleteDataFromCache(ctx, client, "set-json")
+	DeleteDataFromCache(ctx, client, "zset-json")
+	t.Cleanup(func() {
+		DeleteDataFromCache(ctx, client, "set-json")
+		DeleteDataFromCache(ctx, client, "zset-json")
+		Close(client)
+	})
+
+	type user struct {
+		ID int `json:"id"`
+	}
+	set := NewSet[user](client, "set-json")
+	set.Codec = JSONCodec{}
+	if _, err := set.Add(ctx, user{ID: 1}); err != nil {
+		t.Fatalf("Set.Add() error = %v", err)
+	}
+	raw, err := client.Do(ctx, client.B().Smembers().Key("set-json").Build()).AsStrSlice()
+	if err != nil || len(raw) != 1 || raw[0] != `{"id":1}` {
+		t.Errorf("Expected the JSON member, got %v, %v", raw, err)
+	}
+	if found, err := set.IsMember(ctx, user{ID: 1}); err != nil || !found {
+		t.Errorf("Set.IsMember() = %v, %v, want true, nil", found, err)
+	}
+
+	sorted := NewSortedSet[user](client, "zset-json")
+	sorted.Codec = JSONCodec{}
+	if _, err := sorted.Add(ctx, SortedSetAddOptions{}, ScoredMember[user]{Member: user{ID: 2}, Score: 1}); err != nil {
+		t.Fatalf("SortedSet.Add() error = %v", err)
+	}
+	page, err := sorted.Range(ctx, SortedSetByRank(0, -1))
+	if err != nil || len(page) != 1 || page[0].Member.ID != 2 {
+		t.Errorf("SortedSet.Range() = %+v, %v, want user 2", page, err)
+	}
+	if score, found, err := sorted.Score(ctx, user{ID: 2}); err != nil || !found || score != 1 {
+		t.Errorf("SortedSet.Score() = %v, %v, %v, want 1", score, found, err)
+	}
+}
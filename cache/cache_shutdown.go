@@ -0,0 +1,226 @@
+package redis_cache
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log"
+	"sort"
+	"strings"
+	"sync"
+
+	"github.com/redis/rueidis"
+)
+
+// This file contains the graceful shutdown of a client :
+// 1. Shutdown refuses new commands with ErrShutdown, and stops the subscriptions, the
+//    stream worker reads, the fallback probe and the background connection of lazy_connect
+// 2. It waits for the work in flight, up to the context deadline: commands, stale
+//    refreshes, stream handlers and held locks, whose lease is extended until they are unlocked
+// 3. Then it closes the connections, and returns a ShutdownError counting the work abandoned
+//
+// The commands of work accepted before the shutdown are still sent, so a stream
+// handler can finish and acknowledge its entry and a lock holder can unlock.
+// Dedicated connections, used by transactions, are refused once shutting down.
+
+// ErrShutdown is returned by the commands sent once Shutdown was called.
+var ErrShutdown = errors.New("redis client is shutting down")
+
+// The kinds of work Shutdown waits for, as reported by ShutdownError.
+const (
+	workCommands       = "commands"
+	workStaleRefreshes = "stale refreshes"
+	workStreamHandlers = "stream handlers"
+	workSubscriptions  = "subscriptions"
+	workHeldLocks      = "held locks"
+	workFallbackProbe  = "fallback probe"
+	workLazyConnect    = "lazy connect"
+)
+
+// ShutdownError is returned by Shutdown when its context was done before the
+// work in flight finished. The connections are closed nonetheless.
+type ShutdownError struct {
+	// Abandoned counts the work still running, by kind, such as "commands" or "held locks".
+	Abandoned map[string]int
+	// Err is the error of the context.
+	Err error
+}
+
+func (e *ShutdownError) Error() string {
+	kinds := make([]string, 0, len(e.Abandoned))
+	for kind := range e.Abandoned {
+		kinds = append(kinds, kind)
+	}
+	sort.Strings(kinds)
+	parts := make([]string, len(kinds))
+	for i, kind := range kinds {
+		parts[i] = fmt.Sprintf("%s: %d", kind, e.Abandoned[kind])
+	}
+	return fmt.Sprintf("shutdown abandoned in-flight work (%s): %v", strings.Join(parts, ", "), e.Err)
+}
+
+func (e *ShutdownError) Unwrap() error {
+	return e.Err
+}
+
+// Shutdown stops accepting new commands, waits for the work in flight and the
+// goroutines the package runs for client until ctx is done, then closes the
+// connections. It returns a *ShutdownError listing the work that did not finish in time.
+func Shutdown(ctx context.Context, client rueidis.Client) error {
+	opts := optionsOf(client)
+	// Spawned first, so the wait below covers them
+	opts.life.spawn(workFallbackProbe, opts.fallback.close)
+	if lazy := lazyOf(client); lazy != nil {
+		opts.life.spawn(workLazyConnect, lazy.stopConnecting)
+	}
+	opts.life.shutdown()
+	abandoned := opts.life.wait(ctx)
+
+	client.Close()
+	if len(abandoned) > 0 {
+		err := &ShutdownError{Abandoned: abandoned, Err: ctx.Err()}
+		log.Printf("redis_cache: Redis connection closed, %v", err)
+		return err
+	}
+	log.Printf("redis_cache: Redis connection closed gracefully")
+	return nil
+}
+
+type inFlightKey struct{}
+
+// inFlight marks ctx as carrying work accepted before the shutdown, its commands are still sent.
+func inFlight(ctx context.Context) context.Context {
+	return context.WithValue(ctx, inFlightKey{}, true)
+}
+
+// lifecycle counts the work running with a client, for Shutdown. A nil
+// lifecycle, of a client not created by this package, counts nothing.
+type lifecycle struct {
+	// stopping is cancelled when the shutdown starts
+	stopping context.Context
+	stop     context.CancelFunc
+
+	mu       sync.Mutex
+	closing  bool
+	running  map[string]int
+	total    int
+	idle     chan struct{}
+	idleOnce sync.Once
+}
+
+func newLifecycle() *lifecycle {
+	stopping, stop := context.WithCancel(context.Background())
+	return &lifecycle{
+		stopping: stopping,
+		stop:     stop,
+		running:  map[string]int{},
+		idle:     make(chan struct{}),
+	}
+}
+
+// begin counts a new piece of work of kind, to be ended with end. It returns
+// ErrShutdown once shutting down, unless ctx carries work in flight.
+func (l *lifecycle) begin(ctx context.Context, kind string) error {
+	if l == nil {
+		return nil
+	}
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	if l.closing && ctx.Value(inFlightKey{}) == nil {
+		return ErrShutdown
+	}
+	l.running[kind]++
+	l.total++
+	return nil
+}
+
+// end ends a piece of work counted by begin.
+func (l *lifecycle) end(kind string) {
+	if l == nil {
+		return
+	}
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	l.running[kind]--
+	if l.running[kind] == 0 {
+		delete(l.running, kind)
+	}
+	l.total--
+	if l.closing && l.total == 0 {
+		l.idleOnce.Do(func() { close(l.idle) })
+	}
+}
+
+// spawn runs fn in a goroutine counted as kind, even once shutting down: the
+// work it finishes was already accepted.
+func (l *lifecycle) spawn(kind string, fn func()) {
+	if l == nil {
+		go fn()
+		return
+	}
+	l.mu.Lock()
+	l.running[kind]++
+	l.total++
+	l.mu.Unlock()
+
+	go func() {
+		defer l.end(kind)
+		fn()
+	}()
+}
+
+// bind returns a copy of ctx cancelled when the shutdown starts, for the work
+// that runs until stopped, such as subscriptions.
+func (l *lifecycle) bind(ctx context.Context) (context.Context, context.CancelFunc) {
+	ctx, cancel := context.WithCancel(ctx)
+	if l == nil {
+		return ctx, cancel
+	}
+	stop := context.AfterFunc(l.stopping, cancel)
+	return ctx, func() {
+		stop()
+		cancel()
+	}
+}
+
+// stopped reports whether the shutdown started.
+func (l *lifecycle) stopped() bool {
+	return l != nil && l.stopping.Err() != nil
+}
+
+// shutdown refuses new work and stops the work bound to the lifecycle.
+func (l *lifecycle) shutdown() {
+	if l == nil {
+		return
+	}
+	l.mu.Lock()
+	l.closing = true
+	if l.total == 0 {
+		l.idleOnce.Do(func() { close(l.idle) })
+	}
+	l.mu.Unlock()
+	l.stop()
+}
+
+// wait waits until no work runs or ctx is done, and returns the work still running.
+func (l *lifecycle) wait(ctx context.Context) map[string]int {
+	if l == nil {
+		return nil
+	}
+	select {
+	case <-l.idle:
+		return nil
+	case <-ctx.Done():
+	}
+
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	if l.total == 0 {
+		return nil
+	}
+	abandoned := make(map[string]int, len(l.running))
+	for kind, n := range l.running {
+		abandoned[kind] = n
+	}
+	return abandoned
+}
@@ -0,0 +1,201 @@
+package redis_cache
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/redis/rueidis"
+)
+
+// waitForWork waits until client runs n pieces of work of kind.
+func waitForWork(t *testing.T, client rueidis.Client, kind string, n int) {
+	life := optionsOf(client).life
+	deadline := time.Now().Add(5 * time.Second)
+	for {
+		life.mu.Lock()
+		running := life.running[kind]
+		life.mu.Unlock()
+		if running == n {
+			return
+		}
+		if time.Now().After(deadline) {
+			t.Fatalf("Expected %d %s to run, got %d", n, kind, running)
+		}
+		time.Sleep(5 * time.Millisecond)
+	}
+}
+
+func TestShutdownError(t *testing.T) {
+	err := error(&ShutdownError{Abandoned: map[string]int{workHeldLocks: 1, workCommands: 2}, Err: context.DeadlineExceeded})
+	if got, want := err.Error(), "shutdown abandoned in-flight work (commands: 2, held locks: 1): context deadline exceeded"; got != want {
+		t.Errorf("Error() = %q, want %q", got, want)
+	}
+	if !errors.Is(err, context.DeadlineExceeded) {
+		t.Errorf("Expected ShutdownError to wrap the context error")
+	}
+}
+
+func TestShutdown(t *testing.T) {
+	s := startFaultyServer(t)
+	client := connectToFaultyServer(t, s, "")
+
+	ctx := context.Background()
+	if err := Shutdown(ctx, client); err != nil {
+		t.Fatalf("Shutdown() of an idle client error = %v", err)
+	}
+
+	// New work is refused
+	if _, err := GetStringDataFromCache(ctx, client, "shutdown-key"); !errors.Is(err, ErrShutdown) {
+		t.Errorf("GetStringDataFromCache() after Shutdown() error = %v, want ErrShutdown", err)
+	}
+	if _, err := SubscribeFunc(ctx, client, SubscribeOptions{}, func(Message[string]) {}, "shutdown-channel"); !errors.Is(err, ErrShutdown) {
+		t.Errorf("SubscribeFunc() after Shutdown() error = %v, want ErrShutdown", err)
+	}
+	if err := client.DoCache(ctx, client.B().Get().Key("shutdown-key").Cache(), time.Minute).Error(); !errors.Is(err, ErrShutdown) {
+		t.Errorf("DoCache() after Shutdown() error = %v, want ErrShutdown", err)
+	}
+	if stream := client.DoMultiStream(ctx, client.B().Get().Key("shutdown-key").Build()); !errors.Is(stream.Error(), ErrShutdown) {
+		t.Errorf("DoMultiStream() after Shutdown() error = %v, want ErrShutdown", stream.Error())
+	}
+	if err := client.Receive(ctx, client.B().Subscribe().Channel("shutdown-channel").Build(), func(rueidis.PubSubMessage) {}); !errors.Is(err, ErrShutdown) {
+		t.Errorf("Receive() after Shutdown() error = %v, want ErrShutdown", err)
+	}
+	dedicated, cancel := client.Dedicate()
+	if err := dedicated.Do(ctx, dedicated.B().Get().Key("shutdown-key").Build()).Error(); !errors.Is(err, ErrShutdown) {
+		t.Errorf("Dedicate() Do() after Shutdown() error = %v, want ErrShutdown", err)
+	}
+	cancel()
+	if err := Shutdown(ctx, client); err != nil {
+		t.Errorf("Shutdown() called twice error = %v", err)
+	}
+}
+
+func TestShutdownWaitsForInFlightWork(t *testing.T) {
+	s := startFaultyServer(t)
+	client := connectToFaultyServer(t, s, "")
+
+	ctx := context.Background()
+	lock, err := TryAcquireLock(ctx, client, "shutdown-lock", LockOptions{TTL: time.Second})
+	if err != nil {
+		t.Fatalf("TryAcquireLock() error = %v", err)
+	}
+	popped := make(chan error, 1)
+	go func() {
+		cmd := client.B().Blpop().Key(namespacedKey(client, "shutdown-list")).Timeout(0.2).Build()
+		popped <- client.Do(ctx, cmd).Error()
+	}()
+	waitForWork(t, client, workCommands, 1)
+
+	shutdownCtx, cancel := context.WithTimeout(ctx, 5*time.Second)
+	defer cancel()
+	shutdown := make(chan error, 1)
+	go func() {
+		shutdown <- Shutdown(shutdownCtx, client)
+	}()
+	for !optionsOf(client).life.stopped() {
+		time.Sleep(time.Millisecond)
+	}
+
+	if err := SetStringDataToCacheWithExpiry(ctx, client, "shutdown-key", "value", NoExpiry()); !errors.Is(err, ErrShutdown) {
+		t.Errorf("SetStringDataToCacheWithExpiry() while shutting down error = %v, want ErrShutdown", err)
+	}
+	// The blocking command times out as usual
+	if err := <-popped; !rueidis.IsRedisNil(err) {
+		t.Errorf("BLPOP in flight error = %v, want a nil reply", err)
+	}
+	select {
+	case err := <-shutdown:
+		t.Fatalf("Expected Shutdown() to wait for the held lock, returned %v", err)
+	case <-time.After(50 * time.Millisecond):
+	}
+
+	// The holder can still unlock
+	if err := lock.Unlock(ctx); err != nil {
+		t.Errorf("Unlock() while shutting down error = %v", err)
+	}
+	if err := <-shutdown; err != nil {
+		t.Errorf("Shutdown() error = %v", err)
+	}
+}
+
+func TestShutdownAbandonsWork(t *testing.T) {
+	s := startFaultyServer(t)
+	client := connectToFaultyServer(t, s, "")
+
+	ctx := context.Background()
+	popped := make(chan error, 1)
+	go func() {
+		cmd := client.B().Blpop().Key(namespacedKey(client, "shutdown-list")).Timeout(0.5).Build()
+		popped <- client.Do(ctx, cmd).Error()
+	}()
+	waitForWork(t, client, workCommands, 1)
+
+	shutdownCtx, cancel := context.WithTimeout(ctx, 50*time.Millisecond)
+	defer cancel()
+	err := Shutdown(shutdownCtx, client)
+	var shutdownErr *ShutdownError
+	if !errors.As(err, &shutdownErr) || !errors.Is(err, context.DeadlineExceeded) {
+		t.Fatalf("Shutdown() error = %v, want a ShutdownError", err)
+	}
+	if len(shutdownErr.Abandoned) != 1 || shutdownErr.Abandoned[workCommands] != 1 {
+		t.Errorf("Abandoned = %v, want the BLPOP", shutdownErr.Abandoned)
+	}
+	// A closed client fails the new commands
+	if err := client.Do(ctx, client.B().Get().Key("shutdown-key").Build()).Error(); !errors.Is(err, ErrShutdown) {
+		t.Errorf("GET after Shutdown() error = %v, want ErrShutdown", err)
+	}
+	<-popped
+}
+
+func TestShutdownStopsBackgroundWork(t *testing.T) {
+	s := startFaultyServer(t)
+	client := connectToFaultyServer(t, s, "")
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	sub, err := SubscribeFunc(ctx, client, SubscribeOptions{}, func(Message[string]) {}, "shutdown-channel")
+	if err != nil {
+		t.Fatalf("SubscribeFunc() error = %v", err)
+	}
+
+	started := make(chan struct{})
+	release := make(chan struct{})
+	worker, err := NewStreamWorker(client, "shutdown-stream", func(ctx context.Context, entry StreamEntry) error {
+		close(started)
+		<-release
+		// The handler in flight can still use the client
+		return SetStringDataToCacheWithExpiry(ctx, client, "shutdown-handled", entry.ID, NoExpiry())
+	}, StreamWorkerOptions{Group: "workers", StartID: "0", Block: 50 * time.Millisecond})
+	if err != nil {
+		t.Fatalf("NewStreamWorker() error = %v", err)
+	}
+	if _, err := AddToStream(ctx, client, "shutdown-stream", map[string]string{"n": "1"}, StreamAddOptions{}); err != nil {
+		t.Fatalf("AddToStream() error = %v", err)
+	}
+	ran := make(chan error, 1)
+	go func() {
+		ran <- worker.Run(ctx)
+	}()
+	<-started
+
+	shutdown := make(chan error, 1)
+	go func() {
+		shutdown <- Shutdown(ctx, client)
+	}()
+	if err := sub.Err(); !errors.Is(err, ErrShutdown) {
+		t.Errorf("Subscription Err() = %v, want ErrShutdown", err)
+	}
+	close(release)
+
+	if err := <-ran; !errors.Is(err, ErrShutdown) {
+		t.Errorf("Run() error = %v, want ErrShutdown", err)
+	}
+	if err := <-shutdown; err != nil {
+		t.Errorf("Shutdown() error = %v", err)
+	}
+	if !s.Exists(namespacedKey(client, "shutdown-handled")) {
+		t.Errorf("Expected the handler in flight to finish")
+	}
+}
@@ -0,0 +1,381 @@
+package redis_cache
+
+import (
+	"context"
+	"fmt"
+	"strconv"
+
+	"github.com/redis/rueidis"
+)
+
+// This file contains the following methods for sorted sets :
+// 1. Method to add members with the NX / XX / GT / LT / CH flags of ZADD
+// 2. Method to increment a member's score (ZINCRBY)
+// 3. Method to read a range by rank, score or lex with pagination (ZRANGE)
+// 4. Methods to get a member's rank and score, and to remove members
+// 5. SortedSet, the same methods on a sorted set of T whose members are encoded with a Codec
+//
+// Members are encoded like set members: strings and byte slices as-is,
+// everything else with DefaultCodec, or the Codec of a SortedSet.
+
+// ScoredMember is a sorted set member together with its score.
+type ScoredMember[T any] struct {
+	Member T
+	Score  float64
+}
+
+// SortedSetAddOptions maps onto the flags of ZADD.
+type SortedSetAddOptions struct {
+	OnlyNew      bool // NX: only add new members, never update scores
+	OnlyExisting bool // XX: only update existing members, never add
+	OnlyGreater  bool // GT: only update when the new score is greater
+	OnlyLess     bool // LT: only update when the new score is less
+	// Changed makes the returned count include updated members, not only added ones (CH)
+	Changed bool
+}
+
+func (o SortedSetAddOptions) validate() error {
+	if o.OnlyNew && o.OnlyExisting {
+		return fmt.Errorf("OnlyNew and OnlyExisting can not be combined")
+	}
+	if o.OnlyGreater && o.OnlyLess {
+		return fmt.Errorf("OnlyGreater and OnlyLess can not be combined")
+	}
+	if o.OnlyNew && (o.OnlyGreater || o.OnlyLess) {
+		return fmt.Errorf("OnlyNew can not be combined with OnlyGreater or OnlyLess")
+	}
+	return nil
+}
+
+// build returns the ZADD command adding members with their scores. Each flag
+// of ZADD is a different builder type, the steps left are carried as method values.
+func (o SortedSetAddOptions) build(client rueidis.Client, key string, scores []float64, members []string) rueidis.Completed {
+	zadd := client.B().Zadd().Key(key)
+	gt, lt, ch, scoreMember := zadd.Gt, zadd.Lt, zadd.Ch, zadd.ScoreMember
+	switch {
+	case o.OnlyNew:
+		nx := zadd.Nx()
+		gt, lt, ch, scoreMember = nx.Gt, nx.Lt, nx.Ch, nx.ScoreMember
+	case o.OnlyExisting:
+		xx := zadd.Xx()
+		gt, lt, ch, scoreMember = xx.Gt, xx.Lt, xx.Ch, xx.ScoreMember
+	}
+	switch {
+	case o.OnlyGreater:
+		greater := gt()
+		ch, scoreMember = greater.Ch, greater.ScoreMember
+	case o.OnlyLess:
+		less := lt()
+		ch, scoreMember = less.Ch, less.ScoreMember
+	}
+	if o.Changed {
+		scoreMember = ch().ScoreMember
+	}
+
+	cmd := scoreMember()
+	for i, member := range members {
+		cmd = cmd.ScoreMember(scores[i], member)
+	}
+	return cmd.Build()
+}
+
+// SortedSetRange describes a ZRANGE query. Build it with SortedSetByRank,
+// SortedSetByScore or SortedSetByLex, then refine it with Rev and Limit.
+type SortedSetRange struct {
+	by      string // "", BYSCORE or BYLEX
+	start   string
+	stop    string
+	reverse bool
+	offset  int64
+	count   int64
+}
+
+// SortedSetByRank selects members between the start and stop ranks, both inclusive.
+// Negative ranks count from the highest score, so 0, -1 selects every member.
+func SortedSetByRank(start, stop int64) SortedSetRange {
+	return SortedSetRange{start: strconv.FormatInt(start, 10), stop: strconv.FormatInt(stop, 10)}
+}
+
+// SortedSetByScore selects members with min <= score <= max. Bounds use the
+// ZRANGE syntax, e.g. "-inf", "+inf" or "(10" for an exclusive bound.
+func SortedSetByScore(min, max string) SortedSetRange {
+	return SortedSetRange{by: "BYSCORE", start: min, stop: max}
+}
+
+// SortedSetByLex selects members between the lexicographic bounds, e.g. "[a", "(c", "-" or "+".
+// Only meaningful for string members that share the same score.
+func SortedSetByLex(min, max string) SortedSetRange {
+	return SortedSetRange{by: "BYLEX", start: min, stop: max}
+}
+
+// Rev returns the range ordered from the highest score to the lowest. For
+// score and lex ranges the bounds are still given as min, max.
+func (r SortedSetRange) Rev() SortedSetRange {
+	r.reverse = true
+	return r
+}
+
+// Limit paginates the range, skipping offset members and returning at most
+// count. A count of 0 or less returns every member past offset. A page never
+// goes past the bounds of the range.
+func (r SortedSetRange) Limit(offset, count int64) SortedSetRange {
+	if count <= 0 {
+		count = -1
+	}
+	r.offset = offset
+	r.count = count
+	return r
+}
+
+// paginated reports whether Limit skips or bounds members.
+func (r SortedSetRange) paginated() bool {
+	return r.offset != 0 || r.count > 0
+}
+
+// rankWindow turns the pagination of a rank range into its ranks, clamped to
+// the original stop, since ZRANGE only takes LIMIT with BYSCORE and BYLEX.
+func (r SortedSetRange) rankWindow() (SortedSetRange, error) {
+	start, err := strconv.ParseInt(r.start, 10, 64)
+	if err != nil {
+		return r, fmt.Errorf("invalid rank range start %q", r.start)
+	}
+	stop, err := strconv.ParseInt(r.stop, 10, 64)
+	if err != nil {
+		return r, fmt.Errorf("invalid rank range stop %q", r.stop)
+	}
+	if start < 0 || stop < -1 {
+		return r, fmt.Errorf("rank ranges can only be paginated from a non negative start up to a non negative stop or -1")
+	}
+
+	first, last := start+r.offset, stop
+	if r.count > 0 {
+		if end := first + r.count - 1; stop == -1 || end < stop {
+			last = end
+		}
+	}
+	r.start = strconv.FormatInt(first, 10)
+	r.stop = strconv.FormatInt(last, 10)
+	return r, nil
+}
+
+// build returns the ZRANGE command of r, with method values like SortedSetAddOptions.build.
+func (r SortedSetRange) build(client rueidis.Client, key string) rueidis.Completed {
+	start, stop := r.start, r.stop
+	if r.reverse && r.by != "" {
+		// ZRANGE ... REV expects the bounds as max, min
+		start, stop = stop, start
+	}
+
+	bounds := client.B().Zrange().Key(key).Min(start).Max(stop)
+	rev, limit, withscores, build := bounds.Rev, bounds.Limit, bounds.Withscores, bounds.Build
+	switch r.by {
+	case "BYSCORE":
+		byScore := bounds.Byscore()
+		rev, limit, withscores, build = byScore.Rev, byScore.Limit, byScore.Withscores, byScore.Build
+	case "BYLEX":
+		byLex := bounds.Bylex()
+		rev, limit, withscores, build = byLex.Rev, byLex.Limit, byLex.Withscores, byLex.Build
+	}
+	if r.reverse {
+		reversed := rev()
+		limit, withscores, build = reversed.Limit, reversed.Withscores, reversed.Build
+	}
+	if r.by != "" && r.paginated() {
+		limited := limit(r.offset, r.count)
+		withscores, build = limited.Withscores, limited.Build
+	}
+	if r.by != "BYLEX" {
+		build = withscores().Build
+	}
+	return build()
+}
+
+// AddToSortedSet adds or updates members and returns how many were added,
+// or added and updated when opts.Changed is set.
+func AddToSortedSet[T any](ctx context.Context, client rueidis.Client, key string, opts SortedSetAddOptions, members ...ScoredMember[T]) (int64, error) {
+	return NewSortedSet[T](client, key).Add(ctx, opts, members...)
+}
+
+// IncrementSortedSetScore adds delta to the member's score and returns the new score.
+// A missing member is added with delta as its score.
+func IncrementSortedSetScore[T any](ctx context.Context, client rueidis.Client, key string, member T, delta float64) (float64, error) {
+	return NewSortedSet[T](client, key).IncrementScore(ctx, member, delta)
+}
+
+// GetSortedSetRange returns the members selected by r. Lex ranges can not
+// return scores, so their members have a zero Score.
+func GetSortedSetRange[T any](ctx context.Context, client rueidis.Client, key string, r SortedSetRange) ([]ScoredMember[T], error) {
+	return NewSortedSet[T](client, key).Range(ctx, r)
+}
+
+// GetSortedSetRank returns the member's 0-based rank, ordered by ascending
+// score or descending when reverse is set. It returns false for a missing member.
+func GetSortedSetRank[T any](ctx context.Context, client rueidis.Client, key string, member T, reverse bool) (int64, bool, error) {
+	return NewSortedSet[T](client, key).Rank(ctx, member, reverse)
+}
+
+// GetSortedSetScore returns the member's score. It returns false for a missing member.
+func GetSortedSetScore[T any](ctx context.Context, client rueidis.Client, key string, member T) (float64, bool, error) {
+	return NewSortedSet[T](client, key).Score(ctx, member)
+}
+
+// RemoveFromSortedSet removes members and returns how many were present.
+func RemoveFromSortedSet[T any](ctx context.Context, client rueidis.Client, key string, members ...T) (int64, error) {
+	return NewSortedSet[T](client, key).Remove(ctx, members...)
+}
+
+// SortedSet is a sorted set of T stored under a key. Members are encoded with Codec.
+type SortedSet[T any] struct {
+	client rueidis.Client
+	key    string
+
+	// Codec encodes the members, DefaultCodec when nil.
+	Codec Codec
+}
+
+// NewSortedSet returns a sorted set of T stored under key.
+func NewSortedSet[T any](client rueidis.Client, key string) *SortedSet[T] {
+	return &SortedSet[T]{client: client, key: key}
+}
+
+// Add adds or updates members and returns how many were added, or added and
+// updated when opts.Changed is set.
+func (z *SortedSet[T]) Add(ctx context.Context, opts SortedSetAddOptions, members ...ScoredMember[T]) (int64, error) {
+	if len(members) == 0 {
+		return 0, nil
+	}
+	if err := opts.validate(); err != nil {
+		return 0, err
+	}
+
+	scores := make([]float64, len(members))
+	encoded := make([]string, len(members))
+	for i, m := range members {
+		var err error
+		if encoded[i], err = encodeMember(z.Codec, m.Member); err != nil {
+			return 0, fmt.Errorf("failed to encode sorted set member: %v", err)
+		}
+		scores[i] = m.Score
+	}
+
+	count, err := z.client.Do(ctx, opts.build(z.client, namespacedKey(z.client, z.key), scores, encoded)).AsInt64()
+	if err != nil {
+		return 0, fmt.Errorf("failed to add members to sorted set: %w", err)
+	}
+	return count, nil
+}
+
+// IncrementScore adds delta to the member's score and returns the new score.
+// A missing member is added with delta as its score.
+func (z *SortedSet[T]) IncrementScore(ctx context.Context, member T, delta float64) (float64, error) {
+	encoded, err := encodeMember(z.Codec, member)
+	if err != nil {
+		return 0, fmt.Errorf("failed to encode sorted set member: %v", err)
+	}
+	score, err := z.client.Do(ctx, z.client.B().Zincrby().Key(namespacedKey(z.client, z.key)).Increment(delta).Member(encoded).Build()).AsFloat64()
+	if err != nil {
+		return 0, fmt.Errorf("failed to increment sorted set score: %w", err)
+	}
+	return score, nil
+}
+
+// Range returns the members selected by r. Lex ranges can not return scores,
+// so their members have a zero Score.
+func (z *SortedSet[T]) Range(ctx context.Context, r SortedSetRange) ([]ScoredMember[T], error) {
+	if r.offset < 0 {
+		return nil, fmt.Errorf("range offset must not be negative")
+	}
+	if r.by == "" && r.paginated() {
+		var err error
+		if r, err = r.rankWindow(); err != nil {
+			return nil, err
+		}
+	}
+	resp := z.client.Do(ctx, r.build(z.client, namespacedKey(z.client, z.key)))
+
+	var members []ScoredMember[T]
+	if r.by == "BYLEX" {
+		values, err := resp.AsStrSlice()
+		if err != nil {
+			return nil, fmt.Errorf("failed to get sorted set range: %w", err)
+		}
+		members = make([]ScoredMember[T], len(values))
+		for i, value := range values {
+			if members[i].Member, err = decodeMember[T](z.Codec, value); err != nil {
+				return nil, fmt.Errorf("failed to decode sorted set member: %v", err)
+			}
+		}
+		return members, nil
+	}
+
+	scores, err := resp.AsZScores()
+	if err != nil {
+		return nil, fmt.Errorf("failed to get sorted set range: %w", err)
+	}
+	members = make([]ScoredMember[T], len(scores))
+	for i, score := range scores {
+		if members[i].Member, err = decodeMember[T](z.Codec, score.Member); err != nil {
+			return nil, fmt.Errorf("failed to decode sorted set member: %v", err)
+		}
+		members[i].Score = score.Score
+	}
+	return members, nil
+}
+
+// Rank returns the member's 0-based rank, ordered by ascending score or
+// descending when reverse is set. It returns false for a missing member.
+func (z *SortedSet[T]) Rank(ctx context.Context, member T, reverse bool) (int64, bool, error) {
+	encoded, err := encodeMember(z.Codec, member)
+	if err != nil {
+		return 0, false, fmt.Errorf("failed to encode sorted set member: %v", err)
+	}
+
+	key := namespacedKey(z.client, z.key)
+	var cmd rueidis.Completed
+	if reverse {
+		cmd = z.client.B().Zrevrank().Key(key).Member(encoded).Build()
+	} else {
+		cmd = z.client.B().Zrank().Key(key).Member(encoded).Build()
+	}
+
+	rank, err := z.client.Do(ctx, cmd).AsInt64()
+	if err != nil {
+		if rueidis.IsRedisNil(err) {
+			return 0, false, nil
+		}
+		return 0, false, fmt.Errorf("failed to get sorted set rank: %w", err)
+	}
+	return rank, true, nil
+}
+
+// Score returns the member's score. It returns false for a missing member.
+func (z *SortedSet[T]) Score(ctx context.Context, member T) (float64, bool, error) {
+	encoded, err := encodeMember(z.Codec, member)
+	if err != nil {
+		return 0, false, fmt.Errorf("failed to encode sorted set member: %v", err)
+	}
+	score, err := z.client.Do(ctx, z.client.B().Zscore().Key(namespacedKey(z.client, z.key)).Member(encoded).Build()).AsFloat64()
+	if err != nil {
+		if rueidis.IsRedisNil(err) {
+			return 0, false, nil
+		}
+		return 0, false, fmt.Errorf("failed to get sorted set score: %w", err)
+	}
+	return score, true, nil
+}
+
+// Remove removes members and returns how many were present.
+func (z *SortedSet[T]) Remove(ctx context.Context, members ...T) (int64, error) {
+	if len(members) == 0 {
+		return 0, nil
+	}
+	encoded, err := encodeMembers(z.Codec, members)
+	if err != nil {
+		return 0, fmt.Errorf("failed to encode sorted set members: %v", err)
+	}
+	removed, err := z.client.Do(ctx, z.client.B().Zrem().Key(namespacedKey(z.client, z.key)).Member(encoded...).Build()).AsInt64()
+	if err != nil {
+		return 0, fmt.Errorf("failed to remove members from sorted set: %w", err)
+	}
+	return removed, nil
+}
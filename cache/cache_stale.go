@@ -0,0 +1,224 @@
+package redis_cache
+
+import (
+	"context"
+	"fmt"
+	"sync"
+	"time"
+
+	"github.com/redis/rueidis"
+)
+
+// This file contains the stale-while-revalidate read path built on CacheDataUnit :
+// 1. Methods to write and read a CacheDataUnit carrying its soft and hard expiry
+// 2. Stale-while-revalidate, values past the soft TTL are served while a single background refresh runs
+// 3. Stale-if-error, the last good value is served when the loader fails past the hard TTL
+//
+// The Redis key outlives the hard TTL by StaleIfErrorTTL, so the last good
+// value is still there when the loader is down.
+
+// Loader loads the value of a key from the source of truth on a cache miss.
+type Loader[T any] func(ctx context.Context) (T, error)
+
+// StaleOptions configures SetCacheDataUnit and GetWithStaleRevalidate.
+type StaleOptions struct {
+	// SoftTTL is how long a value is fresh. Past it the value is still served
+	// and refreshed in the background. Required.
+	SoftTTL time.Duration
+	// HardTTL is how long a value may be served at all, past it readers wait for
+	// the loader. Defaults to SoftTTL, which disables stale-while-revalidate.
+	HardTTL time.Duration
+	// StaleIfError serves the last good value, flagged as stale, when the loader
+	// fails past the hard TTL instead of returning the error.
+	StaleIfError bool
+	// StaleIfErrorTTL is how long past the hard TTL the last good value is kept
+	// for StaleIfError. Defaults to HardTTL.
+	StaleIfErrorTTL time.Duration
+	// RefreshTimeout bounds a background refresh, and the guard key that keeps
+	// it single across instances. Defaults to 10s.
+	RefreshTimeout time.Duration
+	// OnRefreshError is called with the errors of background refreshes.
+	OnRefreshError func(key string, err error)
+}
+
+func (o *StaleOptions) setDefaults() {
+	if o.HardTTL < o.SoftTTL {
+		o.HardTTL = o.SoftTTL
+	}
+	if o.StaleIfErrorTTL <= 0 {
+		o.StaleIfErrorTTL = o.HardTTL
+	}
+	if o.RefreshTimeout <= 0 {
+		o.RefreshTimeout = 10 * time.Second
+	}
+}
+
+// retention is how long the Redis key is kept.
+func (o StaleOptions) retention() time.Duration {
+	if o.StaleIfError {
+		return o.HardTTL + o.StaleIfErrorTTL
+	}
+	return o.HardTTL
+}
+
+// StaleResult is a value read by GetWithStaleRevalidate.
+type StaleResult[T CustomDataType] struct {
+	Value T
+	// Stale is true when Value is past its soft TTL, or past its hard TTL and
+	// served because the loader failed.
+	Stale bool
+	// LastUpdate is when Value was loaded.
+	LastUpdate time.Time
+	// LoadErr is the loader error when a stale value was served because of it.
+	LoadErr error
+}
+
+// SetCacheDataUnit writes data under key with the soft and hard expiry of opts.
+func SetCacheDataUnit[T CustomDataType](ctx context.Context, client rueidis.Client, key string, data T, opts StaleOptions) error {
+	opts.setDefaults()
+	if opts.SoftTTL <= 0 {
+		return fmt.Errorf("soft ttl must be greater than 0")
+	}
+
+	// The soft TTL is jittered like any other TTL, so keys written together
+	// are not all refreshed at once
+	now := time.Now()
+	unit := CacheDataUnit[T]{
+		Key:                 key,
+		Data:                data,
+		LastUpdateTimestamp: now,
+		SoftExpiresAt:       now.Add(min(optionsOf(client).jitter.Apply(opts.SoftTTL), opts.HardTTL)),
+		HardExpiresAt:       now.Add(opts.HardTTL),
+	}
+	payload, err := unit.Serialize(unit)
+	if err != nil {
+		return fmt.Errorf("failed to serialize data: %v", err)
+	}
+
+	cmd, err := buildSetCommand(client, namespacedKey(client, key), string(payload), ExpireIn(opts.retention()).WithoutJitter())
+	if err != nil {
+		return err
+	}
+	if err := client.Do(ctx, cmd).Error(); err != nil {
+		return fmt.Errorf("failed to set data to cache: %w", err)
+	}
+	return nil
+}
+
+// GetCacheDataUnit returns the unit stored under key, or nil when the key does not exist.
+func GetCacheDataUnit[T CustomDataType](ctx context.Context, client rueidis.Client, key string) (*CacheDataUnit[T], error) {
+	payload, err := client.Do(ctx, client.B().Get().Key(namespacedKey(client, key)).Build()).AsBytes()
+	if err != nil {
+		if rueidis.IsRedisNil(err) {
+			return nil, nil
+		}
+		return nil, fmt.Errorf("failed to get data from cache: %w", err)
+	}
+
+	var unit CacheDataUnit[T]
+	if err := Desiarlize(payload, &unit); err != nil {
+		return nil, fmt.Errorf("failed to deserialize data: %v", err)
+	}
+	return &unit, nil
+}
+
+// GetWithStaleRevalidate returns the value of key, calling loader and caching
+// its result on a miss.
+//   - Before the soft TTL the cached value is returned.
+//   - Between the soft and the hard TTL it is returned flagged as stale, and a
+//     single background refresh runs across every instance.
+//   - Past the hard TTL loader is called. If it fails and StaleIfError is set,
+//     the last good value is returned flagged as stale along with the error.
+func GetWithStaleRevalidate[T CustomDataType](ctx context.Context, client rueidis.Client, key string, loader Loader[T], opts StaleOptions) (StaleResult[T], error) {
+	opts.setDefaults()
+	unit, err := GetCacheDataUnit[T](ctx, client, key)
+	if err != nil {
+		return StaleResult[T]{}, err
+	}
+
+	now := time.Now()
+	if unit != nil && now.Before(unit.HardExpiresAt) {
+		result := StaleResult[T]{Value: unit.Data, LastUpdate: unit.LastUpdateTimestamp}
+		if !now.Before(unit.SoftExpiresAt) {
+			result.Stale = true
+			// No refresh is started once the client is shutting down (see cache_shutdown.go)
+			life := optionsOf(client).life
+			if life.begin(ctx, workStaleRefreshes) == nil {
+				go func() {
+					defer life.end(workStaleRefreshes)
+					refreshInBackground(client, key, loader, opts)
+				}()
+			}
+		}
+		return result, nil
+	}
+
+	value, err := loader(ctx)
+	if err != nil {
+		if unit != nil && opts.StaleIfError {
+			return StaleResult[T]{Value: unit.Data, Stale: true, LastUpdate: unit.LastUpdateTimestamp, LoadErr: err}, nil
+		}
+		return StaleResult[T]{}, fmt.Errorf("failed to load %s: %v", key, err)
+	}
+	// The loaded value is returned even if caching it failed
+	return StaleResult[T]{Value: value, LastUpdate: now}, SetCacheDataUnit(ctx, client, key, value, opts)
+}
+
+// staleRefreshes holds the keys this process is refreshing, so concurrent
+// readers of a stale key do not all race for the Redis guard.
+var staleRefreshes sync.Map
+
+type staleRefresh struct {
+	client rueidis.Client
+	key    string
+}
+
+// refreshInBackground reloads key unless another reader, in this or another
+// instance, is already refreshing it. Its commands are still sent while the
+// client is shutting down, Shutdown waits for it.
+//
+// Across instances the refresh is guarded by a plain SET NX PX key, which
+// expires with RefreshTimeout and leaves nothing behind once released.
+func refreshInBackground[T CustomDataType](client rueidis.Client, key string, loader Loader[T], opts StaleOptions) {
+	flight := staleRefresh{client: client, key: key}
+	if _, running := staleRefreshes.LoadOrStore(flight, struct{}{}); running {
+		return
+	}
+	defer staleRefreshes.Delete(flight)
+
+	ctx, cancel := context.WithTimeout(inFlight(context.Background()), opts.RefreshTimeout)
+	defer cancel()
+
+	token, err := newRandomToken()
+	if err != nil {
+		if opts.OnRefreshError != nil {
+			opts.OnRefreshError(key, err)
+		}
+		return
+	}
+	guard := namespacedKey(client, key+KeySeparator+"refresh")
+	err = client.Do(ctx, client.B().Set().Key(guard).Value(token).Nx().PxMilliseconds(opts.RefreshTimeout.Milliseconds()).Build()).Error()
+	if err != nil {
+		if !rueidis.IsRedisNil(err) && opts.OnRefreshError != nil {
+			opts.OnRefreshError(key, fmt.Errorf("failed to acquire refresh guard: %w", err))
+		}
+		return
+	}
+	// Only our own guard is released, it may have expired and been taken over
+	defer releaseScript.Exec(ctx, client, []string{guard}, []string{token})
+
+	// The value read as stale may have been refreshed since, by a refresh
+	// that released the guard before this one took it
+	unit, err := GetCacheDataUnit[T](ctx, client, key)
+	if err == nil && unit != nil && time.Now().Before(unit.SoftExpiresAt) {
+		return
+	}
+
+	value, err := loader(ctx)
+	if err == nil {
+		err = SetCacheDataUnit(ctx, client, key, value, opts)
+	}
+	if err != nil && opts.OnRefreshError != nil {
+		opts.OnRefreshError(key, err)
+	}
+}
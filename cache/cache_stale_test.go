@@ -0,0 +1,215 @@
+package redis_cache
+
+import (
+	"context"
+	"errors"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+func TestGetWithStaleRevalidateCachesLoads(t *testing.T) {
+	client := setupTestClient(t)
+	defer Close(client)
+
+	ctx := context.Background()
+	DeleteDataFromCache(ctx, client, "stale-fresh")
+
+	var loads atomic.Int32
+	loader := func(ctx context.Context) (string, error) {
+		loads.Add(1)
+		return "loaded", nil
+	}
+	opts := StaleOptions{SoftTTL: time.Minute, HardTTL: 2 * time.Minute}
+
+	for i := 0; i < 3; i++ {
+		result, err := GetWithStaleRevalidate(ctx, client, "stale-fresh", loader, opts)
+		if err != nil {
+			t.Fatalf("GetWithStaleRevalidate() error = %v", err)
+		}
+		if result.Value != "loaded" || result.Stale {
+			t.Errorf("GetWithStaleRevalidate() = %+v, want a fresh %q", result, "loaded")
+		}
+	}
+	if got := loads.Load(); got != 1 {
+		t.Errorf("loader called %d times, want 1", got)
+	}
+
+	unit, err := GetCacheDataUnit[string](ctx, client, "stale-fresh")
+	if err != nil || unit == nil {
+		t.Fatalf("GetCacheDataUnit() = %v, %v", unit, err)
+	}
+	if unit.LastUpdateTimestamp.IsZero() || !unit.SoftExpiresAt.Before(unit.HardExpiresAt) {
+		t.Errorf("GetCacheDataUnit() = %+v, want the update time and soft expiry before hard expiry", unit)
+	}
+}
+
+func TestGetWithStaleRevalidateRefreshesOnce(t *testing.T) {
+	client := setupTestClient(t)
+	defer Close(client)
+
+	ctx := context.Background()
+	opts := StaleOptions{SoftTTL: 100 * time.Millisecond, HardTTL: time.Minute}
+	if err := SetCacheDataUnit(ctx, client, "stale-swr", 1, opts); err != nil {
+		t.Fatalf("SetCacheDataUnit() error = %v", err)
+	}
+	time.Sleep(150 * time.Millisecond)
+
+	var loads atomic.Int32
+	release := make(chan struct{})
+	loader := func(ctx context.Context) (int, error) {
+		loads.Add(1)
+		<-release
+		return 2, nil
+	}
+
+	var wg sync.WaitGroup
+	for i := 0; i < 10; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			result, err := GetWithStaleRevalidate(ctx, client, "stale-swr", loader, opts)
+			if err != nil || result.Value != 1 || !result.Stale {
+				t.Errorf("GetWithStaleRevalidate() = %+v, %v, want the stale value 1", result, err)
+			}
+		}()
+	}
+	// Every reader got the stale value while the refresh is still blocked
+	wg.Wait()
+	time.Sleep(50 * time.Millisecond)
+	close(release)
+
+	deadline := time.Now().Add(2 * time.Second)
+	for {
+		result, err := GetWithStaleRevalidate(ctx, client, "stale-swr", loader, opts)
+		if err == nil && result.Value == 2 && !result.Stale {
+			break
+		}
+		if time.Now().After(deadline) {
+			t.Fatalf("Expected the refreshed value, got %+v, %v", result, err)
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+	if got := loads.Load(); got != 1 {
+		t.Errorf("loader called %d times, want a single background refresh", got)
+	}
+}
+
+func TestGetWithStaleRevalidateRefreshLeavesNoKeys(t *testing.T) {
+	s := startFaultyServer(t)
+	client := connectToFaultyServer(t, s, "")
+	defer Close(client)
+
+	ctx := context.Background()
+	opts := StaleOptions{SoftTTL: 50 * time.Millisecond, HardTTL: time.Minute}
+	if err := SetCacheDataUnit(ctx, client, "stale-keys", 1, opts); err != nil {
+		t.Fatalf("SetCacheDataUnit() error = %v", err)
+	}
+	time.Sleep(100 * time.Millisecond)
+
+	release := make(chan struct{})
+	loader := func(ctx context.Context) (int, error) {
+		<-release
+		return 2, nil
+	}
+	if _, err := GetWithStaleRevalidate(ctx, client, "stale-keys", loader, opts); err != nil {
+		t.Fatalf("GetWithStaleRevalidate() error = %v", err)
+	}
+	// The guard is held while the refresh runs
+	deadline := time.Now().Add(2 * time.Second)
+	for !s.Exists("stale-keys:refresh") {
+		if time.Now().After(deadline) {
+			t.Fatalf("Expected the refresh guard to be set, keys = %v", s.Keys())
+		}
+		time.Sleep(5 * time.Millisecond)
+	}
+	close(release)
+
+	for {
+		keys := s.Keys()
+		if len(keys) == 1 && keys[0] == "stale-keys" {
+			break
+		}
+		if time.Now().After(deadline) {
+			t.Fatalf("keys after the refresh = %v, want only %q", keys, "stale-keys")
+		}
+		time.Sleep(5 * time.Millisecond)
+	}
+	unit, err := GetCacheDataUnit[int](ctx, client, "stale-keys")
+	if err != nil || unit == nil || unit.Data != 2 {
+		t.Errorf("GetCacheDataUnit() = %+v, %v, want the refreshed value 2", unit, err)
+	}
+}
+
+func TestGetWithStaleRevalidatePastHardTTL(t *testing.T) {
+	client := setupTestClient(t)
+	defer Close(client)
+
+	ctx := context.Background()
+	errDown := errors.New("database down")
+	failing := func(ctx context.Context) (string, error) { return "", errDown }
+
+	tests := []struct {
+		name         string
+		staleIfError bool
+		wantErr      bool
+	}{
+		{name: "stale-if-error serves the last good value", staleIfError: true},
+		{name: "loader error is returned otherwise", wantErr: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			opts := StaleOptions{SoftTTL: 50 * time.Millisecond, HardTTL: 100 * time.Millisecond, StaleIfError: tt.staleIfError}
+			if err := SetCacheDataUnit(ctx, client, "stale-hard", "good", opts); err != nil {
+				t.Fatalf("SetCacheDataUnit() error = %v", err)
+			}
+			time.Sleep(150 * time.Millisecond)
+
+			result, err := GetWithStaleRevalidate(ctx, client, "stale-hard", failing, opts)
+			if tt.wantErr {
+				if err == nil {
+					t.Errorf("GetWithStaleRevalidate() = %+v, want an error", result)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("GetWithStaleRevalidate() error = %v", err)
+			}
+			if result.Value != "good" || !result.Stale || !errors.Is(result.LoadErr, errDown) {
+				t.Errorf("GetWithStaleRevalidate() = %+v, want the stale %q with the loader error", result, "good")
+			}
+		})
+	}
+}
+
+func TestSetCacheDataUnitRetention(t *testing.T) {
+	client := setupTestClient(t)
+	defer Close(client)
+
+	ctx := context.Background()
+	tests := []struct {
+		name string
+		opts StaleOptions
+		want time.Duration
+	}{
+		{name: "kept until the hard ttl", opts: StaleOptions{SoftTTL: time.Minute, HardTTL: time.Hour}, want: time.Hour},
+		{name: "kept past the hard ttl for stale-if-error", opts: StaleOptions{SoftTTL: time.Minute, HardTTL: time.Hour, StaleIfError: true, StaleIfErrorTTL: 30 * time.Minute}, want: 90 * time.Minute},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if err := SetCacheDataUnit(ctx, client, "stale-retention", []byte("value"), tt.opts); err != nil {
+				t.Fatalf("SetCacheDataUnit() error = %v", err)
+			}
+			ms, err := client.Do(ctx, client.B().Pttl().Key("stale-retention").Build()).AsInt64()
+			if err != nil {
+				t.Fatalf("PTTL error = %v", err)
+			}
+			if got := time.Duration(ms) * time.Millisecond; got <= tt.want-time.Second || got > tt.want {
+				t.Errorf("key TTL = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,515 @@
+package redis_cache
+
+import (
+	"context"
+	"fmt"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/redis/rueidis"
+)
+
+// This file contains the following methods for streams :
+// 1. Method to append an entry, optionally trimming by MAXLEN or MINID (XADD)
+// 2. Method to read a range of entries (XRANGE)
+// 3. StreamWorker, a consumer group worker :
+//    - creates the group if missing and reads new entries with XREADGROUP BLOCK
+//    - dispatches entries to a handler with bounded concurrency and XACKs them on success
+//    - claims entries left pending by crashed or slow consumers with XAUTOCLAIM,
+//      skipping the entries its own handlers are still processing
+//    - moves entries delivered MaxDeliveries times to a dead-letter stream, atomically
+//
+// Ref : https://redis.io/docs/latest/develop/data-types/streams/
+
+// streamRetryDelay is how long the worker waits after a failed read or claim.
+const streamRetryDelay = 500 * time.Millisecond
+
+// deadLetterScript adds an entry to the dead-letter stream and acknowledges it
+// in the stream, atomically. KEYS[1] is the stream, KEYS[2] the dead-letter
+// stream, ARGV[1] the group, ARGV[2] the entry ID and ARGV[3..] its fields and
+// values, none for an entry deleted while pending.
+var deadLetterScript = rueidis.NewLuaScript(`
+if #ARGV > 2 then
+	redis.call('XADD', KEYS[2], '*', unpack(ARGV, 3))
+end
+return redis.call('XACK', KEYS[1], ARGV[1], ARGV[2])
+`)
+
+// StreamEntry is one entry of a stream.
+type StreamEntry struct {
+	ID     string
+	Values map[string]string
+}
+
+// StreamAddOptions configures AddToStream.
+type StreamAddOptions struct {
+	// ID of the new entry, "*" (generated by the server) when empty.
+	ID string
+	// MaxLen trims the stream to at most MaxLen entries.
+	MaxLen int64
+	// MinID trims the entries with an ID lower than MinID. It cannot be combined with MaxLen.
+	MinID string
+	// Approximate lets the server trim lazily (~), which is much cheaper.
+	Approximate bool
+}
+
+// validate checks that the options can be combined.
+func (o StreamAddOptions) validate() error {
+	if o.MaxLen < 0 {
+		return fmt.Errorf("maxlen must not be negative")
+	}
+	if o.MaxLen > 0 && o.MinID != "" {
+		return fmt.Errorf("maxlen and minid cannot be combined")
+	}
+	return nil
+}
+
+// AddToStream appends an entry with the given fields to the stream and returns its ID.
+func AddToStream(ctx context.Context, client rueidis.Client, key string, values map[string]string, opts StreamAddOptions) (string, error) {
+	if len(values) == 0 {
+		return "", fmt.Errorf("a stream entry requires at least one field")
+	}
+	if err := opts.validate(); err != nil {
+		return "", fmt.Errorf("invalid stream add options: %v", err)
+	}
+
+	xadd := client.B().Xadd().Key(namespacedKey(client, key))
+	// The builder steps ending the trimming options share the type of the ID step
+	withID := xadd.Id
+	switch {
+	case opts.MaxLen > 0 && opts.Approximate:
+		withID = xadd.Maxlen().Almost().Threshold(strconv.FormatInt(opts.MaxLen, 10)).Id
+	case opts.MaxLen > 0:
+		withID = xadd.Maxlen().Threshold(strconv.FormatInt(opts.MaxLen, 10)).Id
+	case opts.MinID != "" && opts.Approximate:
+		withID = xadd.Minid().Almost().Threshold(opts.MinID).Id
+	case opts.MinID != "":
+		withID = xadd.Minid().Threshold(opts.MinID).Id
+	}
+	id := opts.ID
+	if id == "" {
+		id = "*"
+	}
+	cmd := withID(id).FieldValue()
+	for field, value := range values {
+		cmd = cmd.FieldValue(field, value)
+	}
+
+	id, err := client.Do(ctx, cmd.Build()).ToString()
+	if err != nil {
+		return "", fmt.Errorf("failed to add entry to stream: %w", err)
+	}
+	return id, nil
+}
+
+// GetStreamRange returns the entries with IDs between start and end, inclusive.
+// Use "-" and "+" for the first and last entry. count <= 0 returns every entry.
+func GetStreamRange(ctx context.Context, client rueidis.Client, key string, start string, end string, count int64) ([]StreamEntry, error) {
+	cmd := client.B().Xrange().Key(namespacedKey(client, key)).Start(start).End(end)
+	var entries []rueidis.XRangeEntry
+	var err error
+	if count > 0 {
+		entries, err = client.Do(ctx, cmd.Count(count).Build()).AsXRange()
+	} else {
+		entries, err = client.Do(ctx, cmd.Build()).AsXRange()
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to get stream range: %w", err)
+	}
+	return toStreamEntries(entries), nil
+}
+
+func toStreamEntries(entries []rueidis.XRangeEntry) []StreamEntry {
+	result := make([]StreamEntry, len(entries))
+	for i, entry := range entries {
+		result[i] = StreamEntry{ID: entry.ID, Values: entry.FieldValues}
+	}
+	return result
+}
+
+// StreamHandler processes one entry. The entry is acknowledged when it
+// returns nil, and delivered again later otherwise.
+type StreamHandler func(ctx context.Context, entry StreamEntry) error
+
+// StreamWorkerOptions configures a StreamWorker.
+type StreamWorkerOptions struct {
+	// Group is the consumer group, required.
+	Group string
+	// Consumer names this worker within the group, a random name when empty.
+	Consumer string
+	// StartID is where a newly created group starts reading, "$" (new entries only) when empty.
+	StartID string
+	// Concurrency is the maximum number of entries handled at once, 1 by default.
+	Concurrency int
+	// Block is how long a read waits for new entries, 5s by default.
+	Block time.Duration
+	// MinIdle is how long an entry must stay pending before another consumer claims it, 30s by default.
+	MinIdle time.Duration
+	// ClaimInterval is how often pending entries are checked, 10s by default.
+	ClaimInterval time.Duration
+	// MaxDeliveries is how many times an entry is delivered before it is moved
+	// to the dead-letter stream, 5 by default.
+	MaxDeliveries int64
+	// DeadLetterStream receives the entries that failed MaxDeliveries times,
+	// "<stream>:dead-letter" when empty. Dead-lettered entries keep their fields
+	// and gain "origin_id" and "deliveries". In a cluster the move is only atomic
+	// when both streams hash to the same slot, e.g. "{orders}" and "{orders}:dead-letter".
+	DeadLetterStream string
+	// OnError is called with handler, read and claim errors.
+	OnError func(err error)
+}
+
+func (o *StreamWorkerOptions) setDefaults(stream string) error {
+	if o.Group == "" {
+		return fmt.Errorf("a consumer group is required")
+	}
+	if o.Consumer == "" {
+		token, err := newRandomToken()
+		if err != nil {
+			return err
+		}
+		o.Consumer = token
+	}
+	if o.StartID == "" {
+		o.StartID = "$"
+	}
+	if o.Concurrency <= 0 {
+		o.Concurrency = 1
+	}
+	if o.Block <= 0 {
+		o.Block = 5 * time.Second
+	}
+	if o.MinIdle <= 0 {
+		o.MinIdle = 30 * time.Second
+	}
+	if o.ClaimInterval <= 0 {
+		o.ClaimInterval = 10 * time.Second
+	}
+	if o.MaxDeliveries <= 0 {
+		o.MaxDeliveries = 5
+	}
+	if o.DeadLetterStream == "" {
+		o.DeadLetterStream = stream + ":dead-letter"
+	}
+	return nil
+}
+
+// StreamWorker consumes a stream as a member of a consumer group.
+type StreamWorker struct {
+	client  rueidis.Client
+	stream  string
+	handler StreamHandler
+	opts    StreamWorkerOptions
+
+	slots chan struct{}
+	wg    sync.WaitGroup
+
+	mu sync.Mutex
+	// handling holds the IDs of the entries the handlers are processing
+	handling map[string]struct{}
+}
+
+// NewStreamWorker returns a worker that passes the entries of stream to handler.
+func NewStreamWorker(client rueidis.Client, stream string, handler StreamHandler, opts StreamWorkerOptions) (*StreamWorker, error) {
+	if err := opts.setDefaults(stream); err != nil {
+		return nil, fmt.Errorf("invalid stream worker options: %v", err)
+	}
+	return &StreamWorker{
+		client:   client,
+		stream:   stream,
+		handler:  handler,
+		opts:     opts,
+		slots:    make(chan struct{}, opts.Concurrency),
+		handling: map[string]struct{}{},
+	}, nil
+}
+
+// Run creates the consumer group if missing and processes entries until ctx
+// is done, then waits for the handlers in flight to return. It returns
+// ErrShutdown when the client was shut down first, the handlers in flight
+// then finish with ctx.
+func (w *StreamWorker) Run(ctx context.Context) error {
+	if err := w.createGroup(ctx); err != nil {
+		return err
+	}
+
+	// Shutdown stops reading and claiming (see cache_shutdown.go)
+	readCtx, stop := optionsOf(w.client).life.bind(ctx)
+	defer stop()
+
+	claimDone := make(chan struct{})
+	go func() {
+		defer close(claimDone)
+		ticker := time.NewTicker(w.opts.ClaimInterval)
+		defer ticker.Stop()
+		for {
+			select {
+			case <-readCtx.Done():
+				return
+			case <-ticker.C:
+				if err := w.claim(readCtx, ctx); err != nil && readCtx.Err() == nil {
+					w.reportError(err)
+				}
+			}
+		}
+	}()
+
+	for readCtx.Err() == nil {
+		entries, err := w.read(readCtx)
+		if err != nil {
+			if readCtx.Err() != nil {
+				break
+			}
+			w.reportError(err)
+			select {
+			case <-readCtx.Done():
+			case <-time.After(streamRetryDelay):
+			}
+			continue
+		}
+		for _, entry := range entries {
+			w.dispatch(ctx, entry)
+		}
+	}
+
+	<-claimDone
+	w.wg.Wait()
+	if ctx.Err() == nil {
+		return ErrShutdown
+	}
+	return nil
+}
+
+// createGroup creates the consumer group and the stream, unless the group exists.
+func (w *StreamWorker) createGroup(ctx context.Context) error {
+	cmd := w.client.B().XgroupCreate().Key(namespacedKey(w.client, w.stream)).Group(w.opts.Group).Id(w.opts.StartID).Mkstream().Build()
+	err := w.client.Do(ctx, cmd).Error()
+	if err != nil && !strings.HasPrefix(err.Error(), "BUSYGROUP") {
+		return fmt.Errorf("failed to create consumer group: %w", err)
+	}
+	return nil
+}
+
+// read waits for a free handler slot, then for up to as many new entries as there are free slots.
+func (w *StreamWorker) read(ctx context.Context) ([]StreamEntry, error) {
+	select {
+	case <-ctx.Done():
+		return nil, ctx.Err()
+	case w.slots <- struct{}{}:
+		<-w.slots
+	}
+	count := int64(cap(w.slots) - len(w.slots))
+
+	cmd := w.client.B().Xreadgroup().Group(w.opts.Group, w.opts.Consumer).Count(count).
+		Block(w.opts.Block.Milliseconds()).Streams().Key(namespacedKey(w.client, w.stream)).Id(">").Build()
+	streams, err := w.client.Do(ctx, cmd).AsXRead()
+	if rueidis.IsRedisNil(err) {
+		return nil, nil
+	}
+	if err != nil {
+		// The group is gone if the stream was deleted, recreate it for the next read
+		if strings.HasPrefix(err.Error(), "NOGROUP") {
+			w.createGroup(ctx)
+		}
+		return nil, fmt.Errorf("failed to read stream: %w", err)
+	}
+	return toStreamEntries(streams[namespacedKey(w.client, w.stream)]), nil
+}
+
+// dispatch runs the handler on entry once a slot is free, and acknowledges it on success.
+// Shutdown waits for the handler, whose commands are still sent.
+func (w *StreamWorker) dispatch(ctx context.Context, entry StreamEntry) {
+	w.slots <- struct{}{}
+	w.wg.Add(1)
+	w.mu.Lock()
+	w.handling[entry.ID] = struct{}{}
+	w.mu.Unlock()
+	ctx = inFlight(ctx)
+	optionsOf(w.client).life.spawn(workStreamHandlers, func() {
+		defer func() {
+			w.mu.Lock()
+			delete(w.handling, entry.ID)
+			w.mu.Unlock()
+			<-w.slots
+			w.wg.Done()
+		}()
+
+		// An entry deleted from the stream while pending has no fields left to handle
+		if entry.Values != nil {
+			if err := w.handler(ctx, entry); err != nil {
+				w.reportError(fmt.Errorf("failed to handle stream entry %s: %w", entry.ID, err))
+				return
+			}
+		}
+		if err := w.ack(context.WithoutCancel(ctx), entry.ID); err != nil {
+			w.reportError(err)
+		}
+	})
+}
+
+func (w *StreamWorker) ack(ctx context.Context, id string) error {
+	cmd := w.client.B().Xack().Key(namespacedKey(w.client, w.stream)).Group(w.opts.Group).Id(id).Build()
+	if err := w.client.Do(ctx, cmd).Error(); err != nil {
+		return fmt.Errorf("failed to acknowledge stream entry %s: %w", id, err)
+	}
+	return nil
+}
+
+// Claim claims the entries pending for at least MinIdle with XAUTOCLAIM and
+// dispatches them again, except those already delivered MaxDeliveries times,
+// which are moved to the dead-letter stream. Run calls it every ClaimInterval.
+// The entries the worker's handlers are still processing are not dispatched
+// again, though claiming them counts as a delivery.
+func (w *StreamWorker) Claim(ctx context.Context) error {
+	return w.claim(ctx, ctx)
+}
+
+// claim is Claim, running the handlers of the claimed entries with handlerCtx.
+func (w *StreamWorker) claim(ctx context.Context, handlerCtx context.Context) error {
+	key := namespacedKey(w.client, w.stream)
+	cursor := "0-0"
+	for {
+		cmd := w.client.B().Xautoclaim().Key(key).Group(w.opts.Group).Consumer(w.opts.Consumer).
+			MinIdleTime(strconv.FormatInt(w.opts.MinIdle.Milliseconds(), 10)).Start(cursor).Count(int64(w.opts.Concurrency)).Build()
+		reply, err := w.client.Do(ctx, cmd).ToArray()
+		if err != nil {
+			return fmt.Errorf("failed to claim pending stream entries: %w", err)
+		}
+		if len(reply) < 2 {
+			return fmt.Errorf("failed to claim pending stream entries: unexpected reply")
+		}
+		if cursor, err = reply[0].ToString(); err != nil {
+			return fmt.Errorf("failed to claim pending stream entries: %w", err)
+		}
+		claimed, err := reply[1].AsXRange()
+		if err != nil {
+			return fmt.Errorf("failed to claim pending stream entries: %w", err)
+		}
+		entries := toStreamEntries(claimed)
+
+		deliveries, err := w.deliveries(ctx, entries)
+		if err != nil {
+			return err
+		}
+		for _, entry := range entries {
+			if ctx.Err() != nil {
+				return nil
+			}
+			if w.isHandling(entry.ID) {
+				continue
+			}
+			// The claim itself counts as a delivery
+			if delivered := deliveries[entry.ID] - 1; delivered >= w.opts.MaxDeliveries {
+				if err := w.deadLetter(ctx, entry, delivered); err != nil {
+					return err
+				}
+				continue
+			}
+			w.dispatch(handlerCtx, entry)
+		}
+		if cursor == "0-0" {
+			return nil
+		}
+	}
+}
+
+// isHandling reports whether a handler of the worker is processing the entry with id.
+func (w *StreamWorker) isHandling(id string) bool {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	_, ok := w.handling[id]
+	return ok
+}
+
+// deliveries returns how many times each of the entries, all owned by this
+// consumer after a claim, has been delivered.
+func (w *StreamWorker) deliveries(ctx context.Context, entries []StreamEntry) (map[string]int64, error) {
+	counts := make(map[string]int64, len(entries))
+	if len(entries) == 0 {
+		return counts, nil
+	}
+
+	cmd := w.client.B().Xpending().Key(namespacedKey(w.client, w.stream)).Group(w.opts.Group).
+		Start(entries[0].ID).End(entries[len(entries)-1].ID).Count(int64(len(entries))).Consumer(w.opts.Consumer).Build()
+	pending, err := w.client.Do(ctx, cmd).ToArray()
+	if err != nil {
+		return nil, fmt.Errorf("failed to list pending stream entries: %w", err)
+	}
+	for _, p := range pending {
+		fields, err := p.ToArray()
+		if err != nil || len(fields) < 4 {
+			continue
+		}
+		id, _ := fields[0].ToString()
+		counts[id], _ = fields[3].AsInt64()
+	}
+	return counts, nil
+}
+
+// deadLetter moves entry to the dead-letter stream and acknowledges it, with
+// deadLetterScript. In a cluster, when the streams hash to different slots, the
+// entry is added then acknowledged in two steps, so a failure in between
+// dead-letters it twice.
+func (w *StreamWorker) deadLetter(ctx context.Context, entry StreamEntry, delivered int64) error {
+	var values map[string]string
+	if entry.Values != nil {
+		values = make(map[string]string, len(entry.Values)+2)
+		for field, value := range entry.Values {
+			values[field] = value
+		}
+		values["origin_id"] = entry.ID
+		values["deliveries"] = strconv.FormatInt(delivered, 10)
+	}
+
+	stream := namespacedKey(w.client, w.stream)
+	deadLetter := namespacedKey(w.client, w.opts.DeadLetterStream)
+	if w.client.Mode() == rueidis.ClientModeCluster && keySlot(stream) != keySlot(deadLetter) {
+		if values != nil {
+			if _, err := AddToStream(ctx, w.client, w.opts.DeadLetterStream, values, StreamAddOptions{}); err != nil {
+				return fmt.Errorf("failed to dead-letter stream entry %s: %w", entry.ID, err)
+			}
+		}
+		return w.ack(ctx, entry.ID)
+	}
+
+	args := []string{w.opts.Group, entry.ID}
+	for field, value := range values {
+		args = append(args, field, value)
+	}
+	if err := deadLetterScript.Exec(ctx, w.client, []string{stream, deadLetter}, args).Error(); err != nil {
+		return fmt.Errorf("failed to dead-letter stream entry %s: %w", entry.ID, err)
+	}
+	return nil
+}
+
+// keySlot returns the cluster hash slot of key, the CRC16 of its hash tag or
+// of the whole key modulo 16384.
+//
+// Ref : https://redis.io/docs/latest/operate/oss_and_stack/reference/cluster-spec/#hash-tags
+func keySlot(key string) uint16 {
+	if start := strings.IndexByte(key, '{'); start >= 0 {
+		if end := strings.IndexByte(key[start+1:], '}'); end > 0 {
+			key = key[start+1 : start+1+end]
+		}
+	}
+	var crc uint16
+	for i := 0; i < len(key); i++ {
+		crc ^= uint16(key[i]) << 8
+		for bit := 0; bit < 8; bit++ {
+			if crc&0x8000 != 0 {
+				crc = crc<<1 ^ 0x1021
+			} else {
+				crc <<= 1
+			}
+		}
+	}
+	return crc % 16384
+}
+
+func (w *StreamWorker) reportError(err error) {
+	if w.opts.OnError != nil {
+		w.opts.OnError(err)
+	}
+}
@@ -0,0 +1,273 @@
+package redis_cache
+
+import (
+	"context"
+	"fmt"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+func TestAddToStream(t *testing.T) {
+	client := setupTestClient(t)
+	defer Close(client)
+
+	ctx := context.Background()
+	DeleteDataFromCache(ctx, client, "stream-trim-maxlen")
+	DeleteDataFromCache(ctx, client, "stream-trim-minid")
+
+	for i := 1; i <= 5; i++ {
+		if _, err := AddToStream(ctx, client, "stream-trim-maxlen", map[string]string{"n": fmt.Sprint(i)}, StreamAddOptions{MaxLen: 3}); err != nil {
+			t.Fatalf("AddToStream() error = %v", err)
+		}
+	}
+	entries, err := GetStreamRange(ctx, client, "stream-trim-maxlen", "-", "+", 0)
+	if err != nil {
+		t.Fatalf("GetStreamRange() error = %v", err)
+	}
+	if len(entries) != 3 || entries[0].Values["n"] != "3" {
+		t.Errorf("GetStreamRange() after MAXLEN 3 = %v, want entries 3 to 5", entries)
+	}
+
+	for i := 1; i <= 3; i++ {
+		id := fmt.Sprintf("%d-0", i)
+		got, err := AddToStream(ctx, client, "stream-trim-minid", map[string]string{"n": fmt.Sprint(i)}, StreamAddOptions{ID: id, MinID: "2-0"})
+		if err != nil {
+			t.Fatalf("AddToStream() error = %v", err)
+		}
+		if got != id {
+			t.Errorf("AddToStream() id = %q, want %q", got, id)
+		}
+	}
+	entries, err = GetStreamRange(ctx, client, "stream-trim-minid", "-", "+", 0)
+	if err != nil {
+		t.Fatalf("GetStreamRange() error = %v", err)
+	}
+	if len(entries) != 2 || entries[0].ID != "2-0" {
+		t.Errorf("GetStreamRange() after MINID 2-0 = %v, want entries 2-0 and 3-0", entries)
+	}
+
+	tests := []struct {
+		name        string
+		values      map[string]string
+		opts        StreamAddOptions
+		errContains string
+	}{
+		{name: "no fields", errContains: "a stream entry requires at least one field"},
+		{name: "maxlen and minid", values: map[string]string{"a": "1"}, opts: StreamAddOptions{MaxLen: 1, MinID: "1-0"}, errContains: "invalid stream add options"},
+		{name: "negative maxlen", values: map[string]string{"a": "1"}, opts: StreamAddOptions{MaxLen: -1}, errContains: "invalid stream add options"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, err := AddToStream(ctx, client, "stream-invalid", tt.values, tt.opts)
+			if err == nil || !contains(err.Error(), tt.errContains) {
+				t.Errorf("AddToStream() error = %v, want %q", err, tt.errContains)
+			}
+		})
+	}
+}
+
+func TestStreamWorker(t *testing.T) {
+	client := setupTestClient(t)
+	defer Close(client)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	DeleteDataFromCache(ctx, client, "stream-worker")
+
+	var mu sync.Mutex
+	var running, maxRunning int
+	handled := make(chan string, 10)
+	worker, err := NewStreamWorker(client, "stream-worker", func(ctx context.Context, entry StreamEntry) error {
+		mu.Lock()
+		running++
+		maxRunning = max(maxRunning, running)
+		mu.Unlock()
+
+		time.Sleep(20 * time.Millisecond)
+
+		mu.Lock()
+		running--
+		mu.Unlock()
+		handled <- entry.Values["n"]
+		return nil
+	}, StreamWorkerOptions{Group: "workers", StartID: "0", Concurrency: 2, Block: 100 * time.Millisecond})
+	if err != nil {
+		t.Fatalf("NewStreamWorker() error = %v", err)
+	}
+
+	for i := 0; i < 6; i++ {
+		if _, err := AddToStream(ctx, client, "stream-worker", map[string]string{"n": fmt.Sprint(i)}, StreamAddOptions{}); err != nil {
+			t.Fatalf("AddToStream() error = %v", err)
+		}
+	}
+
+	done := make(chan error)
+	go func() { done <- worker.Run(ctx) }()
+
+	for i := 0; i < 6; i++ {
+		select {
+		case <-handled:
+		case <-time.After(3 * time.Second):
+			t.Fatalf("Timed out after %d handled entries", i)
+		}
+	}
+	cancel()
+	if err := <-done; err != nil {
+		t.Errorf("Run() error = %v", err)
+	}
+
+	if maxRunning > 2 {
+		t.Errorf("Expected at most 2 concurrent handlers, got %d", maxRunning)
+	}
+	pending, err := client.Do(context.Background(), client.B().Xpending().Key("stream-worker").Group("workers").Build()).ToArray()
+	if err != nil {
+		t.Fatalf("XPENDING error = %v", err)
+	}
+	if count, _ := pending[0].AsInt64(); count != 0 {
+		t.Errorf("Expected every entry to be acknowledged, %d pending", count)
+	}
+}
+
+func TestStreamWorkerDeadLetter(t *testing.T) {
+	tests := []struct {
+		name   string
+		stream string
+	}{
+		// The test server is a cluster, the streams hash to different slots
+		{name: "added then acknowledged", stream: "stream-failing"},
+		{name: "moved atomically", stream: "{stream-failing-tagged}"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			client := setupTestClient(t)
+			defer Close(client)
+
+			ctx, cancel := context.WithCancel(context.Background())
+			defer cancel()
+			deadLetter := tt.stream + ":dead-letter"
+			DeleteDataFromCache(ctx, client, tt.stream)
+			DeleteDataFromCache(ctx, client, deadLetter)
+
+			var attempts atomic.Int64
+			worker, err := NewStreamWorker(client, tt.stream, func(ctx context.Context, entry StreamEntry) error {
+				attempts.Add(1)
+				return fmt.Errorf("handler failed")
+			}, StreamWorkerOptions{
+				Group:         "workers",
+				StartID:       "0",
+				Block:         50 * time.Millisecond,
+				MinIdle:       50 * time.Millisecond,
+				ClaimInterval: 50 * time.Millisecond,
+				MaxDeliveries: 3,
+			})
+			if err != nil {
+				t.Fatalf("NewStreamWorker() error = %v", err)
+			}
+
+			id, err := AddToStream(ctx, client, tt.stream, map[string]string{"order": "42"}, StreamAddOptions{})
+			if err != nil {
+				t.Fatalf("AddToStream() error = %v", err)
+			}
+			go worker.Run(ctx)
+
+			deadline := time.Now().Add(3 * time.Second)
+			var dead []StreamEntry
+			for time.Now().Before(deadline) && len(dead) == 0 {
+				time.Sleep(50 * time.Millisecond)
+				if dead, err = GetStreamRange(context.Background(), client, deadLetter, "-", "+", 0); err != nil {
+					t.Fatalf("GetStreamRange() error = %v", err)
+				}
+			}
+			if len(dead) != 1 {
+				t.Fatalf("Expected the entry to be dead-lettered, got %v", dead)
+			}
+			if dead[0].Values["order"] != "42" || dead[0].Values["origin_id"] != id || dead[0].Values["deliveries"] != "3" {
+				t.Errorf("dead-letter entry = %v, want order 42 from %s after 3 deliveries", dead[0].Values, id)
+			}
+			if got := attempts.Load(); got != 3 {
+				t.Errorf("Expected 3 handler attempts, got %d", got)
+			}
+			pending, err := client.Do(context.Background(), client.B().Xpending().Key(tt.stream).Group("workers").Build()).ToArray()
+			if err != nil {
+				t.Fatalf("XPENDING error = %v", err)
+			}
+			if count, _ := pending[0].AsInt64(); count != 0 {
+				t.Errorf("Expected the dead-lettered entry to be acknowledged, %d pending", count)
+			}
+		})
+	}
+}
+
+func TestStreamWorkerSkipsEntriesInFlight(t *testing.T) {
+	client := setupTestClient(t)
+	defer Close(client)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	DeleteDataFromCache(ctx, client, "stream-slow")
+
+	var attempts atomic.Int64
+	handled := make(chan struct{})
+	worker, err := NewStreamWorker(client, "stream-slow", func(ctx context.Context, entry StreamEntry) error {
+		attempts.Add(1)
+		// Pending for longer than MinIdle, across several claims
+		time.Sleep(300 * time.Millisecond)
+		close(handled)
+		return nil
+	}, StreamWorkerOptions{
+		Group:         "workers",
+		StartID:       "0",
+		Block:         50 * time.Millisecond,
+		MinIdle:       50 * time.Millisecond,
+		ClaimInterval: 20 * time.Millisecond,
+	})
+	if err != nil {
+		t.Fatalf("NewStreamWorker() error = %v", err)
+	}
+	if _, err := AddToStream(ctx, client, "stream-slow", map[string]string{"n": "1"}, StreamAddOptions{}); err != nil {
+		t.Fatalf("AddToStream() error = %v", err)
+	}
+	go worker.Run(ctx)
+
+	select {
+	case <-handled:
+	case <-time.After(3 * time.Second):
+		t.Fatal("Timed out waiting for the handler")
+	}
+	time.Sleep(100 * time.Millisecond)
+	if got := attempts.Load(); got != 1 {
+		t.Errorf("Expected the entry in flight not to be handled again, got %d attempts", got)
+	}
+}
+
+func TestKeySlot(t *testing.T) {
+	tests := []struct {
+		key  string
+		want uint16
+	}{
+		{key: "123456789", want: 12739},
+		{key: "foo", want: 12182},
+		{key: "{user1000}.following", want: keySlot("user1000")},
+		{key: "foo{{bar}}zap", want: keySlot("{bar")},
+	}
+	for _, tt := range tests {
+		if got := keySlot(tt.key); got != tt.want {
+			t.Errorf("keySlot(%q) = %d, want %d", tt.key, got, tt.want)
+		}
+	}
+	// An empty hash tag hashes the whole key
+	if keySlot("foo{}{bar}") == keySlot("bar") {
+		t.Error("Expected an empty hash tag to be ignored")
+	}
+	if keySlot("{orders}") != keySlot("{orders}:dead-letter") {
+		t.Error("Expected keys sharing a hash tag to share a slot")
+	}
+}
+
+func TestNewStreamWorkerRequiresGroup(t *testing.T) {
+	if _, err := NewStreamWorker(nil, "stream", nil, StreamWorkerOptions{}); err == nil || !contains(err.Error(), "invalid stream worker options") {
+		t.Errorf("NewStreamWorker() without a group error = %v", err)
+	}
+}
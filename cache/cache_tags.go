@@ -0,0 +1,198 @@
+package redis_cache
+
+import (
+	"context"
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/redis/rueidis"
+)
+
+// This file contains the following methods for tag based invalidation :
+// 1. Tag indexes, one set per tag holding the keys written with Expiry.WithTags
+// 2. Method to delete every key of some tags in batches and remove the indexes (InvalidateTags)
+// 3. Methods to list the keys of a tag and to drop the keys that expired on their own
+//
+// An index never expires before the keys it holds: every tagged write extends
+// the index TTL to the key's TTL when it is longer, and an index holding a key
+// without expiry has no expiry either.
+
+// tagInvalidationBatch is how many keys InvalidateTags deletes per round trip.
+const tagInvalidationBatch = 500
+
+// tagIndexScript adds a key to a tag index and extends the index TTL.
+// KEYS[1] is the index, ARGV[1] the tagged key, ARGV[2] the key's TTL in ms,
+// -1 for no expiry and -2 when unknown (KEEPTTL). Tagged writes send EVALSHA
+// and fall back to EVAL on NOSCRIPT, it is not preloaded with DefaultScripts
+// so clients that never tag keys do not need SCRIPT LOAD.
+var tagIndexScript = newScript("tag_index", `
+local current = redis.call('PTTL', KEYS[1])
+redis.call('SADD', KEYS[1], ARGV[1])
+local ttl = tonumber(ARGV[2])
+if ttl == -1 then
+	redis.call('PERSIST', KEYS[1])
+elseif ttl > 0 and (current == -2 or (current >= 0 and current < ttl)) then
+	redis.call('PEXPIRE', KEYS[1], ttl)
+end
+return 1
+`)
+
+// tagKey returns the key of the index of tag.
+func tagKey(client rueidis.Client, tag string) string {
+	return namespacedKey(client, BuildKey("tag", tag))
+}
+
+// addToTags adds key, already namespaced, to the index of every tag of a
+// resolved expiry. It runs before the write: the index and the key usually
+// live in different hash slots, so they can not share a MULTI/EXEC, and an
+// index entry for a key that was never written is harmless while a written
+// key missing from its index would survive InvalidateTags.
+func addToTags(ctx context.Context, client rueidis.Client, key string, expiry Expiry) error {
+	return updateTagIndexes(ctx, client, tagIndexRuns(client, key, expiry))
+}
+
+// updateTagIndexes runs the tag index updates of tagIndexRuns in one round trip.
+func updateTagIndexes(ctx context.Context, client rueidis.Client, runs []rueidis.LuaExec) error {
+	if len(runs) == 0 {
+		return nil
+	}
+	cmds := make(rueidis.Commands, len(runs))
+	indexed := make(map[int]rueidis.LuaExec, len(runs))
+	for i, run := range runs {
+		cmds[i] = tagIndexScript.build(client, run.Keys, run.Args...)
+		indexed[i] = run
+	}
+	resps := client.DoMulti(ctx, cmds...)
+	tagIndexScript.rerunNoScript(ctx, client, indexed, resps)
+	for _, resp := range resps {
+		if err := resp.Error(); err != nil {
+			return fmt.Errorf("failed to tag key: %w", err)
+		}
+	}
+	return nil
+}
+
+// tagIndexRuns returns the runs of tagIndexScript adding key to the index of every tag.
+func tagIndexRuns(client rueidis.Client, key string, expiry Expiry) []rueidis.LuaExec {
+	if len(expiry.tags) == 0 {
+		return nil
+	}
+
+	ttl := int64(-1)
+	switch {
+	case expiry.keepTTL:
+		ttl = -2
+	case !expiry.deadline.IsZero():
+		ttl = max(durationToMilliseconds(time.Until(expiry.deadline)), 1)
+	case expiry.ttl > 0:
+		ttl = durationToMilliseconds(expiry.ttl)
+	}
+
+	runs := make([]rueidis.LuaExec, len(expiry.tags))
+	for i, tag := range expiry.tags {
+		runs[i] = rueidis.LuaExec{Keys: []string{tagKey(client, tag)}, Args: []string{key, strconv.FormatInt(ttl, 10)}}
+	}
+	return runs
+}
+
+// InvalidateTags deletes every key written with one of the tags and removes
+// the tag indexes. Keys are deleted in batches, each batch is removed from the
+// index only once deleted, so a failure can be retried without losing keys.
+// It returns how many keys were deleted; keys that already expired are not counted.
+func InvalidateTags(ctx context.Context, client rueidis.Client, tags ...string) (int64, error) {
+	var deleted int64
+	for _, tag := range tags {
+		index := tagKey(client, tag)
+		for {
+			members, err := client.Do(ctx, client.B().Srandmember().Key(index).Count(tagInvalidationBatch).Build()).AsStrSlice()
+			if err != nil {
+				return deleted, fmt.Errorf("failed to invalidate tag %s: %w", tag, err)
+			}
+			if len(members) == 0 {
+				break
+			}
+
+			// One DEL per key, as the keys of a tag may live in different hash slots
+			cmds := make(rueidis.Commands, len(members))
+			for i, member := range members {
+				cmds[i] = client.B().Del().Key(member).Build()
+			}
+			for _, resp := range client.DoMulti(ctx, cmds...) {
+				n, err := resp.AsInt64()
+				if err != nil {
+					return deleted, fmt.Errorf("failed to invalidate tag %s: %w", tag, err)
+				}
+				deleted += n
+			}
+
+			// The index is deleted by Redis once its last member is removed
+			if err := client.Do(ctx, client.B().Srem().Key(index).Member(members...).Build()).Error(); err != nil {
+				return deleted, fmt.Errorf("failed to invalidate tag %s: %w", tag, err)
+			}
+		}
+	}
+	return deleted, nil
+}
+
+// GetTaggedKeys returns the keys indexed under tag, including keys that
+// expired since they were written.
+func GetTaggedKeys(ctx context.Context, client rueidis.Client, tag string) ([]string, error) {
+	members, err := client.Do(ctx, client.B().Smembers().Key(tagKey(client, tag)).Build()).AsStrSlice()
+	if err != nil {
+		return nil, fmt.Errorf("failed to get tagged keys: %w", err)
+	}
+	prefix := optionsOf(client).namespace.prefix()
+	for i, member := range members {
+		members[i] = strings.TrimPrefix(member, prefix)
+	}
+	return members, nil
+}
+
+// PruneTags removes the keys that expired on their own from the tag indexes
+// and returns how many were removed. Indexes of long lived tags whose keys
+// keep expiring should be pruned periodically.
+func PruneTags(ctx context.Context, client rueidis.Client, tags ...string) (int64, error) {
+	var removed int64
+	for _, tag := range tags {
+		index := tagKey(client, tag)
+		cursor := uint64(0)
+		for {
+			entry, err := client.Do(ctx, client.B().Sscan().Key(index).Cursor(cursor).Count(tagInvalidationBatch).Build()).AsScanEntry()
+			if err != nil {
+				return removed, fmt.Errorf("failed to prune tag %s: %w", tag, err)
+			}
+
+			if len(entry.Elements) > 0 {
+				cmds := make(rueidis.Commands, len(entry.Elements))
+				for i, member := range entry.Elements {
+					cmds[i] = client.B().Exists().Key(member).Build()
+				}
+				var expired []string
+				for i, resp := range client.DoMulti(ctx, cmds...) {
+					n, err := resp.AsInt64()
+					if err != nil {
+						return removed, fmt.Errorf("failed to prune tag %s: %w", tag, err)
+					}
+					if n == 0 {
+						expired = append(expired, entry.Elements[i])
+					}
+				}
+				if len(expired) > 0 {
+					n, err := client.Do(ctx, client.B().Srem().Key(index).Member(expired...).Build()).AsInt64()
+					if err != nil {
+						return removed, fmt.Errorf("failed to prune tag %s: %w", tag, err)
+					}
+					removed += n
+				}
+			}
+
+			if entry.Cursor == 0 {
+				break
+			}
+			cursor = entry.Cursor
+		}
+	}
+	return removed, nil
+}
@@ -0,0 +1,196 @@
+package redis_cache
+
+import (
+	"context"
+	"sort"
+	"testing"
+	"time"
+)
+
+func TestInvalidateTags(t *testing.T) {
+	client := setupTestClient(t)
+	defer Close(client)
+
+	ctx := context.Background()
+	InvalidateTags(ctx, client, "tenant:1", "tenant:2")
+
+	if err := SetStringDataToCacheWithExpiry(ctx, client, "tags-profile-1", "a", ExpireIn(time.Minute).WithTags("tenant:1")); err != nil {
+		t.Fatalf("SetStringDataToCacheWithExpiry() error = %v", err)
+	}
+	if err := SetIntDataToCacheWithExpiry(ctx, client, "tags-count-1", 3, NoExpiry().WithTags("tenant:1", "counters")); err != nil {
+		t.Fatalf("SetIntDataToCacheWithExpiry() error = %v", err)
+	}
+	if err := SetHashFieldsToCache(ctx, client, "tags-hash-1", map[string]string{"name": "one"}, ExpireIn(time.Minute).WithTags("tenant:1")); err != nil {
+		t.Fatalf("SetHashFieldsToCache() error = %v", err)
+	}
+	if err := SetStringDataToCacheWithExpiry(ctx, client, "tags-profile-2", "b", ExpireIn(time.Minute).WithTags("tenant:2")); err != nil {
+		t.Fatalf("SetStringDataToCacheWithExpiry() error = %v", err)
+	}
+
+	keys, err := GetTaggedKeys(ctx, client, "tenant:1")
+	if err != nil {
+		t.Fatalf("GetTaggedKeys() error = %v", err)
+	}
+	sort.Strings(keys)
+	if len(keys) != 3 || keys[0] != "tags-count-1" || keys[1] != "tags-hash-1" || keys[2] != "tags-profile-1" {
+		t.Errorf("GetTaggedKeys() = %v, want the three tenant:1 keys", keys)
+	}
+
+	deleted, err := InvalidateTags(ctx, client, "tenant:1")
+	if err != nil {
+		t.Fatalf("InvalidateTags() error = %v", err)
+	}
+	if deleted != 3 {
+		t.Errorf("InvalidateTags() = %d, want 3", deleted)
+	}
+	if got, _ := GetStringDataFromCache(ctx, client, "tags-profile-1"); got != "" {
+		t.Errorf("Expected tags-profile-1 to be deleted, got %q", got)
+	}
+	if got, _ := GetStringDataFromCache(ctx, client, "tags-profile-2"); got != "b" {
+		t.Errorf("Expected tags-profile-2 of another tag to be kept, got %q", got)
+	}
+	if keys, _ := GetTaggedKeys(ctx, client, "tenant:1"); len(keys) != 0 {
+		t.Errorf("Expected the tenant:1 index to be removed, got %v", keys)
+	}
+
+	// The other tags of an invalidated key still list it until pruned
+	if removed, err := PruneTags(ctx, client, "counters"); err != nil || removed != 1 {
+		t.Errorf("PruneTags() = %d, %v, want 1 removed", removed, err)
+	}
+}
+
+func TestTagIndexTTL(t *testing.T) {
+	client := setupTestClient(t)
+	defer Close(client)
+
+	ctx := context.Background()
+	InvalidateTags(ctx, client, "tags-ttl")
+	indexTTL := func() time.Duration {
+		ms, err := client.Do(ctx, client.B().Pttl().Key(tagKey(client, "tags-ttl")).Build()).AsInt64()
+		if err != nil {
+			t.Fatalf("PTTL error = %v", err)
+		}
+		return time.Duration(ms) * time.Millisecond
+	}
+
+	tests := []struct {
+		name    string
+		key     string
+		expiry  Expiry
+		wantMin time.Duration
+		wantMax time.Duration
+	}{
+		{name: "new index takes the key ttl", key: "tags-ttl-1", expiry: ExpireIn(time.Hour), wantMin: 59 * time.Minute, wantMax: time.Hour},
+		{name: "longer key ttl extends the index", key: "tags-ttl-2", expiry: ExpireIn(2 * time.Hour), wantMin: 119 * time.Minute, wantMax: 2 * time.Hour},
+		{name: "shorter key ttl keeps the index ttl", key: "tags-ttl-3", expiry: ExpireIn(time.Minute), wantMin: 119 * time.Minute, wantMax: 2 * time.Hour},
+		{name: "deadline beyond the index ttl extends it", key: "tags-ttl-4", expiry: ExpireAt(time.Now().Add(3 * time.Hour)), wantMin: 179 * time.Minute, wantMax: 3 * time.Hour},
+		{name: "key without expiry persists the index", key: "tags-ttl-5", expiry: NoExpiry(), wantMin: -time.Millisecond, wantMax: -time.Millisecond},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if err := SetStringDataToCacheWithExpiry(ctx, client, tt.key, "value", tt.expiry.WithoutJitter().WithTags("tags-ttl")); err != nil {
+				t.Fatalf("SetStringDataToCacheWithExpiry() error = %v", err)
+			}
+			if got := indexTTL(); got < tt.wantMin || got > tt.wantMax {
+				t.Errorf("index TTL = %v, want between %v and %v", got, tt.wantMin, tt.wantMax)
+			}
+		})
+	}
+
+	InvalidateTags(ctx, client, "tags-ttl")
+}
+
+func TestInvalidateTagsAfterKeysExpired(t *testing.T) {
+	client := setupTestClient(t)
+	defer Close(client)
+
+	ctx := context.Background()
+	InvalidateTags(ctx, client, "tags-expired")
+
+	for _, key := range []string{"tags-expired-1", "tags-expired-2"} {
+		if err := SetStringDataToCacheWithExpiry(ctx, client, key, "value", ExpireIn(time.Minute).WithTags("tags-expired")); err != nil {
+			t.Fatalf("SetStringDataToCacheWithExpiry() error = %v", err)
+		}
+	}
+	// Stands in for a key expiring on its own
+	DeleteDataFromCache(ctx, client, "tags-expired-1")
+
+	if removed, err := PruneTags(ctx, client, "tags-expired"); err != nil || removed != 1 {
+		t.Errorf("PruneTags() = %d, %v, want 1 removed", removed, err)
+	}
+	if keys, _ := GetTaggedKeys(ctx, client, "tags-expired"); len(keys) != 1 || keys[0] != "tags-expired-2" {
+		t.Errorf("GetTaggedKeys() after prune = %v, want [tags-expired-2]", keys)
+	}
+
+	DeleteDataFromCache(ctx, client, "tags-expired-2")
+	deleted, err := InvalidateTags(ctx, client, "tags-expired")
+	if err != nil {
+		t.Fatalf("InvalidateTags() error = %v", err)
+	}
+	if deleted != 0 {
+		t.Errorf("InvalidateTags() with only expired keys = %d, want 0", deleted)
+	}
+	if keys, _ := GetTaggedKeys(ctx, client, "tags-expired"); len(keys) != 0 {
+		t.Errorf("Expected the index to be removed, got %v", keys)
+	}
+}
+
+func TestTaggedWritesInNamespace(t *testing.T) {
+	base := setupTestClient(t)
+	defer Close(base)
+	client := WithNamespace(base, "tags", 1)
+
+	ctx := context.Background()
+	if err := SetStringDataToCacheWithExpiry(ctx, client, "tags-ns-1", "value", ExpireIn(time.Minute).WithTags("tenant:ns")); err != nil {
+		t.Fatalf("SetStringDataToCacheWithExpiry() error = %v", err)
+	}
+	if keys, _ := GetTaggedKeys(ctx, base, "tenant:ns"); len(keys) != 0 {
+		t.Errorf("Expected the tag to be namespaced, got %v outside the namespace", keys)
+	}
+	if deleted, err := InvalidateTags(ctx, client, "tenant:ns"); err != nil || deleted != 1 {
+		t.Errorf("InvalidateTags() = %d, %v, want 1", deleted, err)
+	}
+}
+
+func TestTaggedWritesAfterScriptFlush(t *testing.T) {
+	client := setupTestClient(t)
+	defer Close(client)
+
+	ctx := context.Background()
+	InvalidateTags(ctx, client, "tags-flushed")
+	if _, ok := DefaultScripts.Script(tagIndexScript.Name()); ok {
+		t.Errorf("Expected the tag index script not to be preloaded on connect")
+	}
+
+	// Nodes that restarted lost the preloaded script, EVALSHA answers NOSCRIPT
+	flush := func() {
+		for _, node := range client.Nodes() {
+			if err := node.Do(ctx, node.B().ScriptFlush().Build()).Error(); err != nil {
+				t.Fatalf("SCRIPT FLUSH error = %v", err)
+			}
+		}
+	}
+
+	flush()
+	if err := SetStringDataToCacheWithExpiry(ctx, client, "tags-flushed-1", "value", ExpireIn(time.Minute).WithTags("tags-flushed")); err != nil {
+		t.Fatalf("SetStringDataToCacheWithExpiry() error = %v", err)
+	}
+
+	flush()
+	pipeline := NewPipeline(client)
+	set := pipeline.SetString("tags-flushed-2", "value", ExpireIn(time.Minute).WithTags("tags-flushed"))
+	if err := pipeline.Exec(ctx); err != nil {
+		t.Fatalf("Exec() error = %v", err)
+	}
+	if ok, err := set.Result(); err != nil || !ok {
+		t.Errorf("SetString() = %v, %v, want true", ok, err)
+	}
+
+	if keys, _ := GetTaggedKeys(ctx, client, "tags-flushed"); len(keys) != 2 {
+		t.Errorf("GetTaggedKeys() = %v, want both keys", keys)
+	}
+	if deleted, err := InvalidateTags(ctx, client, "tags-flushed"); err != nil || deleted != 2 {
+		t.Errorf("InvalidateTags() = %d, %v, want 2", deleted, err)
+	}
+}
@@ -0,0 +1,189 @@
+package redis_cache
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"math/rand/v2"
+	"time"
+
+	"github.com/redis/rueidis"
+)
+
+// This file contains optimistic transactions on a dedicated connection :
+// 1. WATCH the keys, then run a callback that reads them and queues the writes
+// 2. MULTI/EXEC the queued writes, EXEC aborts when a watched key changed
+// 3. Retry aborted transactions with a jittered exponential backoff, within the context deadline
+//
+// The connection is borrowed with rueidis Dedicated, so WATCH is never shared with
+// other callers, whatever the connection_mode. On a cluster every watched
+// and written key must live in the same hash slot, use a hash tag such as {cart:42}.
+
+// ErrTxAborted is returned when a watched key kept changing until the retries ran out.
+var ErrTxAborted = errors.New("transaction aborted, watched keys changed")
+
+// TxOptions tunes Transaction. The zero value uses the defaults below.
+type TxOptions struct {
+	// MaxRetries is how many times an aborted transaction is retried. Defaults to 10.
+	MaxRetries int
+	// MinBackoff is the delay before the first retry, doubled on every retry. Defaults to 5ms.
+	MinBackoff time.Duration
+	// MaxBackoff caps the delay between retries. Defaults to 500ms.
+	MaxBackoff time.Duration
+}
+
+func (o *TxOptions) setDefaults() {
+	if o.MaxRetries <= 0 {
+		o.MaxRetries = 10
+	}
+	if o.MinBackoff <= 0 {
+		o.MinBackoff = 5 * time.Millisecond
+	}
+	if o.MaxBackoff < o.MinBackoff {
+		o.MaxBackoff = max(500*time.Millisecond, o.MinBackoff)
+	}
+}
+
+// Tx is handed to the callback of Transaction. Reads run right away on the
+// watched connection, writes are queued and run atomically by EXEC.
+// Keys are namespaced like every other function of the package.
+type Tx struct {
+	client    rueidis.Client
+	dedicated rueidis.DedicatedClient
+	queued    rueidis.Commands
+	// tagRuns are the tag index updates of the queued writes
+	tagRuns []rueidis.LuaExec
+}
+
+// B returns the command builder, for commands passed to Do and Queue.
+func (tx *Tx) B() rueidis.Builder {
+	return tx.dedicated.B()
+}
+
+// Key returns the namespaced key, for commands built with B.
+func (tx *Tx) Key(key string) string {
+	return namespacedKey(tx.client, key)
+}
+
+// Do runs cmd right away on the watched connection.
+func (tx *Tx) Do(ctx context.Context, cmd rueidis.Completed) rueidis.RedisResult {
+	return tx.dedicated.Do(ctx, cmd)
+}
+
+// Get reads a string right away, returning "" when the key does not exist.
+func (tx *Tx) Get(ctx context.Context, key string) (string, error) {
+	value, err := tx.Do(ctx, tx.B().Get().Key(tx.Key(key)).Build()).ToString()
+	if err != nil {
+		if rueidis.IsRedisNil(err) {
+			return "", nil
+		}
+		return "", fmt.Errorf("failed to get data from cache: %w", err)
+	}
+	return value, nil
+}
+
+// Set queues a SET honouring expiry like SetStringDataToCacheWithExpiry.
+// The tags of expiry are indexed right before MULTI/EXEC, outside of the
+// transaction as the indexes usually live in other hash slots.
+func (tx *Tx) Set(key string, value string, expiry Expiry) error {
+	if err := expiry.validate(); err != nil {
+		return err
+	}
+	expiry = expiry.resolve(tx.client)
+
+	key = tx.Key(key)
+	cmd, err := buildSetCommand(tx.client, key, value, expiry)
+	if err != nil {
+		return err
+	}
+	tx.tagRuns = append(tx.tagRuns, tagIndexRuns(tx.client, key, expiry)...)
+	tx.Queue(cmd)
+	return nil
+}
+
+// Queue queues cmds to run in MULTI/EXEC once the callback returns.
+func (tx *Tx) Queue(cmds ...rueidis.Completed) {
+	tx.queued = append(tx.queued, cmds...)
+}
+
+// Transaction watches keys, runs fn and executes the commands it queued
+// atomically. When a watched key changed in between, EXEC aborts and fn runs
+// again from scratch, so it must not have side effects outside of tx.
+// It returns the replies of the queued commands. An error returned by fn
+// stops the transaction without retrying; ErrTxAborted is returned once the
+// retries ran out and ctx.Err() when ctx is done first.
+func Transaction(ctx context.Context, client rueidis.Client, keys []string, fn func(ctx context.Context, tx *Tx) error, opts TxOptions) ([]rueidis.RedisMessage, error) {
+	opts.setDefaults()
+	if len(keys) == 0 {
+		return nil, fmt.Errorf("at least one key must be watched")
+	}
+
+	backoff := opts.MinBackoff
+	for attempt := 0; ; attempt++ {
+		replies, err := runTransaction(ctx, client, keys, fn)
+		if !errors.Is(err, ErrTxAborted) {
+			return replies, err
+		}
+		if attempt == opts.MaxRetries {
+			return nil, err
+		}
+
+		// Sleep for a random delay in [backoff/2, backoff), so contending
+		// callers do not keep retrying in lockstep
+		delay := backoff/2 + time.Duration(rand.Int64N(int64(backoff/2)+1))
+		if deadline, ok := ctx.Deadline(); ok && time.Until(deadline) < delay {
+			return nil, err
+		}
+		select {
+		case <-ctx.Done():
+			return nil, ctx.Err()
+		case <-time.After(delay):
+		}
+		backoff = min(backoff*2, opts.MaxBackoff)
+	}
+}
+
+// runTransaction makes a single WATCH, fn, MULTI/EXEC attempt.
+func runTransaction(ctx context.Context, client rueidis.Client, keys []string, fn func(ctx context.Context, tx *Tx) error) ([]rueidis.RedisMessage, error) {
+	var replies []rueidis.RedisMessage
+	err := client.Dedicated(func(dedicated rueidis.DedicatedClient) error {
+		if err := dedicated.Do(ctx, dedicated.B().Watch().Key(namespacedKeys(client, keys)...).Build()).Error(); err != nil {
+			return fmt.Errorf("failed to watch keys: %w", err)
+		}
+
+		tx := &Tx{client: client, dedicated: dedicated}
+		if err := fn(ctx, tx); err != nil {
+			dedicated.Do(ctx, dedicated.B().Unwatch().Build())
+			return err
+		}
+		if len(tx.queued) == 0 {
+			return dedicated.Do(ctx, dedicated.B().Unwatch().Build()).Error()
+		}
+		if err := updateTagIndexes(ctx, client, tx.tagRuns); err != nil {
+			dedicated.Do(ctx, dedicated.B().Unwatch().Build())
+			return err
+		}
+
+		cmds := make(rueidis.Commands, 0, len(tx.queued)+2)
+		cmds = append(cmds, dedicated.B().Multi().Build())
+		cmds = append(cmds, tx.queued...)
+		cmds = append(cmds, dedicated.B().Exec().Build())
+
+		resps := dedicated.DoMulti(ctx, cmds...)
+		for _, resp := range resps[:len(resps)-1] {
+			if err := resp.Error(); err != nil {
+				return fmt.Errorf("failed to queue transaction: %w", err)
+			}
+		}
+		var err error
+		replies, err = resps[len(resps)-1].ToArray()
+		if rueidis.IsRedisNil(err) {
+			return ErrTxAborted
+		}
+		if err != nil {
+			return fmt.Errorf("failed to execute transaction: %w", err)
+		}
+		return nil
+	})
+	return replies, err
+}
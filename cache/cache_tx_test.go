@@ -0,0 +1,159 @@
+package redis_cache
+
+import (
+	"context"
+	"errors"
+	"strconv"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/redis/rueidis"
+)
+
+// addToCart increments the quantity of the cart with a read-modify-write.
+func addToCart(ctx context.Context, client rueidis.Client, cart string) error {
+	_, err := Transaction(ctx, client, []string{cart}, func(ctx context.Context, tx *Tx) error {
+		current, err := tx.Get(ctx, cart)
+		if err != nil {
+			return err
+		}
+		quantity, _ := strconv.Atoi(current)
+		return tx.Set(cart, strconv.Itoa(quantity+1), ExpireIn(time.Minute))
+	}, TxOptions{MaxRetries: 100, MinBackoff: time.Millisecond, MaxBackoff: 10 * time.Millisecond})
+	return err
+}
+
+func TestTransactionConcurrentUpdates(t *testing.T) {
+	for _, mode := range connectionModes {
+		t.Run("connection_mode="+mode, func(t *testing.T) {
+			client := setupTestClientWithConnectionMode(t, mode)
+			defer Close(client)
+
+			ctx := context.Background()
+			DeleteDataFromCache(ctx, client, "tx-cart")
+
+			var wg sync.WaitGroup
+			for i := 0; i < 20; i++ {
+				wg.Add(1)
+				go func() {
+					defer wg.Done()
+					if err := addToCart(ctx, client, "tx-cart"); err != nil {
+						t.Errorf("Transaction() error = %v", err)
+					}
+				}()
+			}
+			wg.Wait()
+
+			// No update was lost to a concurrent read-modify-write
+			if got, _ := GetIntDataFromCache(ctx, client, "tx-cart"); got != 20 {
+				t.Errorf("cart quantity = %d, want 20", got)
+			}
+		})
+	}
+}
+
+func TestTransactionAborts(t *testing.T) {
+	client := setupTestClient(t)
+	defer Close(client)
+
+	ctx := context.Background()
+	SetStringDataToCacheWithExpiry(ctx, client, "tx-contended", "0", ExpireIn(time.Minute))
+
+	// Every attempt changes the watched key behind the transaction's back
+	attempts := 0
+	conflicting := func(ctx context.Context, tx *Tx) error {
+		attempts++
+		if err := SetStringDataToCacheWithExpiry(ctx, client, "tx-contended", strconv.Itoa(attempts), ExpireIn(time.Minute)); err != nil {
+			return err
+		}
+		return tx.Set("tx-contended", "lost", ExpireIn(time.Minute))
+	}
+
+	_, err := Transaction(ctx, client, []string{"tx-contended"}, conflicting, TxOptions{MaxRetries: 2, MinBackoff: time.Millisecond})
+	if !errors.Is(err, ErrTxAborted) {
+		t.Errorf("Transaction() error = %v, want ErrTxAborted", err)
+	}
+	if attempts != 3 {
+		t.Errorf("callback ran %d times, want 3", attempts)
+	}
+	if got, _ := GetStringDataFromCache(ctx, client, "tx-contended"); got != "3" {
+		t.Errorf("value = %q, want the concurrent write %q", got, "3")
+	}
+
+	// A deadline shorter than the backoff stops retrying early
+	attempts = 0
+	deadlineCtx, cancel := context.WithTimeout(ctx, 20*time.Millisecond)
+	defer cancel()
+	_, err = Transaction(deadlineCtx, client, []string{"tx-contended"}, conflicting, TxOptions{MinBackoff: time.Second})
+	if !errors.Is(err, ErrTxAborted) || attempts != 1 {
+		t.Errorf("Transaction() = %v after %d attempts, want ErrTxAborted after 1", err, attempts)
+	}
+
+	// A callback error is returned as is and nothing is written
+	errCart := errors.New("cart is locked")
+	_, err = Transaction(ctx, client, []string{"tx-contended"}, func(ctx context.Context, tx *Tx) error {
+		tx.Set("tx-contended", "never", ExpireIn(time.Minute))
+		return errCart
+	}, TxOptions{})
+	if !errors.Is(err, errCart) {
+		t.Errorf("Transaction() error = %v, want the callback error", err)
+	}
+	if got, _ := GetStringDataFromCache(ctx, client, "tx-contended"); got == "never" {
+		t.Errorf("Expected nothing to be written when the callback fails")
+	}
+}
+
+func TestTransactionReplies(t *testing.T) {
+	client := setupTestClient(t)
+	defer Close(client)
+
+	ctx := context.Background()
+	DeleteDataFromCache(ctx, client, "tx-counter")
+
+	replies, err := Transaction(ctx, client, []string{"tx-counter"}, func(ctx context.Context, tx *Tx) error {
+		tx.Queue(
+			tx.B().Incrby().Key(tx.Key("tx-counter")).Increment(5).Build(),
+			tx.B().Incrby().Key(tx.Key("tx-counter")).Increment(2).Build(),
+		)
+		return nil
+	}, TxOptions{})
+	if err != nil {
+		t.Fatalf("Transaction() error = %v", err)
+	}
+	if len(replies) != 2 {
+		t.Fatalf("Transaction() returned %d replies, want 2", len(replies))
+	}
+	if got, _ := replies[1].AsInt64(); got != 7 {
+		t.Errorf("second reply = %d, want 7", got)
+	}
+}
+
+func TestTransactionSetWithTags(t *testing.T) {
+	client := setupTestClient(t)
+	defer Close(client)
+
+	ctx := context.Background()
+	DeleteDataFromCache(ctx, client, "tx-tagged")
+	InvalidateTags(ctx, client, "tx-tag")
+
+	_, err := Transaction(ctx, client, []string{"tx-tagged"}, func(ctx context.Context, tx *Tx) error {
+		return tx.Set("tx-tagged", "value", ExpireIn(time.Minute).WithTags("tx-tag"))
+	}, TxOptions{})
+	if err != nil {
+		t.Fatalf("Transaction() error = %v", err)
+	}
+	if keys, _ := GetTaggedKeys(ctx, client, "tx-tag"); len(keys) != 1 || keys[0] != "tx-tagged" {
+		t.Errorf("GetTaggedKeys() = %v, want [tx-tagged]", keys)
+	}
+	if deleted, err := InvalidateTags(ctx, client, "tx-tag"); err != nil || deleted != 1 {
+		t.Errorf("InvalidateTags() = %d, %v, want 1", deleted, err)
+	}
+
+	_, err = Transaction(ctx, client, []string{"tx-tagged"}, func(ctx context.Context, tx *Tx) error {
+		return tx.Set("tx-tagged", "value", ExpireIn(-time.Second))
+	}, TxOptions{})
+	if err == nil {
+		t.Errorf("Transaction() with a negative expiry error = nil, want an error")
+	}
+}
@@ -0,0 +1,141 @@
+package redis_cache
+
+import (
+	"context"
+	"fmt"
+	"math"
+	"math/rand/v2"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/redis/rueidis"
+)
+
+// This file contains the XFetch read mode, probabilistic early expiration :
+// 1. Writes store the value as usual, plus its recomputation cost and expiry under <key>:xfetch
+// 2. Each read may recompute the value before it expires, with a probability
+//    growing as the expiry approaches and with the recomputation cost
+//
+// Unlike a lock around the loader, no reader ever waits for another one: a
+// single reader is likely to refresh the value early while the others keep
+// reading it. See "Optimal Probabilistic Cache Stampede Prevention", Vattani et al.
+
+// XFetchOptions configures GetStringWithXFetch.
+type XFetchOptions struct {
+	// TTL is how long a loaded value is cached. Required.
+	TTL time.Duration
+	// Beta scales how early values are refreshed, above 1 favours earlier
+	// refreshes and below 1 later ones. Defaults to 1.
+	Beta float64
+	// Rand returns a uniform number in [0, 1), math/rand/v2 by default.
+	Rand func() float64
+	// Now is the clock, time.Now by default.
+	Now func() time.Time
+	// OnRefreshError is called when an early refresh fails, the cached value
+	// is returned in that case since it has not expired yet.
+	OnRefreshError func(key string, err error)
+}
+
+func (o *XFetchOptions) setDefaults() {
+	if o.Beta <= 0 {
+		o.Beta = 1
+	}
+	if o.Rand == nil {
+		o.Rand = rand.Float64
+	}
+	if o.Now == nil {
+		o.Now = time.Now
+	}
+}
+
+// xfetchKey returns the key holding the recomputation cost and expiry of key.
+func xfetchKey(key string) string {
+	return key + KeySeparator + "xfetch"
+}
+
+// GetStringWithXFetch returns the value of key like GetStringDataFromCache,
+// calling loader on a miss and, with a probability growing as the value
+// approaches its expiry, before it expires.
+func GetStringWithXFetch(ctx context.Context, client rueidis.Client, key string, loader Loader[string], opts XFetchOptions) (string, error) {
+	opts.setDefaults()
+	if opts.TTL <= 0 {
+		return "", fmt.Errorf("expiry time must be greater than 0")
+	}
+
+	value, err := GetStringDataFromCache(ctx, client, key)
+	if err != nil {
+		return "", err
+	}
+	if value == "" {
+		return loadWithXFetch(ctx, client, key, loader, opts)
+	}
+
+	meta, err := GetStringDataFromCache(ctx, client, xfetchKey(key))
+	if err != nil {
+		return "", err
+	}
+	delta, expiry, ok := parseXFetchMeta(meta)
+	if !ok || !shouldRefreshEarly(opts, delta, expiry) {
+		return value, nil
+	}
+
+	refreshed, err := loadWithXFetch(ctx, client, key, loader, opts)
+	if err != nil {
+		if opts.OnRefreshError != nil {
+			opts.OnRefreshError(key, err)
+		}
+		return value, nil
+	}
+	return refreshed, nil
+}
+
+// shouldRefreshEarly is the XFetch test: now - delta * beta * ln(rand) >= expiry.
+func shouldRefreshEarly(opts XFetchOptions, delta time.Duration, expiry time.Time) bool {
+	// 1 - Rand() is in (0, 1], so the logarithm is finite and not positive
+	gap := -float64(delta) * opts.Beta * math.Log(1-opts.Rand())
+	return !opts.Now().Add(time.Duration(gap)).Before(expiry)
+}
+
+// loadWithXFetch calls loader, timing it, and caches the value with its
+// recomputation cost.
+func loadWithXFetch(ctx context.Context, client rueidis.Client, key string, loader Loader[string], opts XFetchOptions) (string, error) {
+	start := opts.Now()
+	value, err := loader(ctx)
+	if err != nil {
+		return "", fmt.Errorf("failed to load %s: %v", key, err)
+	}
+	now := opts.Now()
+	delta := now.Sub(start)
+
+	// Jitter is left out, the early refreshes already spread the recomputations
+	expiry := ExpireIn(opts.TTL).WithoutJitter()
+	// The cost is kept in microseconds, loads from a local cache often take less than a millisecond
+	meta := strconv.FormatInt(delta.Microseconds(), 10) + "us" + KeySeparator + strconv.FormatInt(now.Add(opts.TTL).UnixMilli(), 10)
+	if err := SetStringDataToCacheWithExpiry(ctx, client, xfetchKey(key), meta, expiry); err != nil {
+		return value, err
+	}
+	return value, SetStringDataToCacheWithExpiry(ctx, client, key, value, expiry)
+}
+
+// parseXFetchMeta parses "<delta>us:<expiry unix ms>", or "<delta ms>:<expiry unix ms>"
+// as written before the cost was kept in microseconds.
+func parseXFetchMeta(meta string) (time.Duration, time.Time, bool) {
+	deltaPart, expiryPart, found := strings.Cut(meta, KeySeparator)
+	if !found {
+		return 0, time.Time{}, false
+	}
+	delta, err := time.ParseDuration(deltaPart)
+	if err != nil {
+		ms, err := strconv.ParseInt(deltaPart, 10, 64)
+		if err != nil {
+			return 0, time.Time{}, false
+		}
+		delta = time.Duration(ms) * time.Millisecond
+	}
+	expiry, err := strconv.ParseInt(expiryPart, 10, 64)
+	if err != nil {
+		return 0, time.Time{}, false
+	}
+	return delta, time.UnixMilli(expiry), true
+}
@@ -0,0 +1,171 @@
+package redis_cache
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+)
+
+// fakeClock is a clock that only moves when told to, or when slept on.
+type fakeClock struct {
+	now    time.Time
+	sleeps []time.Duration
+}
+
+func (c *fakeClock) Now() time.Time          { return c.now }
+func (c *fakeClock) Advance(d time.Duration) { c.now = c.now.Add(d) }
+
+// Sleep records d and advances the clock without waiting.
+func (c *fakeClock) Sleep(ctx context.Context, d time.Duration) error {
+	c.sleeps = append(c.sleeps, d)
+	c.Advance(d)
+	return ctx.Err()
+}
+
+func TestGetStringWithXFetch(t *testing.T) {
+	client := setupTestClient(t)
+	defer Close(client)
+
+	ctx := context.Background()
+	tests := []struct {
+		name string
+		// elapsed is how long after the load the value is read, the TTL is 60s
+		// and the recomputation took 2s
+		elapsed     time.Duration
+		beta        float64
+		rand        float64
+		wantRefresh bool
+	}{
+		{name: "far from expiry", elapsed: 30 * time.Second, beta: 1, rand: 0.5, wantRefresh: false},
+		{name: "within the expected gap", elapsed: 59 * time.Second, beta: 1, rand: 0.5, wantRefresh: true},
+		{name: "just outside the expected gap", elapsed: 58 * time.Second, beta: 1, rand: 0.5, wantRefresh: false},
+		{name: "a larger beta refreshes earlier", elapsed: 58 * time.Second, beta: 2, rand: 0.5, wantRefresh: true},
+		{name: "an unlucky draw refreshes much earlier", elapsed: 50 * time.Second, beta: 1, rand: 0.999, wantRefresh: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			DeleteDataFromCache(ctx, client, "xfetch-key")
+			DeleteDataFromCache(ctx, client, xfetchKey("xfetch-key"))
+
+			clock := &fakeClock{now: time.Unix(1700000000, 0)}
+			loads := 0
+			loader := func(ctx context.Context) (string, error) {
+				loads++
+				clock.Advance(2 * time.Second)
+				return "value-" + string(rune('0'+loads)), nil
+			}
+			opts := XFetchOptions{
+				TTL:  time.Minute,
+				Beta: tt.beta,
+				Rand: func() float64 { return tt.rand },
+				Now:  clock.Now,
+			}
+
+			if got, err := GetStringWithXFetch(ctx, client, "xfetch-key", loader, opts); err != nil || got != "value-1" {
+				t.Fatalf("GetStringWithXFetch() on a miss = %q, %v, want %q", got, err, "value-1")
+			}
+
+			clock.Advance(tt.elapsed)
+			want := "value-1"
+			if tt.wantRefresh {
+				want = "value-2"
+			}
+			if got, err := GetStringWithXFetch(ctx, client, "xfetch-key", loader, opts); err != nil || got != want {
+				t.Errorf("GetStringWithXFetch() = %q, %v, want %q", got, err, want)
+			}
+			// The value stays readable without the read mode
+			if got, _ := GetStringDataFromCache(ctx, client, "xfetch-key"); got != want {
+				t.Errorf("GetStringDataFromCache() = %q, want %q", got, want)
+			}
+		})
+	}
+}
+
+func TestGetStringWithXFetchRefreshError(t *testing.T) {
+	client := setupTestClient(t)
+	defer Close(client)
+
+	ctx := context.Background()
+	clock := &fakeClock{now: time.Unix(1700000000, 0)}
+	var refreshErr error
+	opts := XFetchOptions{
+		TTL:            time.Minute,
+		Rand:           func() float64 { return 0.999 },
+		Now:            clock.Now,
+		OnRefreshError: func(key string, err error) { refreshErr = err },
+	}
+
+	ok := func(ctx context.Context) (string, error) {
+		clock.Advance(2 * time.Second)
+		return "cached", nil
+	}
+	if _, err := GetStringWithXFetch(ctx, client, "xfetch-error", ok, opts); err != nil {
+		t.Fatalf("GetStringWithXFetch() error = %v", err)
+	}
+
+	// An early refresh that fails keeps serving the value, it has not expired yet
+	clock.Advance(59 * time.Second)
+	failing := func(ctx context.Context) (string, error) { return "", errors.New("database down") }
+	if got, err := GetStringWithXFetch(ctx, client, "xfetch-error", failing, opts); err != nil || got != "cached" {
+		t.Errorf("GetStringWithXFetch() = %q, %v, want %q", got, err, "cached")
+	}
+	if refreshErr == nil {
+		t.Errorf("Expected OnRefreshError to be called")
+	}
+
+	// A miss has nothing to fall back to
+	DeleteDataFromCache(ctx, client, "xfetch-error")
+	if _, err := GetStringWithXFetch(ctx, client, "xfetch-error", failing, opts); err == nil {
+		t.Errorf("Expected the loader error on a miss")
+	}
+}
+
+func TestParseXFetchMeta(t *testing.T) {
+	tests := []struct {
+		name      string
+		meta      string
+		wantDelta time.Duration
+		wantOK    bool
+	}{
+		{name: "sub-millisecond cost", meta: "250us:1700000060000", wantDelta: 250 * time.Microsecond, wantOK: true},
+		{name: "cost in milliseconds written by older versions", meta: "2000:1700000060000", wantDelta: 2 * time.Second, wantOK: true},
+		{name: "no expiry", meta: "250us", wantOK: false},
+		{name: "invalid cost", meta: "fast:1700000060000", wantOK: false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			delta, expiry, ok := parseXFetchMeta(tt.meta)
+			if ok != tt.wantOK || delta != tt.wantDelta {
+				t.Errorf("parseXFetchMeta(%q) = %v, %v, want %v, %v", tt.meta, delta, ok, tt.wantDelta, tt.wantOK)
+			}
+			if ok && !expiry.Equal(time.UnixMilli(1700000060000)) {
+				t.Errorf("parseXFetchMeta(%q) expiry = %v", tt.meta, expiry)
+			}
+		})
+	}
+}
+
+func TestGetStringWithXFetchSubMillisecondCost(t *testing.T) {
+	client := setupTestClient(t)
+	defer Close(client)
+
+	ctx := context.Background()
+	DeleteDataFromCache(ctx, client, "xfetch-fast")
+	DeleteDataFromCache(ctx, client, xfetchKey("xfetch-fast"))
+	clock := &fakeClock{now: time.Unix(1700000000, 0)}
+	loader := func(ctx context.Context) (string, error) {
+		clock.Advance(300 * time.Microsecond)
+		return "value", nil
+	}
+	if _, err := GetStringWithXFetch(ctx, client, "xfetch-fast", loader, XFetchOptions{TTL: time.Minute, Now: clock.Now}); err != nil {
+		t.Fatalf("GetStringWithXFetch() error = %v", err)
+	}
+
+	meta, _ := GetStringDataFromCache(ctx, client, xfetchKey("xfetch-fast"))
+	if delta, _, ok := parseXFetchMeta(meta); !ok || delta != 300*time.Microsecond {
+		t.Errorf("stored cost = %v (%q), want 300µs", delta, meta)
+	}
+}
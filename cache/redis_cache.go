@@ -3,6 +3,7 @@ package redis_cache
 import (
 	"context"
 	"fmt"
+	"log"
 	"strconv"
 	"time"
 
@@ -10,9 +11,12 @@ import (
 )
 
 // This file contains the following methods :
-// 1. Method to establish a connection pool with a redis cache
-// 2. Method to set data to cache - with the option to add expiry
+// 1. Method to establish a connection pool with a redis cache, right away or in the background (see cache_lazy.go)
+// 2. Method to set data to cache - with the option to add expiry (see cache_expiry.go)
 // 3. Method to get data from cache
+// 4. Method to delete data from cache
+// 5. Method to close the connections right away, see cache_shutdown.go for a graceful shutdown
+// All keys are prefixed with the client's namespace (see cache_namespace.go)
 
 // Initialize creates a new Redis connection pool.
 // It can be called without arguments to use the default config path,
@@ -33,7 +37,7 @@ func InitializeCacheConnection(configFilePath ...string) (rueidis.Client, error)
 	// NOTE :
 	// 	While auto pipelining maximizes throughput, it relies on additional goroutines to process requests
 	// and responses and may add some latencies due to goroutine scheduling and head of line blocking.
-	// You can avoid this by setting DisableAutoPipelining to true, then it will switch to connection pooling
+	// You can avoid this by setting connection_mode to pool or dedicated, then it will switch to connection pooling
 	// approach and serve each request with dedicated connection on the same goroutine.
 	// Ref : https://pkg.go.dev/github.com/redis/rueidis#section-readme
 
@@ -51,98 +55,201 @@ func InitializeCacheConnection(configFilePath ...string) (rueidis.Client, error)
 	//}
 
 	_redis_cache_host := fmt.Sprintf("%s:%s", config.Cache.Usage_Cache_DB.Host, config.Cache.Usage_Cache_DB.Port)
-	init_address := []string{_redis_cache_host}
-
-	client, err := rueidis.NewClient(rueidis.ClientOption{
-		InitAddress:           init_address,                         // Redis server address
-		Password:              config.Cache.Usage_Cache_DB.Password, // Redis password
-		SelectDB:              config.Cache.Usage_Cache_DB.Database, // Redis database number
-		DisableCache:          config.Cache.Usage_Cache_DB.DisableClientSideCache,
-		BlockingPoolCleanup:   config.Cache.Usage_Cache_DB.Pool_Max_Idle_Time,
-		BlockingPoolMinSize:   config.Cache.Usage_Cache_DB.Pool_Min_Connections,
-		BlockingPoolSize:      config.Cache.Usage_Cache_DB.Pool_Max_Connections,
-		DisableAutoPipelining: config.Cache.Usage_Cache_DB.Auto_Pipelining_Mode,
-	})
+
+	// Return right away and connect in the background (see cache_lazy.go)
+	if config.Cache.Usage_Cache_DB.Lazy_Connect.Enabled {
+		client := newLazyClient(config.lazyConnectOptions(), func(ctx context.Context) (rueidis.Client, error) {
+			return dialAddress(ctx, config, _redis_cache_host, config.Cache.Usage_Cache_DB.Password, config.Cache.Usage_Cache_DB.Database)
+		})
+		log.Printf("redis_cache: connecting to Redis on %s in the background", _redis_cache_host)
+		return &cacheClient{Client: client, opts: newClientOptions(config)}, nil
+	}
+
+	client, err := connectToAddress(config, _redis_cache_host, config.Cache.Usage_Cache_DB.Password, config.Cache.Usage_Cache_DB.Database)
 	if err != nil {
-		return nil, fmt.Errorf("failed to create Redis client: %v", err)
+		return nil, err
 	}
-	fmt.Println("Connected to Redis!")
+	log.Printf("redis_cache: connected to Redis on %s", _redis_cache_host)
+
+	return client, nil
 
+}
+
+// connectToAddress creates a connection pool to a single Redis endpoint using
+// the pool settings of config, and health checks it with a PING.
+func connectToAddress(config *CacheConnectionConfig, address string, password string, database int) (rueidis.Client, error) {
 	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
 	defer cancel()
 
-	// Perform a health check
-	if err := client.Do(ctx, client.B().Ping().Build()).Error(); err != nil {
-		return nil, fmt.Errorf("Redis health check failed: %v", err)
+	client, err := dialAddress(ctx, config, address, password, database)
+	if err != nil {
+		return nil, err
+	}
+	return &cacheClient{Client: client, opts: newClientOptions(config)}, nil
+}
+
+// dialAddress creates the rueidis client of a single Redis endpoint, health
+// checks it with a PING and loads the registered scripts and function libraries.
+func dialAddress(ctx context.Context, config *CacheConnectionConfig, address string, password string, database int) (rueidis.Client, error) {
+	client, err := dialPlainAddress(ctx, config, address, password, database)
+	if err != nil {
+		return nil, err
+	}
+
+	// Load the registered Lua scripts (see cache_script.go)
+	if err := DefaultScripts.Preload(ctx, client); err != nil {
+		client.Close()
+		return nil, fmt.Errorf("failed to preload scripts: %w", err)
+	}
+
+	// Load the registered function libraries (see cache_function.go)
+	if err := loadDefaultFunctionLibraries(ctx, client); err != nil {
+		client.Close()
+		return nil, err
 	}
-	fmt.Println("Redis is healthy!")
 
 	return client, nil
+}
 
+// dialPlainAddress creates the rueidis client of a single Redis endpoint and
+// health checks it with a PING, both bounded by ctx.
+func dialPlainAddress(ctx context.Context, config *CacheConnectionConfig, address string, password string, database int) (rueidis.Client, error) {
+	option := rueidis.ClientOption{
+		InitAddress:  []string{address}, // Redis server address
+		Password:     password,          // Redis password
+		SelectDB:     database,          // Redis database number
+		DisableCache: config.Cache.Usage_Cache_DB.DisableClientSideCache,
+	}
+	// Pool sizes and the auto pipelining / pooling options of connection_mode
+	config.applyConnectionMode(&option)
+	// The connection and handshake are not bound by ctx otherwise
+	if deadline, ok := ctx.Deadline(); ok {
+		option.Dialer.Timeout = max(time.Until(deadline), time.Millisecond)
+	}
+
+	client, err := rueidis.NewClient(option)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create Redis client: %w", err)
+	}
+
+	// Perform a health check
+	if err := client.Do(ctx, client.B().Ping().Build()).Error(); err != nil {
+		client.Close()
+		return nil, fmt.Errorf("Redis health check failed: %w", err)
+	}
+	return client, nil
 }
 
+// SetStringDataToCache sets a string value with an expiry in seconds.
+// An expiry of 0 writes the key without an expiry time.
+//
+// Deprecated: use SetStringDataToCacheWithExpiry, which accepts sub-second
+// TTLs, absolute deadlines and KEEPTTL.
 func SetStringDataToCache(ctx context.Context, client rueidis.Client, key string, value string, expiry int64) error {
-	if expiry == 0 {
-		// Set the data in cache without the expiry time
-		err := client.Do(ctx, client.B().Set().Key(key).Value(value).Build()).Error()
-		if err != nil {
-			return fmt.Errorf("failed to set data to cache: %v", err)
-		}
-	} else if expiry > 0 {
-		// Set the data in cache with the expiry time
-		err := client.Do(ctx, client.B().Set().Key(key).Value(value).ExSeconds(expiry).Build()).Error()
-		if err != nil {
-			return fmt.Errorf("failed to set data to cache: %v", err)
+	exp, err := expiryFromSeconds(expiry)
+	if err != nil {
+		return err
+	}
+	return SetStringDataToCacheWithExpiry(ctx, client, key, value, exp)
+}
+
+// SetStringDataToCacheWithExpiry sets a string value honouring the given Expiry.
+func SetStringDataToCacheWithExpiry(ctx context.Context, client rueidis.Client, key string, value string, expiry Expiry) error {
+	if err := expiry.validate(); err != nil {
+		return err
+	}
+	expiry = expiry.resolve(client)
+
+	key = namespacedKey(client, key)
+	cmd, err := buildSetCommand(client, key, value, expiry)
+	if err != nil {
+		return err
+	}
+
+	// Fail open to the local store while Redis is down (see cache_fallback.go)
+	fallback := optionsOf(client).fallback
+	if fallback.active() {
+		fallback.set(key, value, expiry)
+		return nil
+	}
+	err = addToTags(ctx, client, key, expiry)
+	if err == nil {
+		err = client.Do(ctx, cmd).Error()
+	}
+	if err != nil {
+		if fallback.fallBack(client, err) {
+			fallback.set(key, value, expiry)
+			return nil
 		}
-	} else {
-		return fmt.Errorf("expiry time must be greater than 0")
+		return fmt.Errorf("failed to set data to cache: %w", err)
 	}
+	fallback.succeeded()
 	return nil
 }
 
 func GetStringDataFromCache(ctx context.Context, client rueidis.Client, key string) (string, error) {
-	resp, err := client.Do(ctx, client.B().Get().Key(key).Build()).ToString()
+	resp, found, err := getString(ctx, client, key)
 	if err != nil {
-		if rueidis.IsRedisNil(err) {
-			return "", nil
-		} else {
-			return "", fmt.Errorf("failed to get data from cache: %v", err)
-		}
+		return "", fmt.Errorf("failed to get data from cache: %w", err)
+	}
+	if !found {
+		return "", nil
 	}
 	return resp, nil
 }
 
-func SetIntDataToCache(ctx context.Context, client rueidis.Client, key string, value int, expiry int64) error {
-	// Convert the int value to string
-	strvalue := strconv.Itoa(value)
+// getString reads key, from the local store while Redis is down (see cache_fallback.go).
+func getString(ctx context.Context, client rueidis.Client, key string) (string, bool, error) {
+	key = namespacedKey(client, key)
+	fallback := optionsOf(client).fallback
+	if fallback.active() {
+		value, found := fallback.get(key)
+		return value, found, nil
+	}
 
-	if expiry == 0 {
-		// Set the data in cache without the expiry time
-		err := client.Do(ctx, client.B().Set().Key(key).Value(strvalue).Build()).Error()
-		if err != nil {
-			return fmt.Errorf("failed to set data to cache: %v", err)
+	resp, err := client.Do(ctx, client.B().Get().Key(key).Build()).ToString()
+	if err != nil {
+		if rueidis.IsRedisNil(err) {
+			fallback.succeeded()
+			return "", false, nil
 		}
-	} else if expiry > 0 {
-		// Set the data in cache with the expiry time
-		err := client.Do(ctx, client.B().Set().Key(key).Value(strvalue).ExSeconds(expiry).Build()).Error()
-		if err != nil {
-			return fmt.Errorf("failed to set data to cache: %v", err)
+		if fallback.fallBack(client, err) {
+			value, found := fallback.get(key)
+			return value, found, nil
 		}
-	} else {
-		return fmt.Errorf("expiry time must be greater than 0")
+		return "", false, err
 	}
-	return nil
+	fallback.succeeded()
+	return resp, true, nil
+}
+
+// SetIntDataToCache sets an integer value with an expiry in seconds.
+// An expiry of 0 writes the key without an expiry time.
+//
+// Deprecated: use SetIntDataToCacheWithExpiry, which accepts sub-second
+// TTLs, absolute deadlines and KEEPTTL.
+func SetIntDataToCache(ctx context.Context, client rueidis.Client, key string, value int, expiry int64) error {
+	exp, err := expiryFromSeconds(expiry)
+	if err != nil {
+		return err
+	}
+	return SetIntDataToCacheWithExpiry(ctx, client, key, value, exp)
+}
+
+// SetIntDataToCacheWithExpiry sets an integer value honouring the given Expiry.
+func SetIntDataToCacheWithExpiry(ctx context.Context, client rueidis.Client, key string, value int, expiry Expiry) error {
+	// Convert the int value to string
+	return SetStringDataToCacheWithExpiry(ctx, client, key, strconv.Itoa(value), expiry)
 }
 
 func GetIntDataFromCache(ctx context.Context, client rueidis.Client, key string) (int, error) {
-	resp, err := client.Do(ctx, client.B().Get().Key(key).Build()).ToString()
+	resp, found, err := getString(ctx, client, key)
+	// returns neg integers if there is any error
 	if err != nil {
-		// returns neg integers if there is any error
-		if rueidis.IsRedisNil(err) {
-			return -1, nil
-		} else {
-			return -2, fmt.Errorf("failed to get data from cache: %v", err)
-		}
+		return -2, fmt.Errorf("failed to get data from cache: %w", err)
+	}
+	if !found {
+		return -1, nil
 	}
 
 	// Convert string back to int
@@ -153,7 +260,32 @@ func GetIntDataFromCache(ctx context.Context, client rueidis.Client, key string)
 	return value, nil
 }
 
+// DeleteDataFromCache deletes the given keys and returns how many existed.
+func DeleteDataFromCache(ctx context.Context, client rueidis.Client, keys ...string) (int64, error) {
+	if len(keys) == 0 {
+		return 0, nil
+	}
+	keys = namespacedKeys(client, keys)
+	fallback := optionsOf(client).fallback
+	if fallback.active() {
+		return fallback.delete(keys), nil
+	}
+	deleted, err := client.Do(ctx, client.B().Del().Key(keys...).Build()).AsInt64()
+	if err != nil {
+		if fallback.fallBack(client, err) {
+			return fallback.delete(keys), nil
+		}
+		return 0, fmt.Errorf("failed to delete data from cache: %w", err)
+	}
+	fallback.succeeded()
+	return deleted, nil
+}
+
+// Close closes the connections right away, failing the commands in flight
+// with rueidis.ErrClosing. Use Shutdown to let them finish first.
 func Close(client rueidis.Client) {
+	// Stop the fallback probe (see cache_fallback.go)
+	optionsOf(client).fallback.close()
 	client.Close()
-	fmt.Println("Redis connection closed!")
+	log.Printf("redis_cache: Redis connection closed")
 }
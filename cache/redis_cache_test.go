@@ -4,13 +4,14 @@ import (
 	"context"
 	"os"
 	"path/filepath"
+	"strings"
 	"testing"
 	"time"
 
 	"github.com/redis/rueidis"
 )
 
-func setupTestConfig(t *testing.T) string {
+func setupTestConfig(t testing.TB) string {
 	// Create a temporary directory and file
 	tmpDir := t.TempDir()
 	tmpFile := filepath.Join(tmpDir, "test_config.yaml")
@@ -25,7 +26,7 @@ cache:
     database: 0
     pool_max_connections: 10
     pool_min_connections: 2
-    auto_pipelining_mode: true
+    connection_mode: pool
     disable_cache: false
     pool_max_idle_time: 3600s
 `
@@ -45,6 +46,32 @@ func setupTestClient(t *testing.T) rueidis.Client {
 	return client
 }
 
+// connectionModes are the values of connection_mode, for tests that must work in every mode.
+var connectionModes = []string{ConnectionModeAutoPipeline, ConnectionModePool, ConnectionModeDedicated}
+
+// setupTestClientWithConnectionMode returns a test client with connection_mode set to mode,
+// extra settings such as "max_flush_delay: 20us" are added to usage_cache_db.
+func setupTestClientWithConnectionMode(t testing.TB, mode string, extra ...string) rueidis.Client {
+	configPath := setupTestConfig(t)
+	content, err := os.ReadFile(configPath)
+	if err != nil {
+		t.Fatalf("Failed to read test config file: %v", err)
+	}
+	content = []byte(strings.Replace(string(content), "connection_mode: pool", "connection_mode: "+mode, 1))
+	for _, setting := range extra {
+		content = append(content, "    "+setting+"\n"...)
+	}
+	if err := os.WriteFile(configPath, content, 0644); err != nil {
+		t.Fatalf("Failed to write test config file: %v", err)
+	}
+
+	client, err := InitializeCacheConnection(configPath)
+	if err != nil {
+		t.Fatalf("Failed to initialize test client: %v", err)
+	}
+	return client
+}
+
 func TestInitializeCacheConnection(t *testing.T) {
 	tests := []struct {
 		name        string
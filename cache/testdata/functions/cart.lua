@@ -0,0 +1,15 @@
+#!lua name=cart
+-- version: 2
+
+-- cart_add increments the quantity of ARGV[1] in the cart hash KEYS[1], returns the new quantity.
+local function cart_add(keys, args)
+	return redis.call('HINCRBY', keys[1], args[1], args[2])
+end
+
+-- cart_count returns the number of distinct items in the cart hash KEYS[1].
+local function cart_count(keys, args)
+	return redis.call('HLEN', keys[1])
+end
+
+redis.register_function('cart_add', cart_add)
+redis.register_function{function_name = 'cart_count', callback = cart_count, flags = {'no-writes'}}
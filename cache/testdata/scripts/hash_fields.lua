@@ -0,0 +1,2 @@
+-- Returns the fields of the hash KEYS[1] as a flat {field, value, ...} table.
+return redis.call('HGETALL', KEYS[1])
@@ -0,0 +1,5 @@
+-- Increments KEYS[1] by ARGV[1] without going over ARGV[2], returns the new value.
+local current = tonumber(redis.call('GET', KEYS[1]) or '0')
+local next = math.min(current + tonumber(ARGV[1]), tonumber(ARGV[2]))
+redis.call('SET', KEYS[1], next)
+return next
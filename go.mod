@@ -4,12 +4,17 @@ go 1.23.0
 
 toolchain go1.23.7
 
-require gopkg.in/yaml.v2 v2.4.0
+require (
+	github.com/alicebob/miniredis/v2 v2.37.0
+	github.com/redis/rueidis v1.0.69
+	github.com/redis/rueidis/rueidishook v1.0.69
+	github.com/vmihailenco/msgpack/v5 v5.4.1
+	golang.org/x/exp v0.0.0-20250305212735-054e65f0b394
+	gopkg.in/yaml.v2 v2.4.0
+)
 
 require (
-	github.com/redis/rueidis v1.0.56 // indirect
-	github.com/vmihailenco/msgpack/v5 v5.4.1 // indirect
 	github.com/vmihailenco/tagparser/v2 v2.0.0 // indirect
-	golang.org/x/exp v0.0.0-20250305212735-054e65f0b394 // indirect
+	github.com/yuin/gopher-lua v1.1.1 // indirect
 	golang.org/x/sys v0.31.0 // indirect
 )
@@ -2,6 +2,7 @@
 // v2 : create a connection pool -- DONE
 // v3 : create the functions to set and get values -- DONE
 // v4 : create the functions to set and get values with expiration -- DONE
+// v5 : accept time.Duration, absolute deadline and KEEPTTL based expiry -- DONE
 
 package main
 
@@ -28,7 +29,7 @@ func main() {
 	defer cancel()
 
 	// Set a string key-value pair with 1 hour expiry
-	err = redis_cache.SetStringDataToCache(ctx, client, "string-key", "test-value", 3600)
+	err = redis_cache.SetStringDataToCacheWithExpiry(ctx, client, "string-key", "test-value", redis_cache.ExpireIn(time.Hour))
 	if err != nil {
 		log.Fatalf("could not set string key: %v", err)
 	}
@@ -41,7 +42,7 @@ func main() {
 	fmt.Println("String Value:", stringValue)
 
 	// Set an integer key-value pair with 30 minutes expiry
-	err = redis_cache.SetIntDataToCache(ctx, client, "int-key", 42, 1800)
+	err = redis_cache.SetIntDataToCacheWithExpiry(ctx, client, "int-key", 42, redis_cache.ExpireIn(30*time.Minute))
 	if err != nil {
 		log.Fatalf("could not set int key: %v", err)
 	}
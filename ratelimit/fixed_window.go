@@ -0,0 +1,62 @@
+package ratelimit
+
+import (
+	"context"
+	"strconv"
+	"time"
+
+	"github.com/redis/rueidis"
+)
+
+// fixedWindowScript counts requests in a key that expires with the window.
+// KEYS[1] is the counter, ARGV[1] the limit, ARGV[2] the window in ms, ARGV[3] n.
+// Returns {allowed, remaining, retry after ms, reset after ms}.
+var fixedWindowScript = rueidis.NewLuaScript(`
+local limit = tonumber(ARGV[1])
+local window = tonumber(ARGV[2])
+local n = tonumber(ARGV[3])
+
+local current = tonumber(redis.call('GET', KEYS[1]) or '0')
+local ttl = redis.call('PTTL', KEYS[1])
+if ttl < 0 then
+	ttl = window
+end
+
+if current + n > limit then
+	return {0, limit - current, ttl, ttl}
+end
+
+current = redis.call('INCRBY', KEYS[1], n)
+if redis.call('PTTL', KEYS[1]) < 0 then
+	redis.call('PEXPIRE', KEYS[1], window)
+end
+return {1, limit - current, 0, ttl}
+`)
+
+// FixedWindow admits up to Limit requests per Window. It is the cheapest
+// algorithm, but a client can send up to twice the limit around a window boundary.
+type FixedWindow struct {
+	client rueidis.Client
+	limit  int64
+	window time.Duration
+
+	// Prefix is prepended to every key, DefaultPrefix when empty.
+	Prefix string
+}
+
+// NewFixedWindow returns a limiter admitting limit requests per window.
+func NewFixedWindow(client rueidis.Client, limit int64, window time.Duration) (*FixedWindow, error) {
+	if err := validateWindow(limit, window); err != nil {
+		return nil, err
+	}
+	return &FixedWindow{client: client, limit: limit, window: window}, nil
+}
+
+// Allow admits n requests for key if they fit in the current window.
+func (l *FixedWindow) Allow(ctx context.Context, key string, n int64) (Result, error) {
+	if err := validate(n, l.limit); err != nil {
+		return Result{}, err
+	}
+	return runScript(ctx, l.client, fixedWindowScript, limiterKey(l.client, l.Prefix, "fixed", key), l.limit,
+		strconv.FormatInt(l.limit, 10), strconv.FormatInt(l.window.Milliseconds(), 10), strconv.FormatInt(n, 10))
+}
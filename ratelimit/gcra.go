@@ -0,0 +1,82 @@
+package ratelimit
+
+import (
+	"context"
+	"fmt"
+	"strconv"
+	"time"
+
+	"github.com/redis/rueidis"
+)
+
+// gcraScript stores the theoretical arrival time (TAT) of the next request in ms.
+// KEYS[1] is the TAT, ARGV[1] the emission interval in ms, ARGV[2] the burst, ARGV[3] n.
+// Returns {allowed, remaining, retry after ms, reset after ms}.
+//
+// Ref : https://brandur.org/rate-limiting
+var gcraScript = rueidis.NewLuaScript(`
+local interval = tonumber(ARGV[1])
+local burst = tonumber(ARGV[2])
+local n = tonumber(ARGV[3])
+local tolerance = interval * burst
+
+local time = redis.call('TIME')
+local now = tonumber(time[1]) * 1000 + tonumber(time[2]) / 1000
+
+local tat = tonumber(redis.call('GET', KEYS[1]) or now)
+if tat < now then
+	tat = now
+end
+
+local newTat = tat + n * interval
+local diff = now - (newTat - tolerance)
+if diff < 0 then
+	local remaining = math.floor((now - (tat - tolerance)) / interval)
+	return {0, remaining, math.ceil(-diff), math.ceil(tat - now)}
+end
+
+local reset = math.ceil(newTat - now)
+redis.call('SET', KEYS[1], tostring(newTat), 'PX', reset)
+return {1, math.floor(diff / interval), 0, reset}
+`)
+
+// GCRA is a token bucket of Burst tokens refilled at Rate tokens per Period,
+// implemented as the generic cell rate algorithm: a single timestamp per key
+// and no background refill.
+type GCRA struct {
+	client   rueidis.Client
+	interval time.Duration
+	burst    int64
+
+	// Prefix is prepended to every key, DefaultPrefix when empty.
+	Prefix string
+}
+
+// NewGCRA returns a limiter refilling rate requests per period, allowing
+// bursts of up to burst requests.
+func NewGCRA(client rueidis.Client, rate int64, period time.Duration, burst int64) (*GCRA, error) {
+	if rate <= 0 {
+		return nil, fmt.Errorf("rate must be greater than 0")
+	}
+	if period <= 0 {
+		return nil, fmt.Errorf("period must be positive")
+	}
+	if burst <= 0 {
+		return nil, fmt.Errorf("burst must be greater than 0")
+	}
+	interval := period / time.Duration(rate)
+	if interval <= 0 {
+		return nil, fmt.Errorf("rate (%d) exceeds one request per nanosecond of period (%v)", rate, period)
+	}
+	return &GCRA{client: client, interval: interval, burst: burst}, nil
+}
+
+// Allow admits n requests for key if the bucket holds at least n tokens.
+func (l *GCRA) Allow(ctx context.Context, key string, n int64) (Result, error) {
+	if err := validate(n, l.burst); err != nil {
+		return Result{}, err
+	}
+	interval := strconv.FormatFloat(float64(l.interval)/float64(time.Millisecond), 'f', -1, 64)
+	return runScript(ctx, l.client, gcraScript, limiterKey(l.client, l.Prefix, "gcra", key), l.burst,
+		interval, strconv.FormatInt(l.burst, 10), strconv.FormatInt(n, 10))
+}
@@ -0,0 +1,88 @@
+package ratelimit
+
+import (
+	"errors"
+	"math"
+	"net"
+	"net/http"
+	"strconv"
+	"time"
+)
+
+// MiddlewareOptions configures Middleware.
+type MiddlewareOptions struct {
+	// KeyFunc returns the key a request is counted against, the client IP when nil.
+	KeyFunc func(r *http.Request) string
+	// Cost returns how many requests a request counts as, 1 when nil. A cost
+	// that is not positive is answered with 500 Internal Server Error.
+	Cost func(r *http.Request) int64
+	// FailClosed rejects requests with 503 when the limiter cannot be
+	// evaluated. By default they are let through. Requests costing more
+	// than the limit are always rejected with 429.
+	FailClosed bool
+}
+
+// Middleware rate limits an http.Handler, answering 429 Too Many Requests
+// when the limit is reached. Every limited response carries the RateLimit-Limit,
+// RateLimit-Remaining and RateLimit-Reset headers, and Retry-After when rejected.
+//
+// Ref : https://datatracker.ietf.org/doc/draft-ietf-httpapi-ratelimit-headers/
+func Middleware(limiter Limiter, opts MiddlewareOptions) func(http.Handler) http.Handler {
+	keyFunc := opts.KeyFunc
+	if keyFunc == nil {
+		keyFunc = KeyByRemoteAddr
+	}
+
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			n := int64(1)
+			if opts.Cost != nil {
+				n = opts.Cost(r)
+			}
+
+			result, err := limiter.Allow(r.Context(), keyFunc(r), n)
+			if errors.Is(err, ErrInvalidCost) {
+				// Only a failing limiter is let through, never a request it can not admit
+				status := http.StatusTooManyRequests
+				if n <= 0 {
+					status = http.StatusInternalServerError
+				}
+				http.Error(w, http.StatusText(status), status)
+				return
+			}
+			if err != nil {
+				if opts.FailClosed {
+					http.Error(w, http.StatusText(http.StatusServiceUnavailable), http.StatusServiceUnavailable)
+					return
+				}
+				next.ServeHTTP(w, r)
+				return
+			}
+
+			header := w.Header()
+			header.Set("RateLimit-Limit", strconv.FormatInt(result.Limit, 10))
+			header.Set("RateLimit-Remaining", strconv.FormatInt(result.Remaining, 10))
+			header.Set("RateLimit-Reset", formatSeconds(result.ResetAfter))
+			if !result.Allowed {
+				header.Set("Retry-After", formatSeconds(result.RetryAfter))
+				http.Error(w, http.StatusText(http.StatusTooManyRequests), http.StatusTooManyRequests)
+				return
+			}
+			next.ServeHTTP(w, r)
+		})
+	}
+}
+
+// KeyByRemoteAddr keys requests by the client IP of the connection.
+func KeyByRemoteAddr(r *http.Request) string {
+	host, _, err := net.SplitHostPort(r.RemoteAddr)
+	if err != nil {
+		return r.RemoteAddr
+	}
+	return host
+}
+
+// formatSeconds renders d as whole seconds, rounded up so clients never retry early.
+func formatSeconds(d time.Duration) string {
+	return strconv.FormatInt(int64(math.Ceil(d.Seconds())), 10)
+}
@@ -0,0 +1,99 @@
+// Package ratelimit implements Redis backed rate limiters on the module's client.
+//
+// Three algorithms are available, each evaluated atomically in a Lua script
+// using the Redis server clock, so every instance of a service shares one quota:
+//  1. FixedWindow counts requests in consecutive windows of a fixed length
+//  2. SlidingLog keeps a log of request times and counts those in the last window
+//  3. GCRA is the generic cell rate algorithm, a token bucket without a refill loop
+package ratelimit
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/redis/rueidis"
+
+	redis_cache "github.com/DeepankarAcharyya/Golang-RedisCache-Module/cache"
+)
+
+// DefaultPrefix is prepended to every rate limit key.
+const DefaultPrefix = "ratelimit"
+
+// Result is the outcome of a call to Allow.
+type Result struct {
+	// Allowed reports whether the n requests were admitted.
+	Allowed bool
+	// Limit is the maximum number of requests the limiter admits at once.
+	Limit int64
+	// Remaining is the number of requests still admitted right now.
+	Remaining int64
+	// RetryAfter is how long to wait before the same request can be admitted, 0 when allowed.
+	RetryAfter time.Duration
+	// ResetAfter is how long until the quota is fully restored.
+	ResetAfter time.Duration
+	// ResetAt is the time at which the quota is fully restored.
+	ResetAt time.Time
+}
+
+// ErrInvalidCost is returned by Allow when n is not positive or exceeds the
+// limit, as such requests can never be admitted.
+var ErrInvalidCost = errors.New("invalid request cost")
+
+// Limiter admits or rejects n requests for key.
+type Limiter interface {
+	Allow(ctx context.Context, key string, n int64) (Result, error)
+}
+
+// limiterKey builds the Redis key for a limiter, honouring the client's namespace.
+func limiterKey(client rueidis.Client, prefix string, algorithm string, key string) string {
+	if prefix == "" {
+		prefix = DefaultPrefix
+	}
+	return redis_cache.NamespacedKey(client, redis_cache.BuildKey(prefix, algorithm, key))
+}
+
+// runScript executes a limiter script that returns
+// {allowed, remaining, retry after ms, reset after ms}.
+func runScript(ctx context.Context, client rueidis.Client, script *rueidis.Lua, key string, limit int64, args ...string) (Result, error) {
+	values, err := script.Exec(ctx, client, []string{key}, args).AsIntSlice()
+	if err != nil {
+		return Result{}, fmt.Errorf("failed to evaluate rate limit: %w", err)
+	}
+	if len(values) != 4 {
+		return Result{}, fmt.Errorf("failed to evaluate rate limit: unexpected reply %v", values)
+	}
+
+	resetAfter := time.Duration(values[3]) * time.Millisecond
+	return Result{
+		Allowed:    values[0] == 1,
+		Limit:      limit,
+		Remaining:  max(values[1], 0),
+		RetryAfter: time.Duration(values[2]) * time.Millisecond,
+		ResetAfter: resetAfter,
+		ResetAt:    time.Now().Add(resetAfter),
+	}, nil
+}
+
+// validate rejects requests that could never be admitted.
+func validate(n int64, limit int64) error {
+	if n <= 0 {
+		return fmt.Errorf("%w: n must be greater than 0", ErrInvalidCost)
+	}
+	if n > limit {
+		return fmt.Errorf("%w: n (%d) exceeds the limit (%d)", ErrInvalidCost, n, limit)
+	}
+	return nil
+}
+
+// validateWindow rejects the settings of the window based limiters.
+func validateWindow(limit int64, window time.Duration) error {
+	if limit <= 0 {
+		return fmt.Errorf("limit must be greater than 0")
+	}
+	if window < time.Millisecond {
+		return fmt.Errorf("window must be at least 1ms")
+	}
+	return nil
+}
@@ -0,0 +1,269 @@
+package ratelimit
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/alicebob/miniredis/v2"
+	"github.com/redis/rueidis"
+)
+
+// setupTestClient starts a local stand-in Redis server whose clock is frozen,
+// so the tests can step through windows deterministically.
+func setupTestClient(t *testing.T) (rueidis.Client, *miniredis.Miniredis) {
+	m := miniredis.RunT(t)
+	m.SetTime(time.Unix(1700000000, 0))
+
+	client, err := rueidis.NewClient(rueidis.ClientOption{
+		InitAddress:  []string{m.Addr()},
+		DisableCache: true,
+	})
+	if err != nil {
+		t.Fatalf("Failed to connect to the test server: %v", err)
+	}
+	t.Cleanup(client.Close)
+	return client, m
+}
+
+// advance moves the server clock forward and expires keys accordingly.
+func advance(m *miniredis.Miniredis, now *time.Time, d time.Duration) {
+	*now = now.Add(d)
+	m.SetTime(*now)
+	m.FastForward(d)
+}
+
+func TestLimiters(t *testing.T) {
+	tests := []struct {
+		name       string
+		newLimiter func(client rueidis.Client) (Limiter, error)
+		// after exhausting the limit, how long until one more request is admitted
+		refill time.Duration
+	}{
+		{
+			name:       "fixed window",
+			newLimiter: func(client rueidis.Client) (Limiter, error) { return NewFixedWindow(client, 3, time.Second) },
+			refill:     time.Second,
+		},
+		{
+			name:       "sliding log",
+			newLimiter: func(client rueidis.Client) (Limiter, error) { return NewSlidingLog(client, 3, time.Second) },
+			refill:     time.Second,
+		},
+		{
+			name:       "gcra",
+			newLimiter: func(client rueidis.Client) (Limiter, error) { return NewGCRA(client, 3, time.Second, 3) },
+			refill:     334 * time.Millisecond, // a third of a second, rounded up to the ms
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			client, m := setupTestClient(t)
+			now := time.Unix(1700000000, 0)
+			limiter, err := tt.newLimiter(client)
+			if err != nil {
+				t.Fatalf("Failed to create the limiter: %v", err)
+			}
+			ctx := context.Background()
+
+			for i := int64(0); i < 3; i++ {
+				result, err := limiter.Allow(ctx, "user-1", 1)
+				if err != nil {
+					t.Fatalf("Allow() error = %v", err)
+				}
+				if !result.Allowed || result.Remaining != 2-i || result.Limit != 3 {
+					t.Fatalf("Allow() #%d = %+v, want allowed with %d remaining", i, result, 2-i)
+				}
+			}
+
+			result, err := limiter.Allow(ctx, "user-1", 1)
+			if err != nil {
+				t.Fatalf("Allow() error = %v", err)
+			}
+			if result.Allowed || result.Remaining != 0 {
+				t.Fatalf("Allow() over the limit = %+v, want denied", result)
+			}
+			if result.RetryAfter <= 0 || result.RetryAfter > tt.refill {
+				t.Errorf("RetryAfter = %v, want in (0, %v]", result.RetryAfter, tt.refill)
+			}
+			if result.ResetAfter <= 0 {
+				t.Errorf("ResetAfter = %v, want greater than 0", result.ResetAfter)
+			}
+
+			// Other keys have their own quota
+			if result, err := limiter.Allow(ctx, "user-2", 3); err != nil || !result.Allowed {
+				t.Errorf("Allow() on another key = %+v, %v, want allowed", result, err)
+			}
+
+			advance(m, &now, tt.refill)
+			if result, err := limiter.Allow(ctx, "user-1", 1); err != nil || !result.Allowed {
+				t.Errorf("Allow() after %v = %+v, %v, want allowed", tt.refill, result, err)
+			}
+
+			if _, err := limiter.Allow(ctx, "user-1", 4); !errors.Is(err, ErrInvalidCost) {
+				t.Errorf("Allow() with n above the limit error = %v, want ErrInvalidCost", err)
+			}
+		})
+	}
+}
+
+func TestNewLimiterValidation(t *testing.T) {
+	client, _ := setupTestClient(t)
+	tests := []struct {
+		name string
+		new  func() (Limiter, error)
+	}{
+		{name: "fixed window without limit", new: func() (Limiter, error) { return NewFixedWindow(client, 0, time.Second) }},
+		{name: "fixed window without window", new: func() (Limiter, error) { return NewFixedWindow(client, 1, 0) }},
+		{name: "sliding log without limit", new: func() (Limiter, error) { return NewSlidingLog(client, -1, time.Second) }},
+		{name: "sliding log with a sub-millisecond window", new: func() (Limiter, error) { return NewSlidingLog(client, 1, time.Microsecond) }},
+		{name: "gcra without rate", new: func() (Limiter, error) { return NewGCRA(client, 0, time.Second, 1) }},
+		{name: "gcra without period", new: func() (Limiter, error) { return NewGCRA(client, 1, 0, 1) }},
+		{name: "gcra without burst", new: func() (Limiter, error) { return NewGCRA(client, 1, time.Second, 0) }},
+		{name: "gcra with a rate above one per nanosecond", new: func() (Limiter, error) { return NewGCRA(client, 10, time.Nanosecond, 1) }},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if _, err := tt.new(); err == nil {
+				t.Error("Expected an error")
+			}
+		})
+	}
+}
+
+func TestSlidingLogHasNoBoundaryBurst(t *testing.T) {
+	client, m := setupTestClient(t)
+	now := time.Unix(1700000000, 0)
+	limiter, err := NewSlidingLog(client, 2, time.Second)
+	if err != nil {
+		t.Fatalf("NewSlidingLog() error = %v", err)
+	}
+	ctx := context.Background()
+
+	advance(m, &now, 900*time.Millisecond)
+	if result, _ := limiter.Allow(ctx, "user-1", 2); !result.Allowed {
+		t.Fatalf("Allow() = %+v, want allowed", result)
+	}
+
+	// A fixed window would have reset at the one second boundary
+	advance(m, &now, 200*time.Millisecond)
+	result, err := limiter.Allow(ctx, "user-1", 1)
+	if err != nil {
+		t.Fatalf("Allow() error = %v", err)
+	}
+	if result.Allowed {
+		t.Errorf("Allow() across the boundary = %+v, want denied", result)
+	}
+	if result.RetryAfter != 800*time.Millisecond {
+		t.Errorf("RetryAfter = %v, want %v", result.RetryAfter, 800*time.Millisecond)
+	}
+}
+
+func TestMiddleware(t *testing.T) {
+	client, _ := setupTestClient(t)
+	limiter, err := NewFixedWindow(client, 1, time.Minute)
+	if err != nil {
+		t.Fatalf("NewFixedWindow() error = %v", err)
+	}
+	handler := Middleware(limiter, MiddlewareOptions{})(
+		http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			w.WriteHeader(http.StatusNoContent)
+		}),
+	)
+
+	request := httptest.NewRequest(http.MethodGet, "/", nil)
+	request.RemoteAddr = "10.0.0.1:1234"
+
+	recorder := httptest.NewRecorder()
+	handler.ServeHTTP(recorder, request)
+	if recorder.Code != http.StatusNoContent {
+		t.Fatalf("first request status = %d, want %d", recorder.Code, http.StatusNoContent)
+	}
+	if got := recorder.Header().Get("RateLimit-Limit"); got != "1" {
+		t.Errorf("RateLimit-Limit = %q, want %q", got, "1")
+	}
+	if got := recorder.Header().Get("RateLimit-Remaining"); got != "0" {
+		t.Errorf("RateLimit-Remaining = %q, want %q", got, "0")
+	}
+	if got := recorder.Header().Get("RateLimit-Reset"); got != "60" {
+		t.Errorf("RateLimit-Reset = %q, want %q", got, "60")
+	}
+
+	recorder = httptest.NewRecorder()
+	handler.ServeHTTP(recorder, request)
+	if recorder.Code != http.StatusTooManyRequests {
+		t.Fatalf("second request status = %d, want %d", recorder.Code, http.StatusTooManyRequests)
+	}
+	if got := recorder.Header().Get("Retry-After"); got != "60" {
+		t.Errorf("Retry-After = %q, want %q", got, "60")
+	}
+}
+
+func TestMiddlewareInvalidCost(t *testing.T) {
+	client, _ := setupTestClient(t)
+	limiter, err := NewFixedWindow(client, 2, time.Minute)
+	if err != nil {
+		t.Fatalf("NewFixedWindow() error = %v", err)
+	}
+
+	tests := []struct {
+		name     string
+		cost     int64
+		wantCode int
+	}{
+		{name: "cost above the limit", cost: 3, wantCode: http.StatusTooManyRequests},
+		{name: "cost of zero", cost: 0, wantCode: http.StatusInternalServerError},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			// Fail open only applies to a failing limiter
+			handler := Middleware(limiter, MiddlewareOptions{Cost: func(*http.Request) int64 { return tt.cost }})(
+				http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+					w.WriteHeader(http.StatusNoContent)
+				}),
+			)
+			recorder := httptest.NewRecorder()
+			handler.ServeHTTP(recorder, httptest.NewRequest(http.MethodGet, "/", nil))
+			if recorder.Code != tt.wantCode {
+				t.Errorf("status = %d, want %d", recorder.Code, tt.wantCode)
+			}
+		})
+	}
+}
+
+func TestMiddlewareLimiterDown(t *testing.T) {
+	client, m := setupTestClient(t)
+	limiter, err := NewFixedWindow(client, 1, time.Minute)
+	if err != nil {
+		t.Fatalf("NewFixedWindow() error = %v", err)
+	}
+	m.Close()
+
+	tests := []struct {
+		name       string
+		failClosed bool
+		wantCode   int
+	}{
+		{name: "fail open", wantCode: http.StatusNoContent},
+		{name: "fail closed", failClosed: true, wantCode: http.StatusServiceUnavailable},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			handler := Middleware(limiter, MiddlewareOptions{FailClosed: tt.failClosed})(
+				http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+					w.WriteHeader(http.StatusNoContent)
+				}),
+			)
+			recorder := httptest.NewRecorder()
+			handler.ServeHTTP(recorder, httptest.NewRequest(http.MethodGet, "/", nil))
+			if recorder.Code != tt.wantCode {
+				t.Errorf("status = %d, want %d", recorder.Code, tt.wantCode)
+			}
+		})
+	}
+}
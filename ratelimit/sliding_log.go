@@ -0,0 +1,75 @@
+package ratelimit
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"fmt"
+	"strconv"
+	"time"
+
+	"github.com/redis/rueidis"
+)
+
+// slidingLogScript keeps a sorted set of request times scored in ms.
+// KEYS[1] is the log, ARGV[1] the limit, ARGV[2] the window in ms, ARGV[3] n,
+// ARGV[4] a token making the members of this call unique.
+// Returns {allowed, remaining, retry after ms, reset after ms}.
+var slidingLogScript = rueidis.NewLuaScript(`
+local limit = tonumber(ARGV[1])
+local window = tonumber(ARGV[2])
+local n = tonumber(ARGV[3])
+
+local time = redis.call('TIME')
+local now = tonumber(time[1]) * 1000 + math.floor(tonumber(time[2]) / 1000)
+
+redis.call('ZREMRANGEBYSCORE', KEYS[1], '-inf', now - window)
+local count = redis.call('ZCARD', KEYS[1])
+
+if count + n > limit then
+	-- n requests fit once the oldest count + n - limit entries left the window
+	local needed = count + n - limit - 1
+	local oldest = redis.call('ZRANGE', KEYS[1], needed, needed, 'WITHSCORES')
+	local newest = redis.call('ZRANGE', KEYS[1], -1, -1, 'WITHSCORES')
+	return {0, limit - count, tonumber(oldest[2]) + window - now, tonumber(newest[2]) + window - now}
+end
+
+for i = 1, n do
+	redis.call('ZADD', KEYS[1], now, ARGV[4] .. ':' .. i)
+end
+redis.call('PEXPIRE', KEYS[1], window)
+return {1, limit - count - n, 0, window}
+`)
+
+// SlidingLog admits up to Limit requests in any Window long interval. It is
+// exact, at the cost of storing one sorted set member per admitted request.
+type SlidingLog struct {
+	client rueidis.Client
+	limit  int64
+	window time.Duration
+
+	// Prefix is prepended to every key, DefaultPrefix when empty.
+	Prefix string
+}
+
+// NewSlidingLog returns a limiter admitting limit requests in any window.
+func NewSlidingLog(client rueidis.Client, limit int64, window time.Duration) (*SlidingLog, error) {
+	if err := validateWindow(limit, window); err != nil {
+		return nil, err
+	}
+	return &SlidingLog{client: client, limit: limit, window: window}, nil
+}
+
+// Allow admits n requests for key if fewer than limit - n were admitted in the last window.
+func (l *SlidingLog) Allow(ctx context.Context, key string, n int64) (Result, error) {
+	if err := validate(n, l.limit); err != nil {
+		return Result{}, err
+	}
+	b := make([]byte, 8)
+	if _, err := rand.Read(b); err != nil {
+		return Result{}, fmt.Errorf("failed to generate request token: %v", err)
+	}
+	token := hex.EncodeToString(b)
+	return runScript(ctx, l.client, slidingLogScript, limiterKey(l.client, l.Prefix, "sliding", key), l.limit,
+		strconv.FormatInt(l.limit, 10), strconv.FormatInt(l.window.Milliseconds(), 10), strconv.FormatInt(n, 10), token)
+}